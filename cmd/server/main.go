@@ -6,13 +6,17 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"goreilly/internal/cache"
 	"goreilly/internal/config"
 	"goreilly/internal/handlers"
+	"goreilly/internal/oreilly"
 	"goreilly/internal/storage"
 )
 
@@ -26,14 +30,99 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if err := setupLogOutput(cfg.LogOutput, cfg.LogMaxSizeMB, cfg.LogMaxBackups); err != nil {
+		log.Fatalf("Invalid LOG_OUTPUT: %v", err)
+	}
+
 	port := cfg.Port
 
-	// Set presigned URL expiry duration
-	handlers.PresignedURLExpiry = time.Duration(cfg.PresignedURLExpiry) * time.Hour
+	// Prepare the work directory (only this service's own stale leftovers are removed)
+	if err := handlers.SetupTmpDir(cfg.TmpDir, time.Duration(cfg.TmpCleanupMinutes)*time.Minute); err != nil {
+		log.Fatalf("Failed to prepare tmp directory: %v", err)
+	}
+
+	// Settings that SIGHUP can change (presigned expiry, limits, admin token, book policy)
+	if err := applyReloadable(cfg); err != nil {
+		log.Fatalf("Failed to load book policy: %v", err)
+	}
 	log.Printf("Presigned URL expiry set to: %d hours", cfg.PresignedURLExpiry)
 
+	handlers.TmpMaxBytes = int64(cfg.TmpMaxMB) << 20
+	handlers.TmpJobReserveBytes = int64(cfg.TmpJobReserveMB) << 20
+	handlers.CookiesPath = cfg.CookiesPath
+	handlers.MaxDownloadsPerProfile = cfg.MaxDownloadsPerProfile
+	handlers.SetPreviewConcurrency(cfg.PreviewConcurrency)
+	handlers.PreviewCacheTTL = time.Duration(cfg.PreviewCacheMinutes) * time.Minute
+	handlers.SetPrefetchConcurrency(cfg.PrefetchConcurrency)
+	handlers.SetUploadConcurrency(cfg.UploadConcurrency)
+	handlers.PreviewChapters = cfg.PreviewChapters
+	handlers.PreviewOnly = cfg.PreviewOnly
+	handlers.CalibreFlowSize = cfg.CalibreFlowSize
+	if err := handlers.SetDefaultOutputProfile(cfg.OutputProfile); err != nil {
+		log.Fatalf("Invalid OUTPUT_PROFILE: %v", err)
+	}
+	handlers.VerifyEPUBDefault = cfg.VerifyEPUB
+	handlers.CalibreRepairOnly = cfg.CalibreRepairOnly
+	oreilly.EPUBVersion = cfg.EPUBVersion
+	oreilly.EPUBCompression = cfg.EPUBCompression
+	oreilly.PackageConcurrency = cfg.PackageConcurrency
+	oreilly.SessionRevalidateInterval = time.Duration(cfg.SessionRevalidateMinutes) * time.Minute
+	oreilly.CookiesDir = cfg.CookiesDir
+	oreilly.AccountMaxFailures = cfg.AccountMaxFailures
+	oreilly.AccountCooldown = time.Duration(cfg.AccountCooldownMinutes) * time.Minute
+	oreilly.LoginCheckTimeout = time.Duration(cfg.LoginCheckTimeoutSeconds) * time.Second
+	oreilly.LoginCheckRetries = cfg.LoginCheckRetries
+	oreilly.IncludePageBreaks = cfg.IncludePageBreaks
+	oreilly.PrefetchTOC = cfg.PrefetchTOC
+	oreilly.ChapterPageConcurrency = cfg.ChapterPageConcurrency
+	oreilly.MetadataProvider = cfg.MetadataProvider
+	oreilly.MaxFailedChapters = cfg.MaxFailedChapters
+	oreilly.MaxFailedChapterPercent = cfg.MaxFailedChapterPercent
+	oreilly.TrimEmptyChapters = cfg.TrimEmptyChapters
+	oreilly.OptimizeImages = cfg.OptimizeImages
+	oreilly.NormalizeMetadata = cfg.NormalizeMetadata
+	oreilly.SourceLink = cfg.SourceLink
+	oreilly.ContentSelector = cfg.ContentSelector
+	handlers.FreshnessCheck = cfg.FreshnessCheck
+	oreilly.MinEPUBKBPerChapter = cfg.MinEPUBKBPerChapter
+	oreilly.StrictEPUBSize = cfg.StrictEPUBSize
+	oreilly.PaywallMarkers = cfg.PaywallMarkers
+	oreilly.ContentSelectors = cfg.ContentSelectors
+	oreilly.GoogleBooksAPIKey = cfg.GoogleBooksAPIKey
+
+	// Probe for Calibre once so format support is known up front
+	handlers.DetectCalibre()
+	if err := handlers.SetDefaultFormat(cfg.DefaultFormat); err != nil {
+		log.Fatalf("Invalid DEFAULT_FORMAT: %v", err)
+	}
+
+	// With WAIT_FOR_DEPS, Redis and MinIO are retried until they are up (or
+	// the wait is over) instead of running without them for the process lifetime
+	var depsWait time.Duration
+	if cfg.WaitForDeps {
+		depsWait = time.Duration(cfg.WaitForDepsSeconds) * time.Second
+		log.Printf("[Init] Waiting up to %v for Redis and MinIO", depsWait)
+	}
+
 	// Initialize Redis client
-	redisClient, err := cache.NewRedisClient(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword)
+	redisConfig := cache.RedisConfig{
+		Host:     cfg.RedisHost,
+		Port:     cfg.RedisPort,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+		TLS:      cfg.RedisTLS,
+		URL:      cfg.RedisURL,
+
+		TLSServerName: cfg.RedisTLSServerName,
+
+		Mode:             cfg.RedisMode,
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		SentinelPassword: cfg.RedisSentinelPassword,
+	}
+	redisClient, err := waitForDependency("Redis", depsWait, func() (*cache.RedisClient, error) {
+		return cache.NewRedisClient(redisConfig)
+	})
 	if err != nil {
 		log.Printf("WARNING: Redis unavailable - %v", err)
 	} else {
@@ -42,44 +131,107 @@ func main() {
 	}
 
 	// Initialize MinIO client
-	minioClient, err := storage.NewMinIOClient(storage.MinIOConfig{
+	minioConfig := storage.MinIOConfig{
 		Endpoint:  cfg.MinIOEndpoint,
 		AccessKey: cfg.MinIOAccessKey,
 		SecretKey: cfg.MinIOSecretKey,
 		Bucket:    cfg.MinIOBucket,
 		UseSSL:    cfg.MinIOUseSSL,
 		Region:    cfg.MinIORegion,
+	}
+	minioClient, err := waitForDependency("MinIO", depsWait, func() (*storage.MinIOClient, error) {
+		client, err := storage.NewMinIOClient(minioConfig)
+		if err == nil && cfg.WaitForDeps {
+			// The client connects lazily, make sure the server is actually up
+			err = client.Ping()
+		}
+		return client, err
 	})
-	if err != nil {
+	if err != nil && minioClient == nil {
 		log.Printf("WARNING: MinIO unavailable - %v", err)
 	} else {
+		if err != nil {
+			log.Printf("WARNING: MinIO not reachable yet - %v", err)
+		}
 		handlers.MinIOClient = minioClient
+		for _, bucket := range cfg.MinIOBuckets {
+			if err := minioClient.WithBucket(bucket).EnsureBucket(); err != nil {
+				log.Printf("WARNING: Allowed bucket unavailable - %v", err)
+			}
+		}
 	}
+	handlers.AllowedBuckets = cfg.MinIOBuckets
+	handlers.ObjectMetadataEnabled = cfg.MinIOObjectMeta
 
 	router := mux.NewRouter()
 
 	router.HandleFunc("/api/download", handlers.DownloadBookHandler).Methods("POST")
 	router.HandleFunc("/api/book/{id}/info", handlers.GetBookInfoHandler).Methods("GET")
+	router.HandleFunc("/api/book/{id}/info", handlers.HeadBookInfoHandler).Methods("HEAD")
+	router.HandleFunc("/api/book/{id}/formats", handlers.GetBookFormatsHandler).Methods("GET")
+	router.HandleFunc("/api/book/{id}/link", handlers.GetBookLinkHandler).Methods("GET")
+	router.HandleFunc("/api/book/{id}/exists", handlers.BookExistsHandler).Methods("GET")
 	router.HandleFunc("/api/status/{id}", handlers.GetStatusHandler).Methods("GET")
+	router.HandleFunc("/api/download/{id}/retry", handlers.RetryDownloadHandler).Methods("POST")
+	router.HandleFunc("/api/download/{id}/logs", handlers.GetDownloadLogsHandler).Methods("GET")
 	router.HandleFunc("/api/stream/{id}", handlers.StreamDownloadStatusHandler).Methods("GET")
 	router.HandleFunc("/api/file/{id}", handlers.GetFileHandler).Methods("GET")
 	router.HandleFunc("/api/file/{id}/info", handlers.GetFileInfoHandler).Methods("GET")
 	router.HandleFunc("/api/stats", handlers.GetStatsHandler).Methods("GET")
+	router.HandleFunc("/api/queue", handlers.QueueHandler).Methods("GET")
+	router.HandleFunc("/api/cache/flush", handlers.FlushCacheHandler).Methods("POST")
+	router.HandleFunc("/api/prefetch", handlers.PrefetchHandler).Methods("POST")
+	router.HandleFunc("/api/admin/accounts", handlers.AccountsHandler).Methods("GET")
+	router.HandleFunc("/api/admin/cache", handlers.CacheListHandler).Methods("GET")
+	router.HandleFunc("/api/admin/cache/{id}/pin", handlers.PinBookHandler).Methods("PUT", "DELETE")
+	router.HandleFunc("/readyz", handlers.ReadyHandler).Methods("GET")
 
-	staticContent, _ := fs.Sub(staticFS, "static")
-	router.PathPrefix("/").Handler(http.FileServer(http.FS(staticContent)))
+	// Frontend: a directory on disk (no rebuild needed for changes) or the embedded copy
+	var staticContent fs.FS
+	if cfg.StaticDir != "" {
+		staticContent = os.DirFS(cfg.StaticDir)
+		log.Printf("Serving frontend from %s", cfg.StaticDir)
+	} else {
+		staticContent, _ = fs.Sub(staticFS, "static")
+	}
+	router.PathPrefix("/").Handler(handlers.StaticHandler(staticContent))
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"X-Cached", "X-Cached-Formats"},
 		AllowCredentials: true,
 	})
 
 	handler := c.Handler(router)
+	if cfg.Compression {
+		handler = handlers.Gzip(handler)
+	}
+	if cfg.AccessLog {
+		handler = handlers.AccessLog(handler)
+	}
+
+	// SIGHUP reloads the settings applyReloadable covers
+	go watchReload()
 
 	addr := fmt.Sprintf("0.0.0.0:%s", port)
-	log.Printf("Server started on http://localhost:%s", port)
+
+	// HTTP/2 is negotiated automatically over TLS; without TLS it needs h2c
+	if cfg.TLSCertFile != "" {
+		log.Printf("Server started on https://localhost:%s (HTTP/2 enabled)", port)
+		if err := http.ListenAndServeTLS(addr, cfg.TLSCertFile, cfg.TLSKeyFile, handler); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+		log.Printf("Server started on http://localhost:%s (cleartext HTTP/2 enabled)", port)
+	} else {
+		log.Printf("Server started on http://localhost:%s", port)
+	}
 
 	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatal(err)
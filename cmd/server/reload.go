@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"goreilly/internal/config"
+	"goreilly/internal/handlers"
+)
+
+// applyReloadable applies the settings that can change while the server runs.
+// It is used at startup and again on SIGHUP:
+//
+//   - PRESIGNED_URL_EXPIRY_HOURS
+//   - DOWNLOAD_RATE_LIMIT_KB (jobs already running keep their limit)
+//   - JOB_TIMEOUT_MINUTES (for jobs started after the reload)
+//   - MAX_QUEUE_DEPTH
+//   - MAX_SSE_CONNECTIONS, MAX_SSE_CLIENTS_PER_DOWNLOAD
+//   - ADMIN_TOKEN
+//   - BOOK_POLICY_FILE (the file is read again)
+//
+// Everything else (ports, TLS, Redis/MinIO connections, concurrency pools,
+// tmp and log setup, EPUB options) is read once and needs a restart.
+func applyReloadable(cfg *config.Config) error {
+	// Loaded first: a broken policy file fails the reload before anything changes
+	if err := handlers.LoadBookPolicy(cfg.BookPolicyFile); err != nil {
+		return err
+	}
+
+	handlers.PresignedURLExpiry.Set(time.Duration(cfg.PresignedURLExpiry) * time.Hour)
+	handlers.DownloadRateLimitKB.Set(cfg.DownloadRateLimitKB)
+	handlers.JobTimeout.Set(time.Duration(cfg.JobTimeoutMinutes) * time.Minute)
+	handlers.MaxQueueDepth.Set(cfg.MaxQueueDepth)
+	handlers.MaxSSEConnections.Set(cfg.MaxSSEConnections)
+	handlers.MaxSSEClientsPerDownload.Set(cfg.MaxSSEClientsPerDownload)
+	handlers.AdminToken.Set(cfg.AdminToken)
+	return nil
+}
+
+// watchReload reloads the configuration on every SIGHUP. The environment of a
+// running process doesn't change, so new values come from CONFIG_FILE (which
+// environment variables still override). An invalid configuration is rejected
+// as a whole and the current settings stay in place.
+func watchReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		log.Printf("[Config] SIGHUP received, reloading configuration")
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			log.Printf("[Config] ERROR: Reload failed, keeping the current settings: %v", err)
+			continue
+		}
+		if err := applyReloadable(cfg); err != nil {
+			log.Printf("[Config] ERROR: Reload failed, keeping the current settings: %v", err)
+			continue
+		}
+		log.Printf("[Config] Reloaded (presigned expiry %dh, rate limit %d KB/s, job timeout %dm, max queue %d, SSE %d/%d per download)",
+			cfg.PresignedURLExpiry, cfg.DownloadRateLimitKB, cfg.JobTimeoutMinutes, cfg.MaxQueueDepth,
+			cfg.MaxSSEConnections, cfg.MaxSSEClientsPerDownload)
+	}
+}
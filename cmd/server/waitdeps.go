@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Backoff between connection attempts while waiting for a dependency
+const (
+	depsInitialBackoff = time.Second
+	depsMaxBackoff     = 15 * time.Second
+)
+
+// waitForDependency calls connect until it succeeds or maxWait has passed,
+// backing off between attempts. With maxWait 0 connect is tried once. The
+// result of the last attempt is returned.
+func waitForDependency[T any](name string, maxWait time.Duration, connect func() (T, error)) (T, error) {
+	deadline := time.Now().Add(maxWait)
+	backoff := depsInitialBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := connect()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("[Init] %s is ready (attempt %d)", name, attempt)
+			}
+			return result, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if maxWait > 0 {
+				log.Printf("[Init] Gave up waiting for %s after %v (%d attempts)", name, maxWait, attempt)
+			}
+			return result, err
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+		log.Printf("[Init] %s not ready (attempt %d): %v - retrying in %v", name, attempt, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > depsMaxBackoff {
+			backoff = depsMaxBackoff
+		}
+	}
+}
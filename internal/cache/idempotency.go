@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyTTL is how long an Idempotency-Key keeps pointing at its download
+const IdempotencyTTL = time.Hour
+
+// ReserveIdempotencyKey maps an Idempotency-Key to a download ID unless the key
+// is already taken, in which case the existing download ID is returned
+func (r *RedisClient) ReserveIdempotencyKey(key, downloadID string) (string, error) {
+	reserved, err := r.client.SetNX(r.ctx, idempotencyKey(key), downloadID, IdempotencyTTL).Result()
+	if err != nil {
+		return "", err
+	}
+	if reserved {
+		return "", nil
+	}
+
+	existing, err := r.client.Get(r.ctx, idempotencyKey(key)).Result()
+	if err == redis.Nil {
+		// Expired between SETNX and GET, take it over
+		return "", r.SetIdempotencyKey(key, downloadID)
+	}
+	return existing, err
+}
+
+// SetIdempotencyKey (re)maps an Idempotency-Key to a download ID
+func (r *RedisClient) SetIdempotencyKey(key, downloadID string) error {
+	return r.client.Set(r.ctx, idempotencyKey(key), downloadID, IdempotencyTTL).Err()
+}
+
+// ReleaseIdempotencyKey forgets an Idempotency-Key whose request was not accepted
+func (r *RedisClient) ReleaseIdempotencyKey(key string) error {
+	return r.client.Del(r.ctx, idempotencyKey(key)).Err()
+}
+
+// idempotencyKey returns the Redis key of an Idempotency-Key header value
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
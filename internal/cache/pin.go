@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pinnedKey is the Redis set of pinned book IDs. Pinned books form a reference
+// shelf: their entries never expire and cache flushes keep them unless forced.
+const pinnedKey = "pinned:books"
+
+// PinBook pins a book (it may be cached later, the pin then applies as soon as
+// it is stored) and marks its existing entries as pinned
+func (r *RedisClient) PinBook(bookID string) error {
+	if err := r.client.SAdd(r.ctx, pinnedKey, bookID).Err(); err != nil {
+		return err
+	}
+	log.Printf("[Cache] Pinned: %s", bookID)
+	return r.setPinned(bookID, true)
+}
+
+// UnpinBook removes a book's pin, its entries become ordinary cache entries again
+func (r *RedisClient) UnpinBook(bookID string) error {
+	if err := r.client.SRem(r.ctx, pinnedKey, bookID).Err(); err != nil {
+		return err
+	}
+	log.Printf("[Cache] Unpinned: %s", bookID)
+	return r.setPinned(bookID, false)
+}
+
+// IsPinned reports whether a book is pinned
+func (r *RedisClient) IsPinned(bookID string) (bool, error) {
+	return r.client.SIsMember(r.ctx, pinnedKey, bookID).Result()
+}
+
+// PinnedBooks lists the pinned book IDs in sorted order
+func (r *RedisClient) PinnedBooks() ([]string, error) {
+	ids, err := r.client.SMembers(r.ctx, pinnedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// setPinned rewrites the pinned flag of every cached format of a book (and its
+// ISBN index) and removes any expiry from its keys
+func (r *RedisClient) setPinned(bookID string, pinned bool) error {
+	formats, err := r.GetBookFormats(bookID)
+	if err != nil {
+		return err
+	}
+
+	for _, format := range formats {
+		key := bookKey(bookID, format)
+		info, err := r.getCacheInfo(key)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			// Legacy EPUB entry
+			key = fmt.Sprintf("book:%s", bookID)
+			if info, err = r.getCacheInfo(key); err != nil || info == nil {
+				continue
+			}
+		}
+		if info.Pinned == pinned {
+			continue
+		}
+		info.Pinned = pinned
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := r.client.Set(r.ctx, key, data, 0).Err(); err != nil {
+			return err
+		}
+		if info.ISBN != "" {
+			if err := r.client.Set(r.ctx, isbnKey(info.scopedID(info.ISBN), info.Format), data, 0).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pinned {
+		// Set with 0 already drops expiries, the format set has its own
+		if err := r.client.Persist(r.ctx, formatsKey(bookID)).Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBooks returns every cached book entry (one per book and format), sorted
+// by book ID and format. In cluster mode every master is scanned.
+func (r *RedisClient) ListBooks() ([]BookCacheInfo, error) {
+	pinned, err := r.PinnedBooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var books []BookCacheInfo
+	err = r.scanKeys("book:*", func(key string) error {
+		data, err := r.client.Get(r.ctx, key).Result()
+		if err == redis.Nil {
+			return nil // Deleted while scanning
+		}
+		if err != nil {
+			return err
+		}
+
+		var info BookCacheInfo
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			log.Printf("[Cache] WARNING: Skipping unreadable entry %s: %v", key, err)
+			return nil
+		}
+		if info.Format == "" {
+			info.Format = DefaultFormat
+		}
+		info.Pinned = contains(pinned, info.scopedID(info.BookID))
+		books = append(books, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].BookID != books[j].BookID {
+			return books[i].BookID < books[j].BookID
+		}
+		return books[i].Format < books[j].Format
+	})
+	return books, nil
+}
+
+// pinnedCacheKey reports whether a download cache key belongs to a pinned book
+func pinnedCacheKey(key string, pinned []string, entry func() *BookCacheInfo) bool {
+	if len(pinned) == 0 {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(key, "formats:"):
+		return contains(pinned, strings.TrimPrefix(key, "formats:"))
+	case strings.HasPrefix(key, "book:"):
+		bookID, _, _ := strings.Cut(strings.TrimPrefix(key, "book:"), ":")
+		return contains(pinned, bookID)
+	default:
+		// ISBN index entries are copies of the book entry
+		info := entry()
+		return info != nil && contains(pinned, info.scopedID(info.BookID))
+	}
+}
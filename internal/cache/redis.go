@@ -2,42 +2,134 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"goreilly/internal/models"
 )
 
 // RedisClient wraps the Redis client
 type RedisClient struct {
-	client *redis.Client
+	client redis.UniversalClient // *redis.Client, failover (Sentinel) or cluster client
 	ctx    context.Context
 }
 
+// Redis connection modes
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 // BookCacheInfo stores cached book information
 type BookCacheInfo struct {
 	BookID      string    `json:"book_id"`
 	BookTitle   string    `json:"book_title"`
-	EpubPath    string    `json:"epub_path"`    // MinIO object path (not URL)
+	EpubPath    string    `json:"epub_path"`    // MinIO object path of the file (not URL), any format
 	EpubSize    int64     `json:"epub_size,omitempty"`
 	UploadedAt  time.Time `json:"uploaded_at"`
 	ISBN        string    `json:"isbn,omitempty"`
+	ExtrasPath  string    `json:"extras_path,omitempty"` // Supplementary files bundle, if fetched
+	TOCPath     string    `json:"toc_path,omitempty"`    // toc.json, if uploaded
+	Format      string    `json:"format,omitempty"`      // Output format (epub if empty)
+	Prefix      string    `json:"prefix,omitempty"`      // Object prefix (tenant folder) the entry belongs to
+	Bucket      string    `json:"bucket,omitempty"`      // Bucket holding the objects ("" = the configured bucket)
+	WordCount   int       `json:"word_count,omitempty"`  // Words across the book's chapters
+	Pinned      bool      `json:"pinned,omitempty"`      // Never expires, kept by cache flushes (see PinBook)
+	Fingerprint string    `json:"fingerprint,omitempty"` // Content version the file was built from (see oreilly.Fingerprint)
+}
+
+// RedisConfig holds Redis connection configuration
+type RedisConfig struct {
+	Host     string
+	Port     string
+	Password string
+	DB       int
+	TLS      bool
+	URL      string // redis:// or rediss:// URL, overrides the fields above when set (standalone only)
+
+	// Name the TLS certificates are checked against. Empty checks each node
+	// against the address it is dialed at, which sentinel and cluster need:
+	// their nodes are not at Host.
+	TLSServerName string
+
+	// High availability
+	Mode             string   // standalone (default), sentinel or cluster
+	Addrs            []string // Sentinel addresses (sentinel) or seed nodes (cluster)
+	MasterName       string   // Sentinel master name
+	SentinelPassword string
 }
 
 // NewRedisClient creates a new Redis client
-func NewRedisClient(host, port, password string) (*RedisClient, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", host, port),
-		Password: password,
-		DB:       0,
-	})
+func NewRedisClient(config RedisConfig) (*RedisClient, error) {
+	var tlsConfig *tls.Config
+	if config.TLS {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: config.TLSServerName,
+		}
+	}
+
+	var client redis.UniversalClient
+	switch config.Mode {
+	case RedisModeSentinel:
+		if len(config.Addrs) == 0 || config.MasterName == "" {
+			return nil, fmt.Errorf("sentinel mode requires sentinel addresses and a master name")
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.MasterName,
+			SentinelAddrs:    config.Addrs,
+			SentinelPassword: config.SentinelPassword,
+			Password:         config.Password,
+			DB:               config.DB,
+			TLSConfig:        tlsConfig,
+		})
+		log.Printf("[Redis] Using Sentinel (master: %s, sentinels: %d)", config.MasterName, len(config.Addrs))
+
+	case RedisModeCluster:
+		if len(config.Addrs) == 0 {
+			return nil, fmt.Errorf("cluster mode requires at least one node address")
+		}
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     config.Addrs,
+			Password:  config.Password,
+			TLSConfig: tlsConfig,
+		})
+		log.Printf("[Redis] Using cluster (%d seed nodes)", len(config.Addrs))
+
+	case "", RedisModeStandalone:
+		var opts *redis.Options
+		if config.URL != "" {
+			parsed, err := redis.ParseURL(config.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Redis URL: %w", err)
+			}
+			opts = parsed
+		} else {
+			opts = &redis.Options{
+				Addr:      fmt.Sprintf("%s:%s", config.Host, config.Port),
+				Password:  config.Password,
+				DB:        config.DB,
+				TLSConfig: tlsConfig,
+			}
+		}
+		client = redis.NewClient(opts)
+		log.Printf("[Redis] Using standalone (db: %d, tls: %t)", opts.DB, opts.TLSConfig != nil)
+
+	default:
+		return nil, fmt.Errorf("unknown Redis mode: %s", config.Mode)
+	}
 
 	ctx := context.Background()
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -48,10 +140,22 @@ func NewRedisClient(host, port, password string) (*RedisClient, error) {
 	}, nil
 }
 
-// GetBookInfo retrieves cached book information
-func (r *RedisClient) GetBookInfo(bookID string) (*BookCacheInfo, error) {
-	key := fmt.Sprintf("book:%s", bookID)
-	
+// DefaultFormat is the format of cache entries written before entries were keyed by format
+const DefaultFormat = "epub"
+
+// GetBookInfo retrieves cached book information for one output format
+func (r *RedisClient) GetBookInfo(bookID, format string) (*BookCacheInfo, error) {
+	info, err := r.getCacheInfo(bookKey(bookID, format))
+	if err != nil || info != nil || format != DefaultFormat {
+		return info, err
+	}
+
+	// Entries cached before format-aware keys are EPUB-only
+	return r.getCacheInfo(fmt.Sprintf("book:%s", bookID))
+}
+
+// getCacheInfo reads and decodes a cache entry (nil if not found)
+func (r *RedisClient) getCacheInfo(key string) (*BookCacheInfo, error) {
 	data, err := r.client.Get(r.ctx, key).Result()
 	if err == redis.Nil {
 		return nil, nil // Not found
@@ -64,43 +168,357 @@ func (r *RedisClient) GetBookInfo(bookID string) (*BookCacheInfo, error) {
 	if err := json.Unmarshal([]byte(data), &info); err != nil {
 		return nil, err
 	}
+	if info.Format == "" {
+		info.Format = DefaultFormat
+	}
 
-	log.Printf("[Cache] Found: %s", info.BookTitle)
+	log.Printf("[Cache] Found: %s (%s)", info.BookTitle, info.Format)
 	return &info, nil
 }
 
-// SetBookInfo stores book information in cache
+// SetBookInfo stores book information in cache under its format
 func (r *RedisClient) SetBookInfo(info *BookCacheInfo) error {
-	key := fmt.Sprintf("book:%s", info.BookID)
-	
+	if info.Format == "" {
+		info.Format = DefaultFormat
+	}
+
+	// Pinned books keep the flag across re-downloads
+	bookID := info.scopedID(info.BookID)
+	pinned, err := r.IsPinned(bookID)
+	if err != nil {
+		return err
+	}
+	info.Pinned = pinned
+
 	data, err := json.Marshal(info)
 	if err != nil {
 		return err
 	}
 
-	// Set with no expiration (or set expiration as needed)
-	if err := r.client.Set(r.ctx, key, data, 0).Err(); err != nil {
+	// Set with no expiration (pinned entries must never get one)
+	if err := r.client.Set(r.ctx, bookKey(bookID, info.Format), data, 0).Err(); err != nil {
 		return err
 	}
 
-	log.Printf("[Cache] Stored: %s", info.BookTitle)
+	// Track which formats exist for the book
+	if err := r.client.SAdd(r.ctx, formatsKey(bookID), info.Format).Err(); err != nil {
+		return err
+	}
+
+	// Index by ISBN so other book IDs for the same edition can reuse the object
+	if info.ISBN != "" {
+		if err := r.client.Set(r.ctx, isbnKey(info.scopedID(info.ISBN), info.Format), data, 0).Err(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[Cache] Stored: %s (%s)", info.BookTitle, info.Format)
 	return nil
 }
 
-// DeleteBookInfo removes book information from cache
+// GetBookInfoByISBN retrieves cached book information indexed by ISBN
+func (r *RedisClient) GetBookInfoByISBN(isbn, format string) (*BookCacheInfo, error) {
+	if isbn == "" {
+		return nil, nil
+	}
+
+	info, err := r.getCacheInfo(isbnKey(isbn, format))
+	if err != nil || info != nil || format != DefaultFormat {
+		return info, err
+	}
+	return r.getCacheInfo(fmt.Sprintf("isbn:%s", isbn))
+}
+
+// GetBookFormats lists the formats cached for a book
+func (r *RedisClient) GetBookFormats(bookID string) ([]string, error) {
+	formats, err := r.client.SMembers(r.ctx, formatsKey(bookID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Legacy EPUB entry
+	if !contains(formats, DefaultFormat) {
+		exists, err := r.client.Exists(r.ctx, fmt.Sprintf("book:%s", bookID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			formats = append(formats, DefaultFormat)
+		}
+	}
+	return formats, nil
+}
+
+// GetBookFiles returns the cache entry of every stored format of a book
+// (format -> entry, empty if none)
+func (r *RedisClient) GetBookFiles(bookID string) (map[string]*BookCacheInfo, error) {
+	formats, err := r.GetBookFormats(bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*BookCacheInfo, len(formats))
+	for _, format := range formats {
+		info, err := r.GetBookInfo(bookID, format)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil && info.EpubPath != "" {
+			files[format] = info
+		}
+	}
+	return files, nil
+}
+
+// SetBookPreview stores the full O'Reilly metadata of a book (used as a stale fallback)
+func (r *RedisClient) SetBookPreview(bookID string, info *models.BookInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(r.ctx, previewKey(bookID), data, 0).Err()
+}
+
+// GetBookPreview retrieves cached O'Reilly metadata of a book
+func (r *RedisClient) GetBookPreview(bookID string) (*models.BookInfo, error) {
+	data, err := r.client.Get(r.ctx, previewKey(bookID)).Result()
+	if err == redis.Nil {
+		return nil, nil // Not found
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info models.BookInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ScopedID qualifies a book ID or ISBN with an object prefix so that entries of
+// different tenants never collide. Lookups for a prefixed entry pass the scoped ID.
+func ScopedID(prefix, id string) string {
+	if prefix == "" {
+		return id
+	}
+	return prefix + "/" + id
+}
+
+// BucketScopedID is ScopedID for an entry stored in a chosen bucket ("" = the
+// configured bucket, whose IDs are the plain ScopedID), so each bucket keeps
+// its own entries: bucket@prefix/id
+func BucketScopedID(bucket, prefix, id string) string {
+	if bucket == "" {
+		return ScopedID(prefix, id)
+	}
+	return bucket + "@" + ScopedID(prefix, id)
+}
+
+// scopedID returns the entry's book ID or ISBN qualified with its prefix and bucket
+func (info *BookCacheInfo) scopedID(id string) string {
+	return BucketScopedID(info.Bucket, info.Prefix, id)
+}
+
+// enrichmentTTL is how long external metadata lookups are cached (including misses)
+const enrichmentTTL = 30 * 24 * time.Hour
+
+// SetEnrichment caches external metadata of an ISBN
+func (r *RedisClient) SetEnrichment(isbn string, enrichment *models.Enrichment) error {
+	data, err := json.Marshal(enrichment)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(r.ctx, enrichmentKey(isbn, enrichment.Source), data, enrichmentTTL).Err()
+}
+
+// GetEnrichment retrieves cached external metadata of an ISBN from one provider
+func (r *RedisClient) GetEnrichment(isbn, source string) (*models.Enrichment, error) {
+	data, err := r.client.Get(r.ctx, enrichmentKey(isbn, source)).Result()
+	if err == redis.Nil {
+		return nil, nil // Not found
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var enrichment models.Enrichment
+	if err := json.Unmarshal([]byte(data), &enrichment); err != nil {
+		return nil, err
+	}
+	return &enrichment, nil
+}
+
+// enrichmentKey returns the Redis key of an ISBN's external metadata
+func enrichmentKey(isbn, source string) string {
+	return fmt.Sprintf("enrich:%s:%s", source, isbn)
+}
+
+// previewKey returns the Redis key of a book's cached metadata
+func previewKey(bookID string) string {
+	return fmt.Sprintf("preview:%s", bookID)
+}
+
+// bookKey returns the Redis key of a book's cache entry for one format
+func bookKey(bookID, format string) string {
+	return fmt.Sprintf("book:%s:%s", bookID, format)
+}
+
+// formatsKey returns the Redis key of the set of formats cached for a book
+func formatsKey(bookID string) string {
+	return fmt.Sprintf("formats:%s", bookID)
+}
+
+// isbnKey returns the Redis key of the ISBN index for one format
+func isbnKey(isbn, format string) string {
+	return fmt.Sprintf("isbn:%s:%s", isbn, format)
+}
+
+// contains reports whether a string is in the slice
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteBookInfo removes every cached format of a book
 func (r *RedisClient) DeleteBookInfo(bookID string) error {
-	key := fmt.Sprintf("book:%s", bookID)
-	return r.client.Del(r.ctx, key).Err()
+	formats, err := r.GetBookFormats(bookID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{fmt.Sprintf("book:%s", bookID), formatsKey(bookID)}
+	for _, format := range formats {
+		keys = append(keys, bookKey(bookID, format))
+
+		// The ISBN index would otherwise keep serving the deleted entry
+		isbnKeys, err := r.isbnAliases(bookID, format)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, isbnKeys...)
+	}
+
+	// Delete one key at a time so cluster mode never sees a cross-slot command
+	for _, key := range keys {
+		if err := r.client.Del(r.ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isbnAliases returns the ISBN index keys of a book's entry for one format
+// that still point at it (another book ID of the edition may own them since)
+func (r *RedisClient) isbnAliases(bookID, format string) ([]string, error) {
+	info, err := r.GetBookInfo(bookID, format)
+	if err != nil || info == nil || info.ISBN == "" {
+		return nil, err
+	}
+
+	isbn := info.scopedID(info.ISBN)
+	candidates := []string{isbnKey(isbn, format)}
+	if format == DefaultFormat {
+		candidates = append(candidates, fmt.Sprintf("isbn:%s", isbn))
+	}
+
+	var keys []string
+	for _, key := range candidates {
+		alias, err := r.getCacheInfo(key)
+		if err != nil {
+			return nil, err
+		}
+		if alias != nil && (alias.BookID == info.BookID || alias.EpubPath == info.EpubPath) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Key patterns of the download cache (previews are metadata only and kept)
+var bookCachePatterns = []string{"book:*", "formats:*", "isbn:*"}
+
+// FlushBooks deletes every download cache entry (book, format set and ISBN
+// index keys) using SCAN so Redis is never blocked, and returns how many keys
+// were removed and how many were kept because their book is pinned (force
+// deletes those too, the pins themselves stay). In cluster mode every master
+// is scanned.
+func (r *RedisClient) FlushBooks(force bool) (int, int, error) {
+	var pinned []string
+	if !force {
+		var err error
+		if pinned, err = r.PinnedBooks(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var deleted, kept int
+	var err error
+	for _, pattern := range bookCachePatterns {
+		err = r.scanKeys(pattern, func(key string) error {
+			entry := func() *BookCacheInfo {
+				var info BookCacheInfo
+				data, err := r.client.Get(r.ctx, key).Bytes()
+				if err != nil || json.Unmarshal(data, &info) != nil {
+					return nil
+				}
+				return &info
+			}
+			if pinnedCacheKey(key, pinned, entry) {
+				kept++
+				return nil
+			}
+
+			// One key per DEL so cluster mode never sees a cross-slot command
+			n, err := r.client.Del(r.ctx, key).Result()
+			deleted += int(n)
+			return err
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	log.Printf("[Cache] Flushed %d book cache keys (%d pinned kept)", deleted, kept)
+	return deleted, kept, err
+}
+
+// scanKeys calls fn for every key matching pattern using SCAN. In cluster mode
+// every master is scanned; fn is never called concurrently.
+func (r *RedisClient) scanKeys(pattern string, fn func(key string) error) error {
+	var mu sync.Mutex
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, pattern, 500).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			err := fn(iter.Val())
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(r.ctx, func(ctx context.Context, node *redis.Client) error {
+			return scan(ctx, node)
+		})
+	}
+	return scan(r.ctx, r.client)
 }
 
-// BookExists checks if a book exists in cache
-func (r *RedisClient) BookExists(bookID string) (bool, error) {
-	key := fmt.Sprintf("book:%s", bookID)
-	exists, err := r.client.Exists(r.ctx, key).Result()
+// BookExists checks if a book exists in cache in the given format
+func (r *RedisClient) BookExists(bookID, format string) (bool, error) {
+	info, err := r.GetBookInfo(bookID, format)
 	if err != nil {
 		return false, err
 	}
-	return exists > 0, nil
+	return info != nil, nil
 }
 
 // Close closes the Redis connection
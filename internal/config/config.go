@@ -1,54 +1,307 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
-// Config holds application configuration
+// Config holds application configuration. The server reloads it on SIGHUP,
+// but only a few settings take effect without a restart (see applyReloadable
+// in cmd/server/reload.go).
 type Config struct {
 	// Server
-	Port string
+	Port                     string `json:"port"`
+	MaxQueueDepth            int    `json:"max_queue_depth"`           // Max downloads waiting for a slot before returning 429 (0 = unlimited)
+	MaxDownloadsPerProfile   int    `json:"max_downloads_per_profile"` // Max concurrent downloads per cookie profile (0 = unlimited)
+	PreviewConcurrency       int    `json:"preview_concurrency"`       // Max concurrent book info/preview fetches
+	PreviewCacheMinutes      int    `json:"preview_cache_minutes"`     // Reuse a fetched preview for this long
+	PreviewChapters          int    `json:"preview_chapters"`          // Chapters in a preview download (0 = preview downloads disabled)
+	PreviewOnly              bool   `json:"preview_only"`              // Every download without the admin token is a preview (public demo)
+	UploadConcurrency        int    `json:"upload_concurrency"`        // Max concurrent MinIO uploads
+	PrefetchConcurrency      int    `json:"prefetch_concurrency"`      // Max concurrent prefetch downloads (they only use idle download slots)
+	Compression              bool   `json:"compression"`               // Gzip JSON and static responses (never the SSE stream)
+	TLSCertFile              string `json:"tls_cert_file"`             // Serve HTTPS (with HTTP/2) when cert and key are set
+	TLSKeyFile               string `json:"tls_key_file"`
+	H2C                      bool   `json:"h2c"`                          // Accept cleartext HTTP/2 (e.g. behind a proxy that speaks h2c)
+	AdminToken               string `json:"admin_token"`                  // Bearer token for the admin endpoints (empty = disabled)
+	MaxSSEConnections        int    `json:"max_sse_connections"`          // Max open SSE progress streams (0 = unlimited)
+	MaxSSEClientsPerDownload int    `json:"max_sse_clients_per_download"` // Max SSE streams on one download (0 = unlimited)
+	StaticDir                string `json:"static_dir"`                   // Serve the frontend from this directory instead of the embedded copy
+	AccessLog                bool   `json:"access_log"`                   // Log method, path, status, size and latency of every request
+	LogOutput                string `json:"log_output"`                   // stderr, stdout, syslog or a file path
+	LogMaxSizeMB             int    `json:"log_max_size_mb"`              // Rotate the log file once it reaches this size
+	LogMaxBackups            int    `json:"log_max_backups"`              // Rotated log files to keep (name.1 is the newest)
+	WaitForDeps              bool   `json:"wait_for_deps"`                // Keep retrying Redis and MinIO at startup instead of running without them
+	WaitForDepsSeconds       int    `json:"wait_for_deps_seconds"`        // How long to keep retrying before giving up
+
+	// O'Reilly
+	CookiesPath              string `json:"cookies_path"`                // Primary cookies file, fallback locations are still searched
+	CookiesDir               string `json:"cookies_dir"`                 // Directory of per-account cookie files to rotate among (overrides CookiesPath)
+	AccountMaxFailures       int    `json:"account_max_failures"`        // Consecutive login failures before a cookie account is marked unhealthy
+	AccountCooldownMinutes   int    `json:"account_cooldown_minutes"`    // How long an unhealthy account rests before it is probed again
+	SessionRevalidateMinutes int    `json:"session_revalidate_minutes"`  // Reuse an authenticated session this long before re-checking login (0 = always check)
+	LoginCheckTimeoutSeconds int    `json:"login_check_timeout_seconds"` // Timeout of each login check request
+	LoginCheckRetries        int    `json:"login_check_retries"`         // Retries of a login check that couldn't reach O'Reilly
+	DownloadRateLimitKB      int    `json:"download_rate_limit_kb"`      // Per-download bandwidth cap in KB/s (0 = unlimited)
+	TmpDir                   string `json:"tmp_dir"`                     // Base directory for work files (a goreilly/ subdirectory is used)
+	TmpCleanupMinutes        int    `json:"tmp_cleanup_minutes"`         // Leftover work files older than this are removed at startup
+	TmpMaxMB                 int    `json:"tmp_max_mb"`                  // Cap on temp space reserved by running jobs; new jobs wait for room (0 = unlimited)
+	TmpJobReserveMB          int    `json:"tmp_job_reserve_mb"`          // Temp space reserved per running job until its book size is estimated
+	JobTimeoutMinutes        int    `json:"job_timeout_minutes"`         // Cancel a job running longer than this (0 = no limit)
+	BookPolicyFile           string `json:"book_policy_file"`            // JSON allow/deny lists of book IDs and subjects ("" = allow all)
 
 	// Redis
-	RedisHost     string
-	RedisPort     string
-	RedisPassword string
+	RedisHost          string `json:"redis_host"`
+	RedisPort          string `json:"redis_port"`
+	RedisPassword      string `json:"redis_password"`
+	RedisDB            int    `json:"redis_db"`
+	RedisTLS           bool   `json:"redis_tls"`
+	RedisTLSServerName string `json:"redis_tls_server_name"` // Name the TLS certificate is checked against (default: each node's address)
+	RedisURL           string `json:"redis_url"`             // redis:// or rediss:// URL, overrides host/port/password/db/tls
+
+	// Redis high availability
+	RedisMode             string   `json:"redis_mode"`  // standalone, sentinel or cluster
+	RedisAddrs            []string `json:"redis_addrs"` // Sentinel addresses or cluster seed nodes
+	RedisMasterName       string   `json:"redis_master_name"`
+	RedisSentinelPassword string   `json:"redis_sentinel_password"`
+
+	// Storage
+	StorageBackend string `json:"storage_backend"` // Object storage used for finished files (minio)
 
 	// MinIO
-	MinIOEndpoint      string
-	MinIOAccessKey     string
-	MinIOSecretKey     string
-	MinIOBucket        string
-	MinIOUseSSL        bool
-	MinIORegion        string
-	PresignedURLExpiry int // Expiry time in hours for presigned URLs
+	MinIOEndpoint      string   `json:"minio_endpoint"`
+	MinIOAccessKey     string   `json:"minio_access_key"`
+	MinIOSecretKey     string   `json:"minio_secret_key"`
+	MinIOBucket        string   `json:"minio_bucket"`
+	MinIOBuckets       []string `json:"minio_allowed_buckets"` // Other buckets a download may choose with "bucket"
+	MinIOUseSSL        bool     `json:"minio_use_ssl"`
+	MinIORegion        string   `json:"minio_region"`
+	MinIOObjectMeta    bool     `json:"minio_object_metadata"`      // Store book title/authors/ISBN as object metadata
+	PresignedURLExpiry int      `json:"presigned_url_expiry_hours"` // Expiry time in hours for presigned URLs
+
+	// Calibre
+	CalibreFlowSize int    `json:"calibre_flow_size"` // Split XHTML files above this size in KB (0 = Calibre default)
+	OutputProfile   string `json:"output_profile"`    // Default Calibre --output-profile (e.g. kindle, kobo; empty = Calibre default)
+	DefaultFormat   string `json:"default_format"`    // Output format of requests that don't name one
+
+	// EPUB generation
+	EPUBVersion             int               `json:"epub_version"`               // 2 or 3
+	EPUBCompression         int               `json:"epub_compression"`           // Deflate level of the EPUB zip (0 = store ... 9 = best)
+	PackageConcurrency      int               `json:"package_concurrency"`        // Files read and compressed at once while packaging (1 = sequential)
+	IncludePageBreaks       bool              `json:"include_page_breaks"`        // Keep print page markers and emit an EPUB3 page-list
+	PrefetchTOC             bool              `json:"prefetch_toc"`               // Fetch the TOC while chapters download
+	ChapterPageConcurrency  int               `json:"chapter_page_concurrency"`   // Chapter list pages fetched at once (1 = sequential)
+	VerifyEPUB              bool              `json:"verify_epub"`                // Check the manifest/spine of every generated EPUB
+	CalibreRepairOnly       bool              `json:"calibre_repair_only"`        // Upload EPUBs that verify without Calibre (Calibre only repairs the rest)
+	MaxFailedChapters       int               `json:"max_failed_chapters"`        // Chapters that may fail without failing the book (0 = none)
+	MaxFailedChapterPercent float64           `json:"max_failed_chapter_percent"` // Or this share of the chapters (0-100)
+	NormalizeMetadata       bool              `json:"normalize_metadata"`         // Decode entities in rights and write issued as an ISO date
+	SourceLink              bool              `json:"source_link"`                // Add a "View on O'Reilly" link to the cover page
+	TrimEmptyChapters       bool              `json:"trim_empty_chapters"`        // Leave out placeholder chapters without text or images
+	OptimizeImages          bool              `json:"optimize_images"`            // Losslessly recompress PNGs and strip JPEG metadata (resolution is kept)
+	MinEPUBKBPerChapter     int               `json:"min_epub_kb_per_chapter"`    // Warn about an EPUB smaller than this per chapter (0 = no check)
+	StrictEPUBSize          bool              `json:"strict_epub_size"`           // Fail such downloads instead of warning
+	PaywallMarkers          []string          `json:"paywall_markers"`            // Text of O'Reilly's teaser pages; a chapter containing one fails the download
+	FreshnessCheck          bool              `json:"freshness_check"`            // Compare a cache hit with the book's current version on O'Reilly
+	ContentSelector         string            `json:"content_selector"`           // CSS selector of a chapter's content container
+	ContentSelectors        map[string]string `json:"content_selectors"`          // Per-book overrides of ContentSelector (book ID -> selector)
+
+	// Metadata enrichment
+	MetadataProvider  string `json:"metadata_provider"` // Fill missing description/subjects/cover: openlibrary or googlebooks ("" = off)
+	GoogleBooksAPIKey string `json:"google_books_api_key"`
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from defaults, then the optional JSON file
+// named by CONFIG_FILE, then environment variables (which override the file)
 func LoadConfig() (*Config, error) {
 	// Load .env file if it exists
 	godotenv.Load()
 
 	config := &Config{
-		Port:               getEnv("PORT", "3000"),
-		RedisHost:          getEnv("REDIS_HOST", "localhost"),
-		RedisPort:          getEnv("REDIS_PORT", "6379"),
-		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
-		MinIOEndpoint:      getEnv("MINIO_ENDPOINT", "localhost:9000"),
-		MinIOAccessKey:     getEnv("MINIO_ACCESS_KEY", ""),
-		MinIOSecretKey:     getEnv("MINIO_SECRET_KEY", ""),
-		MinIOBucket:        getEnv("MINIO_BUCKET", "gorielly"),
-		MinIOUseSSL:        getEnvBool("MINIO_USE_SSL", false),
-		MinIORegion:        getEnv("MINIO_REGION", "us-east-1"),
-		PresignedURLExpiry: getEnvInt("PRESIGNED_URL_EXPIRY_HOURS", 1), // Default 1 hour (URLs generated fresh on-demand)
+		Port:                     "3000",
+		MaxQueueDepth:            50,
+		MaxDownloadsPerProfile:   0,
+		PreviewConcurrency:       4,
+		PreviewCacheMinutes:      5,
+		PrefetchConcurrency:      1,
+		UploadConcurrency:        2,
+		Compression:              true,
+		AccessLog:                true,
+		LogOutput:                "stderr",
+		LogMaxSizeMB:             100,
+		LogMaxBackups:            5,
+		WaitForDepsSeconds:       60,
+		MaxSSEConnections:        500,
+		MaxSSEClientsPerDownload: 10,
+		CookiesPath:              "cookies.json",
+		SessionRevalidateMinutes: 10,
+		AccountMaxFailures:       3,
+		AccountCooldownMinutes:   15,
+		LoginCheckTimeoutSeconds: 10,
+		LoginCheckRetries:        2,
+		DownloadRateLimitKB:      0,
+		TmpDir:                   "/tmp",
+		TmpCleanupMinutes:        60,
+		TmpJobReserveMB:          300,
+		JobTimeoutMinutes:        60,
+		BookPolicyFile:           "",
+		RedisHost:                "localhost",
+		RedisPort:                "6379",
+		RedisPassword:            "",
+		RedisDB:                  0,
+		RedisTLS:                 false,
+		RedisURL:                 "",
+		RedisMode:                "standalone",
+		RedisMasterName:          "",
+		RedisSentinelPassword:    "",
+		StorageBackend:           StorageMinIO,
+		MinIOEndpoint:            "localhost:9000",
+		MinIOAccessKey:           "",
+		MinIOSecretKey:           "",
+		MinIOBucket:              "gorielly",
+		MinIOUseSSL:              false,
+		MinIORegion:              "us-east-1",
+		MinIOObjectMeta:          true,
+		PresignedURLExpiry:       1, // Default 1 hour (URLs generated fresh on-demand)
+		CalibreFlowSize:          0,
+		DefaultFormat:            "epub",
+		EPUBVersion:              2,
+		EPUBCompression:          6,
+		PackageConcurrency:       4,
+		NormalizeMetadata:        true,
+		IncludePageBreaks:        false,
+		PrefetchTOC:              true,
+		ChapterPageConcurrency:   4,
+		ContentSelector:          "#sbo-rt-content",
+		MinEPUBKBPerChapter:      1,
+		PaywallMarkers:           []string{"subscribe to read", "start your free trial", "sign up for a free trial", "get full access to"},
+		VerifyEPUB:               false,
+		CalibreRepairOnly:        false,
+	}
+
+	// Optional config file; keys are the snake_case names in the json tags
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadConfigFile(path, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Environment variables override the file
+	config.Port = getEnv("PORT", config.Port)
+	config.MaxQueueDepth = getEnvInt("MAX_QUEUE_DEPTH", config.MaxQueueDepth)
+	config.MaxDownloadsPerProfile = getEnvInt("MAX_DOWNLOADS_PER_PROFILE", config.MaxDownloadsPerProfile)
+	config.PreviewConcurrency = getEnvInt("PREVIEW_CONCURRENCY", config.PreviewConcurrency)
+	config.PreviewCacheMinutes = getEnvInt("PREVIEW_CACHE_MINUTES", config.PreviewCacheMinutes)
+	config.PreviewChapters = getEnvInt("PREVIEW_CHAPTERS", config.PreviewChapters)
+	config.PreviewOnly = getEnvBool("PREVIEW_ONLY", config.PreviewOnly)
+	config.UploadConcurrency = getEnvInt("UPLOAD_CONCURRENCY", config.UploadConcurrency)
+	config.PrefetchConcurrency = getEnvInt("PREFETCH_CONCURRENCY", config.PrefetchConcurrency)
+	config.Compression = getEnvBool("COMPRESSION", config.Compression)
+	config.TLSCertFile = getEnv("TLS_CERT_FILE", config.TLSCertFile)
+	config.TLSKeyFile = getEnv("TLS_KEY_FILE", config.TLSKeyFile)
+	config.H2C = getEnvBool("H2C", config.H2C)
+	config.AdminToken = getEnv("ADMIN_TOKEN", config.AdminToken)
+	config.MaxSSEConnections = getEnvInt("MAX_SSE_CONNECTIONS", config.MaxSSEConnections)
+	config.MaxSSEClientsPerDownload = getEnvInt("MAX_SSE_CLIENTS_PER_DOWNLOAD", config.MaxSSEClientsPerDownload)
+	config.StaticDir = getEnv("STATIC_DIR", config.StaticDir)
+	config.AccessLog = getEnvBool("ACCESS_LOG", config.AccessLog)
+	config.LogOutput = getEnv("LOG_OUTPUT", config.LogOutput)
+	config.LogMaxSizeMB = getEnvInt("LOG_MAX_SIZE_MB", config.LogMaxSizeMB)
+	config.LogMaxBackups = getEnvInt("LOG_MAX_BACKUPS", config.LogMaxBackups)
+	config.WaitForDeps = getEnvBool("WAIT_FOR_DEPS", config.WaitForDeps)
+	config.WaitForDepsSeconds = getEnvInt("WAIT_FOR_DEPS_SECONDS", config.WaitForDepsSeconds)
+	config.CookiesPath = getEnv("COOKIES_PATH", config.CookiesPath)
+	config.CookiesDir = getEnv("COOKIES_DIR", config.CookiesDir)
+	config.AccountMaxFailures = getEnvInt("ACCOUNT_MAX_FAILURES", config.AccountMaxFailures)
+	config.AccountCooldownMinutes = getEnvInt("ACCOUNT_COOLDOWN_MINUTES", config.AccountCooldownMinutes)
+	config.SessionRevalidateMinutes = getEnvInt("SESSION_REVALIDATE_MINUTES", config.SessionRevalidateMinutes)
+	config.LoginCheckTimeoutSeconds = getEnvInt("LOGIN_CHECK_TIMEOUT_SECONDS", config.LoginCheckTimeoutSeconds)
+	config.LoginCheckRetries = getEnvInt("LOGIN_CHECK_RETRIES", config.LoginCheckRetries)
+	config.DownloadRateLimitKB = getEnvInt("DOWNLOAD_RATE_LIMIT_KB", config.DownloadRateLimitKB)
+	config.TmpDir = getEnv("TMP_DIR", config.TmpDir)
+	config.TmpCleanupMinutes = getEnvInt("TMP_CLEANUP_MINUTES", config.TmpCleanupMinutes)
+	config.TmpMaxMB = getEnvInt("TMP_MAX_MB", config.TmpMaxMB)
+	config.TmpJobReserveMB = getEnvInt("TMP_JOB_RESERVE_MB", config.TmpJobReserveMB)
+	config.JobTimeoutMinutes = getEnvInt("JOB_TIMEOUT_MINUTES", config.JobTimeoutMinutes)
+	config.BookPolicyFile = getEnv("BOOK_POLICY_FILE", config.BookPolicyFile)
+	config.RedisHost = getEnv("REDIS_HOST", config.RedisHost)
+	config.RedisPort = getEnv("REDIS_PORT", config.RedisPort)
+	config.RedisPassword = getEnv("REDIS_PASSWORD", config.RedisPassword)
+	config.RedisDB = getEnvInt("REDIS_DB", config.RedisDB)
+	config.RedisTLS = getEnvBool("REDIS_TLS", config.RedisTLS)
+	config.RedisTLSServerName = getEnv("REDIS_TLS_SERVER_NAME", config.RedisTLSServerName)
+	config.RedisURL = getEnv("REDIS_URL", config.RedisURL)
+	config.RedisMode = getEnv("REDIS_MODE", config.RedisMode)
+	config.RedisAddrs = getEnvList("REDIS_ADDRS", config.RedisAddrs)
+	config.RedisMasterName = getEnv("REDIS_MASTER_NAME", config.RedisMasterName)
+	config.RedisSentinelPassword = getEnv("REDIS_SENTINEL_PASSWORD", config.RedisSentinelPassword)
+	config.StorageBackend = strings.ToLower(getEnv("STORAGE_BACKEND", config.StorageBackend))
+	config.MinIOEndpoint = getEnv("MINIO_ENDPOINT", config.MinIOEndpoint)
+	config.MinIOAccessKey = getEnv("MINIO_ACCESS_KEY", config.MinIOAccessKey)
+	config.MinIOSecretKey = getEnv("MINIO_SECRET_KEY", config.MinIOSecretKey)
+	config.MinIOBucket = getEnv("MINIO_BUCKET", config.MinIOBucket)
+	config.MinIOBuckets = getEnvList("MINIO_ALLOWED_BUCKETS", config.MinIOBuckets)
+	config.MinIOUseSSL = getEnvBool("MINIO_USE_SSL", config.MinIOUseSSL)
+	config.MinIORegion = getEnv("MINIO_REGION", config.MinIORegion)
+	config.MinIOObjectMeta = getEnvBool("MINIO_OBJECT_METADATA", config.MinIOObjectMeta)
+	config.PresignedURLExpiry = getEnvInt("PRESIGNED_URL_EXPIRY_HOURS", config.PresignedURLExpiry)
+	config.CalibreFlowSize = getEnvInt("CALIBRE_FLOW_SIZE", config.CalibreFlowSize)
+	config.OutputProfile = strings.ToLower(getEnv("OUTPUT_PROFILE", config.OutputProfile))
+	config.DefaultFormat = strings.ToLower(getEnv("DEFAULT_FORMAT", config.DefaultFormat))
+	config.EPUBVersion = getEnvInt("EPUB_VERSION", config.EPUBVersion)
+	config.EPUBCompression = getEnvInt("EPUB_COMPRESSION", config.EPUBCompression)
+	config.PackageConcurrency = getEnvInt("PACKAGE_CONCURRENCY", config.PackageConcurrency)
+	config.IncludePageBreaks = getEnvBool("INCLUDE_PAGE_BREAKS", config.IncludePageBreaks)
+	config.PrefetchTOC = getEnvBool("PREFETCH_TOC", config.PrefetchTOC)
+	config.ChapterPageConcurrency = getEnvInt("CHAPTER_PAGE_CONCURRENCY", config.ChapterPageConcurrency)
+	config.VerifyEPUB = getEnvBool("VERIFY_EPUB", config.VerifyEPUB)
+	config.CalibreRepairOnly = getEnvBool("CALIBRE_REPAIR_ONLY", config.CalibreRepairOnly)
+	config.MaxFailedChapters = getEnvInt("MAX_FAILED_CHAPTERS", config.MaxFailedChapters)
+	config.MaxFailedChapterPercent = getEnvFloat("MAX_FAILED_CHAPTER_PERCENT", config.MaxFailedChapterPercent)
+	config.TrimEmptyChapters = getEnvBool("TRIM_EMPTY_CHAPTERS", config.TrimEmptyChapters)
+	config.OptimizeImages = getEnvBool("OPTIMIZE_IMAGES", config.OptimizeImages)
+	config.NormalizeMetadata = getEnvBool("NORMALIZE_METADATA", config.NormalizeMetadata)
+	config.SourceLink = getEnvBool("SOURCE_LINK", config.SourceLink)
+	config.MinEPUBKBPerChapter = getEnvInt("MIN_EPUB_KB_PER_CHAPTER", config.MinEPUBKBPerChapter)
+	config.StrictEPUBSize = getEnvBool("STRICT_EPUB_SIZE", config.StrictEPUBSize)
+	config.PaywallMarkers = getEnvList("PAYWALL_MARKERS", config.PaywallMarkers)
+	config.FreshnessCheck = getEnvBool("FRESHNESS_CHECK", config.FreshnessCheck)
+	config.ContentSelector = getEnv("CONTENT_SELECTOR", config.ContentSelector)
+	config.ContentSelectors = getEnvMap("CONTENT_SELECTORS", config.ContentSelectors)
+	config.MetadataProvider = strings.ToLower(getEnv("METADATA_PROVIDER", config.MetadataProvider))
+	config.GoogleBooksAPIKey = getEnv("GOOGLE_BOOKS_API_KEY", config.GoogleBooksAPIKey)
+
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
+// loadConfigFile decodes a JSON config file over config, rejecting unknown keys
+func loadConfigFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	log.Printf("[Config] Loaded %s", path)
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -73,3 +326,41 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return defaultValue
+	}
+	return list
+}
+
+// getEnvMap reads a JSON object of strings, e.g. {"9781492056348": ".content"}.
+// An invalid value is logged and ignored.
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		log.Printf("[Config] WARNING: Ignoring %s, it is not a JSON object of strings: %v", key, err)
+		return defaultValue
+	}
+	return m
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// StorageMinIO is the only storage backend at the moment
+const StorageMinIO = "minio"
+
+// bucketName matches valid S3 bucket names
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Validate checks the settings required by the selected backends so that a
+// misconfiguration fails at startup instead of on the first download
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		add("PORT must be a number between 1 and 65535 (got %q)", c.Port)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if c.StaticDir != "" {
+		if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+			add("STATIC_DIR %q is not a readable directory", c.StaticDir)
+		}
+	}
+
+	if c.LogOutput == "" {
+		add("LOG_OUTPUT must be stderr, stdout, syslog or a file path")
+	}
+	if c.LogMaxSizeMB < 1 {
+		add("LOG_MAX_SIZE_MB must be at least 1 (got %d)", c.LogMaxSizeMB)
+	}
+	if c.LogMaxBackups < 0 {
+		add("LOG_MAX_BACKUPS must not be negative (got %d)", c.LogMaxBackups)
+	}
+	if c.WaitForDeps && c.WaitForDepsSeconds < 1 {
+		add("WAIT_FOR_DEPS_SECONDS must be at least 1 (got %d)", c.WaitForDepsSeconds)
+	}
+
+	if c.CookiesDir != "" {
+		if info, err := os.Stat(c.CookiesDir); err != nil || !info.IsDir() {
+			add("COOKIES_DIR %q is not a readable directory", c.CookiesDir)
+		}
+	}
+	if c.PreviewChapters < 0 {
+		add("PREVIEW_CHAPTERS must not be negative (got %d)", c.PreviewChapters)
+	}
+	if c.PreviewOnly && c.PreviewChapters <= 0 {
+		add("PREVIEW_ONLY requires PREVIEW_CHAPTERS to be set")
+	}
+
+	if c.TmpMaxMB < 0 {
+		add("TMP_MAX_MB must not be negative (got %d)", c.TmpMaxMB)
+	}
+	if c.TmpJobReserveMB < 1 {
+		add("TMP_JOB_RESERVE_MB must be at least 1 (got %d)", c.TmpJobReserveMB)
+	}
+	if c.JobTimeoutMinutes < 0 {
+		add("JOB_TIMEOUT_MINUTES must not be negative (got %d)", c.JobTimeoutMinutes)
+	}
+	if c.AccountMaxFailures < 1 {
+		add("ACCOUNT_MAX_FAILURES must be at least 1 (got %d)", c.AccountMaxFailures)
+	}
+	if c.AccountCooldownMinutes < 1 {
+		add("ACCOUNT_COOLDOWN_MINUTES must be at least 1 (got %d)", c.AccountCooldownMinutes)
+	}
+	if c.LoginCheckTimeoutSeconds < 1 {
+		add("LOGIN_CHECK_TIMEOUT_SECONDS must be at least 1 (got %d)", c.LoginCheckTimeoutSeconds)
+	}
+	if c.LoginCheckRetries < 0 {
+		add("LOGIN_CHECK_RETRIES must not be negative (got %d)", c.LoginCheckRetries)
+	}
+
+	switch c.StorageBackend {
+	case StorageMinIO:
+		if c.MinIOEndpoint == "" {
+			add("MINIO_ENDPOINT is required when STORAGE_BACKEND=minio")
+		}
+		if c.MinIOBucket == "" {
+			add("MINIO_BUCKET is required when STORAGE_BACKEND=minio")
+		}
+		for _, bucket := range c.MinIOBuckets {
+			if !bucketName.MatchString(bucket) {
+				add("MINIO_ALLOWED_BUCKETS contains an invalid bucket name %q", bucket)
+			}
+		}
+		// Without MINIO_ENDPOINT the server may run with no MinIO at all (uploads
+		// fail and are reported), so credentials are only needed once it is set
+		if os.Getenv("MINIO_ENDPOINT") != "" && (c.MinIOAccessKey == "" || c.MinIOSecretKey == "") {
+			add("MINIO_ACCESS_KEY and MINIO_SECRET_KEY are required when MINIO_ENDPOINT is set")
+		}
+		if c.PresignedURLExpiry < 1 || c.PresignedURLExpiry > 168 {
+			add("PRESIGNED_URL_EXPIRY_HOURS must be between 1 and 168 (got %d)", c.PresignedURLExpiry)
+		}
+	default:
+		add("unsupported STORAGE_BACKEND %q (supported: %s)", c.StorageBackend, StorageMinIO)
+	}
+
+	switch c.RedisMode {
+	case "", "standalone":
+	case "sentinel":
+		if len(c.RedisAddrs) == 0 || c.RedisMasterName == "" {
+			add("REDIS_ADDRS and REDIS_MASTER_NAME are required when REDIS_MODE=sentinel")
+		}
+	case "cluster":
+		if len(c.RedisAddrs) == 0 {
+			add("REDIS_ADDRS is required when REDIS_MODE=cluster")
+		}
+	default:
+		add("REDIS_MODE must be standalone, sentinel or cluster (got %q)", c.RedisMode)
+	}
+
+	if c.EPUBVersion != 2 && c.EPUBVersion != 3 {
+		add("EPUB_VERSION must be 2 or 3 (got %d)", c.EPUBVersion)
+	}
+	if c.EPUBCompression < 0 || c.EPUBCompression > 9 {
+		add("EPUB_COMPRESSION must be between 0 (store) and 9 (best) (got %d)", c.EPUBCompression)
+	}
+	if c.PackageConcurrency < 1 {
+		add("PACKAGE_CONCURRENCY must be at least 1 (got %d)", c.PackageConcurrency)
+	}
+
+	if c.MaxFailedChapters < 0 {
+		add("MAX_FAILED_CHAPTERS must not be negative (got %d)", c.MaxFailedChapters)
+	}
+	if c.ChapterPageConcurrency < 1 {
+		add("CHAPTER_PAGE_CONCURRENCY must be at least 1 (got %d)", c.ChapterPageConcurrency)
+	}
+	if c.MinEPUBKBPerChapter < 0 {
+		add("MIN_EPUB_KB_PER_CHAPTER must not be negative (got %d)", c.MinEPUBKBPerChapter)
+	}
+	if c.MaxFailedChapterPercent < 0 || c.MaxFailedChapterPercent > 100 {
+		add("MAX_FAILED_CHAPTER_PERCENT must be between 0 and 100 (got %g)", c.MaxFailedChapterPercent)
+	}
+
+	if _, err := cascadia.Compile(c.ContentSelector); err != nil {
+		add("CONTENT_SELECTOR %q is not a valid CSS selector: %v", c.ContentSelector, err)
+	}
+	for bookID, selector := range c.ContentSelectors {
+		if _, err := cascadia.Compile(selector); err != nil {
+			add("CONTENT_SELECTORS[%s] %q is not a valid CSS selector: %v", bookID, selector, err)
+		}
+	}
+
+	switch c.MetadataProvider {
+	case "", "openlibrary", "googlebooks":
+	default:
+		add("METADATA_PROVIDER must be openlibrary, googlebooks or empty (got %q)", c.MetadataProvider)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+}
@@ -0,0 +1,29 @@
+// Package formats describes the output formats of a download. It is shared
+// by the handlers, which build and convert the files, and storage, which
+// uploads them with their content type.
+package formats
+
+import "strings"
+
+// Format describes an output format. Adding a format is one entry in All;
+// the handlers, uploads and info endpoints all read it from there.
+type Format struct {
+	Extension     string // File extension (without the dot)
+	ContentType   string // MIME type of the file
+	CalibreTarget string // ebook-convert output type ("" = never converted)
+	Native        bool   // Built without Calibre (Calibre only polishes it when installed)
+}
+
+// All lists every output format (cbz packages the book's images only)
+var All = map[string]Format{
+	"epub": {Extension: "epub", ContentType: "application/epub+zip", CalibreTarget: "epub", Native: true},
+	"cbz":  {Extension: "cbz", ContentType: "application/vnd.comicbook+zip", Native: true},
+	"mobi": {Extension: "mobi", ContentType: "application/x-mobipocket-ebook", CalibreTarget: "mobi"},
+	"azw3": {Extension: "azw3", ContentType: "application/vnd.amazon.ebook", CalibreTarget: "azw3"},
+	"pdf":  {Extension: "pdf", ContentType: "application/pdf", CalibreTarget: "pdf"},
+}
+
+// Name is how the format is reported to clients (e.g. "EPUB")
+func (f Format) Name() string {
+	return strings.ToUpper(f.Extension)
+}
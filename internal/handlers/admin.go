@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"goreilly/internal/oreilly"
+)
+
+// AdminToken protects the maintenance endpoints (empty = they are disabled, reloadable)
+var AdminToken Setting[string]
+
+// flushConfirmation must be passed as ?confirm= to flush the cache
+const flushConfirmation = "flush-everything"
+
+// requireAdmin checks the request's admin token ("Authorization: Bearer <token>"
+// or X-Admin-Token) and writes an error response if it is missing or wrong
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if AdminToken.Get() == "" {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Admin endpoints are disabled (ADMIN_TOKEN is not set)")
+		return false
+	}
+
+	if !hasAdminToken(r) {
+		log.Printf("[Admin] Rejected %s %s from %s: invalid admin token", r.Method, r.URL.Path, r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid or missing admin token")
+		return false
+	}
+	return true
+}
+
+// hasAdminToken reports whether the request carries the (configured) admin token
+func hasAdminToken(r *http.Request) bool {
+	adminToken := AdminToken.Get()
+	if adminToken == "" {
+		return false
+	}
+
+	token := r.Header.Get("X-Admin-Token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// FlushCacheHandler deletes every download cache entry from Redis and, with
+// ?purge_storage=true, every object in the MinIO bucket (?bucket= picks an
+// allowed bucket instead of MINIO_BUCKET). Entries of pinned
+// books are kept unless ?force=true. Requires the admin token and
+// ?confirm=flush-everything.
+func FlushCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("confirm") != flushConfirmation {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+			"Flushing the cache cannot be undone, pass confirm="+flushConfirmation+" to proceed")
+		return
+	}
+	purgeStorage := query.Get("purge_storage") == "true"
+	force := query.Get("force") == "true"
+	bucket, err := parseBucket(query.Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	if RedisClient == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Redis is not available")
+		return
+	}
+	if purgeStorage && MinIOClient == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeStorageUnavailable, "Storage service unavailable")
+		return
+	}
+
+	// Purging the bucket would delete the files of pinned books
+	if purgeStorage && !force {
+		pinned, err := RedisClient.PinnedBooks()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to list pinned books: "+err.Error())
+			return
+		}
+		if len(pinned) > 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+				"purge_storage would delete the files of pinned books, pass force=true to proceed")
+			return
+		}
+	}
+
+	log.Printf("[Admin] ===== CACHE FLUSH requested by %s (purge_storage=%t, force=%t) =====", r.RemoteAddr, purgeStorage, force)
+
+	response := map[string]interface{}{
+		"purge_storage": purgeStorage,
+		"force":         force,
+	}
+
+	keys, kept, err := RedisClient.FlushBooks(force)
+	response["cache_keys_deleted"] = keys
+	response["pinned_keys_kept"] = kept
+	if err != nil {
+		log.Printf("[Admin] ERROR: Cache flush stopped after %d keys: %v", keys, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Cache flush failed: "+err.Error())
+		return
+	}
+
+	if purgeStorage {
+		objects, err := storageFor(bucket).PurgeBucket()
+		response["objects_deleted"] = objects
+		if err != nil {
+			log.Printf("[Admin] ERROR: Bucket purge stopped after %d objects: %v", objects, err)
+			writeError(w, http.StatusInternalServerError, ErrCodeStorageUnavailable, "Bucket purge failed: "+err.Error())
+			return
+		}
+	}
+
+	log.Printf("[Admin] ===== CACHE FLUSH complete: %v =====", response)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AccountsHandler reports the health of the cookie accounts in COOKIES_DIR.
+// Requires the admin token.
+func AccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if oreilly.CookiesDir == "" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Cookie rotation is disabled (COOKIES_DIR is not set)")
+		return
+	}
+
+	statuses, err := oreilly.AccountStatuses()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	healthy := 0
+	for _, status := range statuses {
+		if status.Healthy {
+			healthy++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accounts":         statuses,
+		"healthy":          healthy,
+		"total":            len(statuses),
+		"max_failures":     oreilly.AccountMaxFailures,
+		"cooldown_minutes": int(oreilly.AccountCooldown.Minutes()),
+	})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"goreilly/internal/models"
+)
+
+// BookSummary is the basic book info returned when a download starts
+type BookSummary struct {
+	Title   string   `json:"title"`
+	Authors []string `json:"authors"`
+	Cover   string   `json:"cover,omitempty"`
+}
+
+// summarizeBook extracts the title, author names and cover of a book
+func summarizeBook(bookInfo *models.BookInfo) *BookSummary {
+	authors := make([]string, 0, len(bookInfo.Authors))
+	for _, author := range bookInfo.Authors {
+		authors = append(authors, author.Name)
+	}
+	return &BookSummary{Title: bookInfo.Title, Authors: authors, Cover: bookInfo.Cover}
+}
+
+// knownBookSummary returns the book's summary from a recent info lookup or the
+// Redis metadata cache, without asking O'Reilly (nil if it isn't known yet;
+// the download then reports it once it has fetched the book info)
+func knownBookSummary(bookID string) *BookSummary {
+	if cached := getCachedPreview(bookID); cached != nil {
+		return summarizeBook(cached)
+	}
+	if RedisClient == nil {
+		return nil
+	}
+	bookInfo, err := RedisClient.GetBookPreview(bookID)
+	if err != nil || bookInfo == nil {
+		return nil
+	}
+	return summarizeBook(bookInfo)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"goreilly/internal/cache"
+	"goreilly/internal/storage"
+)
+
+// AllowedBuckets are the buckets besides MINIO_BUCKET a download may choose
+// with "bucket" (empty = every download goes to MINIO_BUCKET)
+var AllowedBuckets []string
+
+// parseBucket validates a per-request bucket against AllowedBuckets. The
+// configured bucket is returned as "" so that default downloads and cache
+// entries look the same whether or not they named it.
+func parseBucket(bucket string) (string, error) {
+	bucket = strings.TrimSpace(bucket)
+	if bucket == "" || (MinIOClient != nil && bucket == MinIOClient.Bucket()) {
+		return "", nil
+	}
+	for _, allowed := range AllowedBuckets {
+		if bucket == allowed {
+			return bucket, nil
+		}
+	}
+	if len(AllowedBuckets) == 0 {
+		return "", fmt.Errorf("this server does not allow choosing a bucket")
+	}
+	return "", fmt.Errorf("bucket %q is not allowed (allowed: %s)", bucket, strings.Join(AllowedBuckets, ", "))
+}
+
+// storageFor returns the storage client of a bucket ("" = MINIO_BUCKET)
+func storageFor(bucket string) *storage.MinIOClient {
+	return MinIOClient.WithBucket(bucket)
+}
+
+// entryStorage returns the storage client of the bucket holding a cache entry's objects
+func entryStorage(info *cache.BookCacheInfo) *storage.MinIOClient {
+	return storageFor(info.Bucket)
+}
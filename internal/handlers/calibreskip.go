@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strings"
+
+	"goreilly/internal/models"
+	"goreilly/internal/oreilly"
+)
+
+// CalibreRepairOnly uploads the client EPUB as-is when it passes
+// oreilly.VerifyEPUB, keeping Calibre (and a conversion slot) for the books
+// that fail and need repairing. Other formats are always converted.
+var CalibreRepairOnly bool
+
+// skipCalibre reports whether an EPUB job can skip Calibre: the mode is on,
+// no output profile asks for Calibre's tuning and the client EPUB verifies.
+// verification is an earlier opt-in check of the same file (nil if none ran).
+func skipCalibre(download *models.Download, epubPath, format string, verification *models.EPUBVerification) bool {
+	if !CalibreRepairOnly || format != "epub" || download.Options.OutputProfile != "" {
+		return false
+	}
+
+	if verification == nil {
+		verification = oreilly.VerifyEPUB(epubPath)
+	}
+	if !verification.Valid {
+		download.Logf("[Conversion] Client EPUB failed verification, repairing with Calibre: %s", strings.Join(verification.Errors, "; "))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"goreilly/internal/oreilly"
+)
+
+// Error codes returned in the "code" field of API error responses.
+//
+//	INVALID_REQUEST         request body or parameters are malformed
+//	NOT_FOUND               no API endpoint matches the path
+//	BOOK_NOT_FOUND          the book ID does not exist on O'Reilly
+//	AUTH_FAILED             cookies are missing, invalid or expired
+//	SUBSCRIPTION_EXPIRED    the O'Reilly account subscription has expired
+//	NOT_IN_SUBSCRIPTION     the subscription doesn't include the book (paywalled chapters)
+//	RATE_LIMITED            the server is too busy, retry later
+//	TIMEOUT                 a request to O'Reilly or a conversion timed out
+//	DOWNLOAD_NOT_FOUND      the download ID is unknown or has been cleaned up
+//	DOWNLOAD_NOT_COMPLETED  the download has not finished yet
+//	DOWNLOAD_NOT_FAILED     only failed downloads can be retried
+//	STORAGE_UNAVAILABLE     MinIO is disabled or an upload failed
+//	STREAMING_UNSUPPORTED   the connection does not support SSE
+//	BOOK_NOT_ALLOWED        the book is excluded by the server's allow/deny lists
+//	EPUB_TOO_SMALL          the EPUB is far below its expected size (STRICT_EPUB_SIZE)
+//	UNAUTHORIZED            the admin token is missing or wrong
+//	FORBIDDEN               the endpoint is disabled on this server
+//	INTERNAL_ERROR          any other failure
+const (
+	ErrCodeInvalidRequest       = "INVALID_REQUEST"
+	ErrCodeNotFound             = "NOT_FOUND"
+	ErrCodeBookNotFound         = "BOOK_NOT_FOUND"
+	ErrCodeAuthFailed           = "AUTH_FAILED"
+	ErrCodeSubscriptionExpired  = "SUBSCRIPTION_EXPIRED"
+	ErrCodeNotInSubscription    = "NOT_IN_SUBSCRIPTION"
+	ErrCodeRateLimited          = "RATE_LIMITED"
+	ErrCodeTimeout              = "TIMEOUT"
+	ErrCodeDownloadNotFound     = "DOWNLOAD_NOT_FOUND"
+	ErrCodeDownloadNotCompleted = "DOWNLOAD_NOT_COMPLETED"
+	ErrCodeDownloadNotFailed    = "DOWNLOAD_NOT_FAILED"
+	ErrCodeStorageUnavailable   = "STORAGE_UNAVAILABLE"
+	ErrCodeStreamingUnsupported = "STREAMING_UNSUPPORTED"
+	ErrCodeBookNotAllowed       = "BOOK_NOT_ALLOWED"
+	ErrCodeEPUBTooSmall         = "EPUB_TOO_SMALL"
+	ErrCodeUnauthorized         = "UNAUTHORIZED"
+	ErrCodeForbidden            = "FORBIDDEN"
+	ErrCodeInternal             = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the JSON body of every API error
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error"` // Backwards compatibility (same as Message)
+}
+
+// writeError writes a structured JSON error response
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:    code,
+		Message: message,
+		Error:   message,
+	})
+}
+
+// classifyError maps an internal error to an error code and a user-facing message
+func classifyError(err error) (string, string) {
+	msg := err.Error()
+	lower := strings.ToLower(msg)
+
+	switch {
+	case errors.Is(err, oreilly.ErrEPUBTooSmall):
+		return ErrCodeEPUBTooSmall, msg
+	case errors.Is(err, oreilly.ErrPaywalled):
+		return ErrCodeNotInSubscription, "Your subscription doesn't include this title."
+	case strings.Contains(lower, "book not found") || strings.Contains(msg, "API error"):
+		return ErrCodeBookNotFound, "Book not found. Please check the Book ID and try again."
+	case strings.Contains(lower, "subscription expired"):
+		return ErrCodeSubscriptionExpired, "Your O'Reilly subscription has expired."
+	case strings.Contains(lower, "authentication failed") || strings.Contains(msg, "cookies.json"):
+		return ErrCodeAuthFailed, "Authentication failed. Please update your cookies.json file."
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "timed out"):
+		return ErrCodeTimeout, "Request timed out. Please try again."
+	}
+
+	return ErrCodeInternal, msg
+}
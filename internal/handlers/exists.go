@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"goreilly/internal/cache"
+	"goreilly/internal/oreilly"
+	"goreilly/internal/storage"
+)
+
+// BookExistsHandler reports whether a book is already stored in a format
+// (?format=, default DEFAULT_FORMAT) so clients can offer an instant
+// download. It only looks at Redis and MinIO, never at O'Reilly.
+func BookExistsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	bookID, err := oreilly.ParseBookID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	format, err := parseStoredFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	prefix, err := storage.ValidatePrefix(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	bucket, err := parseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"book_id": bookID,
+		"format":  format,
+		"cached":  false,
+	}
+
+	// The cache entry has everything, MinIO is the fallback for books cached before Redis was set up
+	inCache := false
+	if RedisClient != nil {
+		if cachedInfo, err := RedisClient.GetBookInfo(cache.BucketScopedID(bucket, prefix, bookID), format); err == nil && cachedInfo != nil && cachedInfo.EpubPath != "" {
+			inCache = true
+			response["cached"] = true
+			response["size"] = cachedInfo.EpubSize
+			response["uploaded_at"] = cachedInfo.UploadedAt
+			response["book_title"] = cachedInfo.BookTitle
+		}
+	}
+
+	if !inCache && MinIOClient != nil {
+		store := storageFor(bucket)
+		exists, objectName, size, err := store.FileExists(prefix, bookID, outputFormats[format].Extension)
+		if err != nil {
+			log.Printf("[Exists] ERROR: Failed to look up %s (%s): %v", bookID, format, err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeStorageUnavailable, "Failed to check storage")
+			return
+		}
+		if exists {
+			response["cached"] = true
+			response["size"] = size
+			if _, uploadedAt, err := store.StatFile(objectName); err == nil {
+				response["uploaded_at"] = uploadedAt
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
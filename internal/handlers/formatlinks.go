@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"log"
+	"time"
+)
+
+// FormatLink is a fresh presigned URL of one stored format of a book
+type FormatLink struct {
+	URL       string    `json:"url"`
+	FileSize  int64     `json:"file_size,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// cachedFormatLinks returns a presigned URL for every format of a book in the
+// cache (scopedID includes the prefix, see cache.ScopedID). Nil if there are
+// none or Redis or MinIO is unavailable.
+func cachedFormatLinks(scopedID string) map[string]FormatLink {
+	if RedisClient == nil || MinIOClient == nil {
+		return nil
+	}
+
+	files, err := RedisClient.GetBookFiles(scopedID)
+	if err != nil {
+		log.Printf("[Link] ERROR: Failed to look up cached formats of %s: %v", scopedID, err)
+		return nil
+	}
+
+	var links map[string]FormatLink
+	expiry := PresignedURLExpiry.Get()
+	expiresAt := time.Now().Add(expiry)
+	for format, info := range files {
+		url, err := entryStorage(info).GetPresignedURL(info.EpubPath, expiry)
+		if err != nil {
+			log.Printf("[Link] ERROR: Failed to generate URL for %s: %v", info.EpubPath, err)
+			continue
+		}
+		if links == nil {
+			links = make(map[string]FormatLink, len(files))
+		}
+		links[format] = FormatLink{URL: url, FileSize: info.EpubSize, ExpiresAt: expiresAt}
+	}
+	return links
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"goreilly/internal/cache"
+	"goreilly/internal/formats"
+	"goreilly/internal/oreilly"
+	"goreilly/internal/storage"
+)
+
+// OutputFormat describes an output format (see formats.Format)
+type OutputFormat = formats.Format
+
+// outputFormats lists every output format; the table lives in the formats
+// package so storage derives its content types from it too
+var outputFormats = formats.All
+
+// DefaultFormat is the output format of requests that don't name one
+var DefaultFormat = "epub"
+
+// SetDefaultFormat validates and sets DefaultFormat (call after DetectCalibre)
+func SetDefaultFormat(format string) error {
+	format = normalizeFormat(format)
+	spec, known := outputFormats[format]
+	if !known {
+		return fmt.Errorf("unknown format %q (known: %s)", format, strings.Join(knownFormats(), ", "))
+	}
+	if !spec.Native && !calibreAvailable {
+		return fmt.Errorf("format %q requires Calibre, which is not installed on this server", format)
+	}
+	DefaultFormat = format
+	return nil
+}
+
+// calibreAvailable is set once at startup by DetectCalibre
+var calibreAvailable bool
+
+// DetectCalibre probes for the ebook-convert binary and caches the result
+func DetectCalibre() bool {
+	path, err := exec.LookPath("ebook-convert")
+	if err != nil {
+		log.Printf("[Calibre] ebook-convert not found - only EPUB and CBZ output are available")
+		calibreAvailable = false
+		return false
+	}
+
+	log.Printf("[Calibre] Found ebook-convert: %s", path)
+	calibreAvailable = true
+	return true
+}
+
+// supportedFormats returns the output formats this server can produce, the
+// default first
+func supportedFormats() []string {
+	var formats []string
+	for _, format := range knownFormats() {
+		if outputFormats[format].Native || calibreAvailable {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// knownFormats returns every output format, the default first and the rest in
+// alphabetical order
+func knownFormats() []string {
+	formats := make([]string, 0, len(outputFormats))
+	for format := range outputFormats {
+		if format != DefaultFormat {
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+	return append([]string{DefaultFormat}, formats...)
+}
+
+// parseFormat validates a requested output format (empty means DefaultFormat)
+func parseFormat(format string) (string, error) {
+	format = normalizeFormat(format)
+	for _, supported := range supportedFormats() {
+		if format == supported {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported format %q (available: %s)", format, strings.Join(supportedFormats(), ", "))
+}
+
+// parseStoredFormat validates the format of an already stored file, which may
+// have been produced by a host that had Calibre
+func parseStoredFormat(format string) (string, error) {
+	format = normalizeFormat(format)
+	if _, known := outputFormats[format]; !known {
+		return "", fmt.Errorf("unknown format %q (known: %s)", format, strings.Join(knownFormats(), ", "))
+	}
+	return format, nil
+}
+
+// normalizeFormat lowercases a format name and strips a leading dot (empty means DefaultFormat)
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	if format == "" {
+		return DefaultFormat
+	}
+	return format
+}
+
+// GetBookFormatsHandler lists the output formats available for a book
+func GetBookFormatsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bookID, err := oreilly.ParseBookID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	prefix, err := storage.ValidatePrefix(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	bucket, err := parseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"book_id":           bookID,
+		"formats":           supportedFormats(),
+		"default_format":    DefaultFormat,
+		"calibre_available": calibreAvailable,
+	}
+
+	// Formats already produced for this book are served straight from storage
+	if RedisClient != nil {
+		if cached, err := RedisClient.GetBookFormats(cache.BucketScopedID(bucket, prefix, bookID)); err == nil {
+			response["cached_formats"] = cached
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"log"
+
+	"goreilly/internal/cache"
+	"goreilly/internal/oreilly"
+)
+
+// FreshnessCheck compares a cache hit's fingerprint with the book's current
+// info before serving it (one O'Reilly call, none while the info is in the
+// preview cache). A book updated on O'Reilly is downloaded again.
+var FreshnessCheck bool
+
+// cachedCopyStale reports whether O'Reilly has updated a book since its cached
+// copy was built. Entries without a fingerprint and failed probes count as
+// fresh, so an outage never blocks cached downloads.
+func cachedCopyStale(bookID string, cachedInfo *cache.BookCacheInfo) bool {
+	if !FreshnessCheck || cachedInfo.Fingerprint == "" {
+		return false
+	}
+
+	current := getCachedPreview(bookID)
+	if current == nil {
+		client, err := oreilly.NewClient(bookID, CookiesPath, nil)
+		if err != nil {
+			log.Printf("[Cache] WARNING: Freshness check of %s skipped: %v", bookID, err)
+			return false
+		}
+		if err := client.GetBookInfo(); err != nil {
+			log.Printf("[Cache] WARNING: Freshness check of %s skipped: %v", bookID, err)
+			return false
+		}
+		current = client.GetBookInfoData()
+		storeBookPreview(bookID, current)
+		setCachedPreview(bookID, current)
+	}
+
+	fingerprint := oreilly.Fingerprint(current)
+	if fingerprint == cachedInfo.Fingerprint {
+		return false
+	}
+	log.Printf("[Cache] %s changed on O'Reilly (fingerprint %s -> %s), downloading it again",
+		bookID, cachedInfo.Fingerprint, fingerprint)
+	return true
+}
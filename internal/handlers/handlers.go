@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,11 +31,11 @@ import (
 )
 
 var (
-	downloads     = make(map[string]*models.Download)
-	downloadsLock sync.RWMutex
+	// Downloads known to this instance
+	downloads = NewDownloadRegistry()
 	
-	// Semaphore to limit concurrent downloads (max 3 simultaneous)
-	downloadSemaphore = make(chan struct{}, 3)
+	// Download slots (max 3 simultaneous), handed out by priority
+	downloadSlots = newSlotQueue(3)
 	
 	// Worker pool for conversions (max 2 simultaneous conversions)
 	conversionSemaphore = make(chan struct{}, 2)
@@ -35,251 +44,692 @@ var (
 	RedisClient *cache.RedisClient
 	MinIOClient *storage.MinIOClient
 	
-	// Presigned URL expiry duration (configured at startup)
-	PresignedURLExpiry time.Duration
+	// Presigned URL expiry duration (reloadable)
+	PresignedURLExpiry Setting[time.Duration]
+	
+	// Primary cookies file (loadCookies still falls back to the default locations)
+	CookiesPath = "cookies.json"
+	
+	// Attach book metadata (title, authors, ISBN) to uploaded objects
+	ObjectMetadataEnabled bool
+	
+	// Maximum number of downloads waiting for a slot (0 = unlimited, reloadable)
+	MaxQueueDepth Setting[int]
+	
+	// Verify every generated EPUB, not only when a request asks for it
+	VerifyEPUBDefault bool
+	
+	// Default per-download bandwidth cap in KB/s, also the ceiling for per-request limits (0 = unlimited, reloadable)
+	DownloadRateLimitKB Setting[int]
+	
+	// Split EPUB files larger than this many KB during Calibre conversion
+	// (0 = don't pass --flow-size, leaving Calibre's own default in place)
+	CalibreFlowSize int
+	
+	// Limits on open SSE streams, in total and per download (0 = unlimited, reloadable)
+	MaxSSEConnections        Setting[int]
+	MaxSSEClientsPerDownload Setting[int]
+	
+	// Open SSE streams (updated atomically)
+	sseConnections int64
+	
+	// Downloads accepted but still waiting for a download slot
+	queueDepth     int
+	queueDepthLock sync.Mutex
 )
 
-const (
-	tmpDir      = "/tmp/goreilly"
-	cookiesPath = "cookies.json"
-)
+// queueRetryAfter is the Retry-After hint sent when the queue is full
+const queueRetryAfter = 30 * time.Second
 
-func init() {
-	// Ensure tmp directory exists with proper permissions
-	os.MkdirAll(tmpDir, 0755)
-	
-	// Clean any leftover files from previous runs
-	log.Printf("[Init] Cleaning tmp directory: %s", tmpDir)
-	if err := os.RemoveAll(tmpDir); err != nil {
-		log.Printf("[Init] WARNING: Failed to clean tmp directory: %v", err)
-	}
-	os.MkdirAll(tmpDir, 0755)
-}
+// Working directory for conversions and uploads (set by SetupTmpDir)
+var tmpDir = filepath.Join(os.TempDir(), tmpSubdir)
 
 // DownloadBookHandler handles book download requests
 func DownloadBookHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Handler] Download request received")
 	
 	var req struct {
-		BookID string `json:"book_id"`
+		BookID        string `json:"book_id"`
+		Format        string `json:"format"`
+		IncludeExtras bool   `json:"include_extras"`
+		IncludeTOC    bool   `json:"include_toc"`
+		CoverURL      string `json:"cover_url"`
+		CoverPage     string `json:"cover_page"`
+		RateLimitKB   int    `json:"rate_limit_kb"`
+		ForceRefresh  bool   `json:"force_refresh"`
+		VerifyEPUB    bool   `json:"verify_epub"`
+		Prefix        string `json:"prefix"`
+		Bucket        string `json:"bucket"`
+		OutputProfile string `json:"output_profile"`
+		Preview       bool   `json:"preview"`
+		IncludeAudio  bool   `json:"include_audio"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("[Handler] ERROR: Failed to decode request: %v", err)
-		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request")
 		return
 	}
 
-	bookID := req.BookID
-	if bookID == "" {
+	if req.BookID == "" {
 		log.Printf("[Handler] ERROR: Empty book ID")
-		http.Error(w, `{"error":"Book ID is required"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Book ID is required")
+		return
+	}
+
+	// Accept either a bare book ID or a full O'Reilly URL
+	bookID, err := oreilly.ParseBookID(req.BookID)
+	if err != nil {
+		log.Printf("[Handler] ERROR: Invalid book ID %q: %v", req.BookID, err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+			fmt.Sprintf("%v. Use a book ID (e.g. 9781492052197) or a learning.oreilly.com/library/view/... URL", err))
+		return
+	}
+	
+	format, err := parseFormat(req.Format)
+	if err != nil {
+		log.Printf("[Handler] ERROR: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	
+	if req.RateLimitKB < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "rate_limit_kb must be 0 (unlimited) or positive")
+		return
+	}
+	
+	prefix, err := storage.ValidatePrefix(req.Prefix)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	
+	bucket, err := parseBucket(req.Bucket)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
 		return
 	}
 	
-	log.Printf("[Handler] Processing book ID: %s", bookID)
+	if req.CoverURL != "" {
+		if err := oreilly.ValidateCoverURL(req.CoverURL); err != nil {
+			log.Printf("[Handler] ERROR: Invalid cover URL: %v", err)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+	}
+	
+	if len(req.CoverPage) > 255 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "cover_page must be a chapter filename or title")
+		return
+	}
+	
+	outputProfile, err := parseOutputProfile(req.OutputProfile)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	customProfile := customOutputProfile(models.DownloadOptions{Format: format, OutputProfile: outputProfile})
+	
+	preview, err := previewRequested(r, req.Preview)
+	if err != nil {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	}
+	
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+			fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		return
+	}
+	
+	// Keys are per client, so one client's key can never replay another's download
+	idempotencyKey = scopeIdempotencyKey(r, prefix, idempotencyKey)
+
+	// Create download ID for tracking (reused by retries with the same Idempotency-Key)
+	downloadID := uuid.New().String()
+	if existing := claimIdempotencyKey(idempotencyKey, downloadID); existing != nil {
+		if existing.BookID != bookID || existing.Format != format {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidRequest,
+				"Idempotency-Key was already used for a different book or format")
+			return
+		}
+		writeIdempotentReplay(w, existing)
+		return
+	}
+	
+	log.Printf("[Handler] Processing book ID: %s (%s)", bookID, format)
+	if req.ForceRefresh {
+		log.Printf("[Cache] Forced refresh requested for %s (%s), skipping cache", bookID, format)
+	}
 
-	// Check if book is cached in Redis
-	if RedisClient != nil && MinIOClient != nil {
-		cachedInfo, err := RedisClient.GetBookInfo(bookID)
+	// Check if book is cached in Redis in the requested format
+	// (a custom cover, cover page, output profile, preview or embedded audio produces a different file, so it always builds fresh)
+	if RedisClient != nil && MinIOClient != nil && req.CoverURL == "" && req.CoverPage == "" && !customProfile && !preview && !req.IncludeAudio && !req.ForceRefresh {
+		cachedInfo, err := RedisClient.GetBookInfo(cache.BucketScopedID(bucket, prefix, bookID), format)
+		if err == nil && cachedInfo != nil && cachedCopyStale(bookID, cachedInfo) {
+			// Rebuild it like a forced refresh, which also replaces the old object
+			req.ForceRefresh = true
+			cachedInfo = nil
+		}
+		if err == nil && cachedInfo != nil {
+			// The allow/deny lists apply to stored copies too
+			reason, decided := checkCachedBookPolicy(bookID, cachedInfo.ISBN)
+			if reason != "" {
+				log.Printf("[Policy] Denied cached copy of %s: %s", bookID, reason)
+				releaseIdempotencyKey(idempotencyKey)
+				writeError(w, http.StatusForbidden, ErrCodeBookNotAllowed, "Download not allowed: "+reason)
+				return
+			}
+			if !decided {
+				// Build it instead, the job checks the full policy
+				cachedInfo = nil
+			}
+		}
+		if err == nil && cachedInfo != nil && req.IncludeTOC && cachedInfo.TOCPath == "" {
+			// The copy was stored without a TOC; a build adds one (and updates the entry)
+			log.Printf("[Cache] Cached %s of %s has no TOC, building it to include one", format, bookID)
+			cachedInfo = nil
+		}
 		if err == nil && cachedInfo != nil {
 			log.Printf("[Cache] Found cached book: %s", bookID)
 			
 			// Generate fresh presigned URL on-demand (not stored in cache)
-			var presignedEpubURL string
-			var epubSize int64
+			var presignedFileURL string
+			var fileSize int64
 			
-			// Generate EPUB URL if path exists
+			// Generate file URL if path exists
 			if cachedInfo.EpubPath != "" {
-				if url, err := MinIOClient.GetPresignedURL(cachedInfo.EpubPath, PresignedURLExpiry); err == nil {
-					presignedEpubURL = url
-					epubSize = cachedInfo.EpubSize
-					log.Printf("[Cache] Generated fresh EPUB URL (expires in %d hours)", int(PresignedURLExpiry.Hours()))
+				if url, err := entryStorage(cachedInfo).GetPresignedURL(cachedInfo.EpubPath, PresignedURLExpiry.Get()); err == nil {
+					presignedFileURL = url
+					fileSize = cachedInfo.EpubSize
+					log.Printf("[Cache] Generated fresh %s URL (expires in %d hours)", strings.ToUpper(format), int(PresignedURLExpiry.Get().Hours()))
+				}
+			}
+			
+			// Supplementary files are only returned if an earlier download fetched them
+			var presignedExtrasURL string
+			if req.IncludeExtras && cachedInfo.ExtrasPath != "" {
+				if url, err := entryStorage(cachedInfo).GetPresignedURL(cachedInfo.ExtrasPath, PresignedURLExpiry.Get()); err == nil {
+					presignedExtrasURL = url
 				}
 			}
 			
-			// If EPUB exists, return cached response
-			if presignedEpubURL != "" {
-				log.Printf("[Download] Cached: %s (EPUB)", bookID)
-				// Create download ID for tracking
-				downloadID := uuid.New().String()
+			// The TOC is likewise only returned if an earlier download uploaded it
+			var presignedTOCURL string
+			if req.IncludeTOC && cachedInfo.TOCPath != "" {
+				if url, err := entryStorage(cachedInfo).GetPresignedURL(cachedInfo.TOCPath, PresignedURLExpiry.Get()); err == nil {
+					presignedTOCURL = url
+				}
+			}
+			
+			// If the file (and the requested TOC) can be linked, return cached response
+			if presignedFileURL != "" && (!req.IncludeTOC || presignedTOCURL != "") {
+				log.Printf("[Download] Cached: %s (%s)", bookID, strings.ToUpper(format))
 				
+				// epub_url/epub_size are only set for EPUB, minio_url/file_size always
+				var presignedEpubURL string
+				var epubSize int64
+				if format == "epub" {
+					presignedEpubURL = presignedFileURL
+					epubSize = fileSize
+				}
+
 				// Store in downloads map
 				download := &models.Download{
 					ID:        downloadID,
 					BookID:    bookID,
+					Format:    format,
 					Status:    "completed",
 					Progress:  100,
 					Message:   "Book retrieved from cache",
 					BookTitle: cachedInfo.BookTitle,
-					FileSize:  epubSize,
+					FileSize:  fileSize,
 					EpubSize:  epubSize,
 					FilePath:  "", // No local file - using MinIO only
 					Timestamp: time.Now().Unix(),
 					Cached:    true,
-					MinIOURL:  presignedEpubURL,
+					MinIOURL:  presignedFileURL,
 					EpubURL:   presignedEpubURL,
+					ExtrasURL: presignedExtrasURL,
+					TOCURL:    presignedTOCURL,
+					WordCount: cachedInfo.WordCount,
 				}
 				
-				downloadsLock.Lock()
-				downloads[downloadID] = download
-				downloadsLock.Unlock()
+				downloads.Add(download)
 				
 				// Cleanup cached download from memory after 5 minutes
-				go func() {
-					time.Sleep(5 * time.Minute)
-					downloadsLock.Lock()
-					if _, exists := downloads[downloadID]; exists {
-						log.Printf("[Cleanup] Removing cached download from memory: %s", downloadID)
-						delete(downloads, downloadID)
-					}
-					downloadsLock.Unlock()
-				}()
+				downloads.RemoveAfter(downloadID, 5*time.Minute)
 				
 				// Return cached response
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusOK)
-				json.NewEncoder(w).Encode(map[string]interface{}{
+				response := map[string]interface{}{
 					"download_id": downloadID,
 					"cached":      true,
+					"format":      format,
 					"book_title":  cachedInfo.BookTitle,
-					"file_size":   epubSize,
-					"epub_size":   epubSize,
-					"epub_url":    presignedEpubURL,
-					"minio_url":   presignedEpubURL, // Backwards compatibility
+					"file_size":   fileSize,
+					"minio_url":   presignedFileURL, // Backwards compatibility
 					"uploaded_at": cachedInfo.UploadedAt,
-				})
+				}
+				if presignedEpubURL != "" {
+					response["epub_url"] = presignedEpubURL
+					response["epub_size"] = epubSize
+				}
+				if presignedExtrasURL != "" {
+					response["extras_url"] = presignedExtrasURL
+				}
+				if presignedTOCURL != "" {
+					response["toc_url"] = presignedTOCURL
+				}
+				addWordCount(response, cachedInfo.WordCount)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(response)
 				return
 			}
 		}
 	}
 
-	// Book not in cache, proceed with normal download
-	downloadID := uuid.New().String()
+	// Book not in cache, apply backpressure before accepting a new job
+	if !enqueueDownload() {
+		log.Printf("[Queue] Rejecting %s: queue full (%d waiting)", bookID, MaxQueueDepth.Get())
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter.Seconds())))
+		writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Server is busy, please retry later")
+		releaseIdempotencyKey(idempotencyKey)
+		return
+	}
+
+	// Proceed with normal download
 	log.Printf("[Download] Starting: %s", bookID)
 	
 	// Initialize download
 	download := &models.Download{
 		ID:        downloadID,
 		BookID:    bookID,
+		Format:    format,
 		Status:    "starting",
 		Progress:  0,
 		Message:   "Initializing download...",
 		Timestamp: time.Now().Unix(),
+		Priority:  models.PriorityInteractive,
+		Options: models.DownloadOptions{
+			Format:        format,
+			IncludeExtras: req.IncludeExtras,
+			IncludeTOC:    req.IncludeTOC,
+			CoverURL:      req.CoverURL,
+			CoverPage:     strings.TrimSpace(req.CoverPage),
+			RateLimitKB:   req.RateLimitKB,
+			ForceRefresh:  req.ForceRefresh,
+			VerifyEPUB:    req.VerifyEPUB || VerifyEPUBDefault,
+			Prefix:        prefix,
+			Bucket:        bucket,
+			OutputProfile: outputProfile,
+			Preview:       preview,
+			IncludeAudio:  req.IncludeAudio,
+		},
+	}
+
+	response := map[string]interface{}{
+		"download_id": downloadID,
+		"cached":      "false",
+	}
+	// Metadata we already have saves the UI a call to the info endpoint. It is
+	// set before the job starts so it can't overwrite the job's fresher summary.
+	if book := knownBookSummary(bookID); book != nil {
+		download.SetBookSummary(book.Title, book.Authors, book.Cover)
+		response["book"] = book
 	}
 
-	downloadsLock.Lock()
-	downloads[downloadID] = download
-	downloadsLock.Unlock()
+	downloads.Add(download)
 
 	// Start download in goroutine
 	go downloadBookAsync(downloadID, bookID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{
-		"download_id": downloadID,
-		"cached":      "false",
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // downloadBookAsync downloads book asynchronously
 func downloadBookAsync(downloadID, bookID string) {
 	// Cleanup helper function
 	cleanupDownload := func(id string) {
-		downloadsLock.Lock()
-		defer downloadsLock.Unlock()
-		if download, exists := downloads[id]; exists {
-			log.Printf("[Cleanup] Removing download from memory: %s (Status: %s)", id, download.Status)
-			delete(downloads, id)
-		}
-	}
-	
-	// Acquire semaphore slot (limit concurrent downloads)
-	select {
-	case downloadSemaphore <- struct{}{}:
-		// Got slot, proceed
-		defer func() { <-downloadSemaphore }() // Release slot when done
-	default:
-		// No slots available, queue the request
-		log.Printf("[Queue] Download %s waiting for available slot...", downloadID)
-		downloadSemaphore <- struct{}{} // Block until slot available
-		defer func() { <-downloadSemaphore }()
-		log.Printf("[Queue] Download %s acquired slot", downloadID)
+		downloads.Remove(id)
 	}
 	
-	downloadsLock.RLock()
-	download := downloads[downloadID]
-	downloadsLock.RUnlock()
-
-	if download == nil {
+	download, exists := downloads.Get(downloadID)
+	if !exists {
 		return
 	}
 
 	// Progress callback
 	progressCallback := func(stage string, progress int, message string) {
-		download.UpdateStatus("downloading", message, progress)
+		download.UpdateStage(stage, progress, message)
 	}
 
-	// Create client
-	download.UpdateStatus("downloading", "Connecting to O'Reilly...", 10)
-	
-	client, err := oreilly.NewClient(bookID, cookiesPath, progressCallback)
+	// The client picks the cookie account before the job queues, so the job
+	// waits on that account's profile slot
+	client, err := oreilly.NewClient(bookID, CookiesPath, progressCallback)
 	if err != nil {
-		download.SetError(formatError(err), cleanupDownload)
+		download.Logf("[Download] Failed to create O'Reilly client: %v", err)
+		code, msg := classifyError(err)
+		download.SetError(code, msg, cleanupDownload)
+		// Give back the place the job held while waiting
+		if download.Options.Prefetch {
+			atomic.AddInt64(&prefetchWaiting, -1)
+		} else {
+			dequeueDownload()
+		}
+		return
+	}
+
+	profile := clientProfile(client)
+	if download.Options.Prefetch {
+		// Prefetch jobs wait behind every interactive download
+		defer acquirePrefetchSlots(download, profile)()
+	} else {
+		// Acquire the cookie profile's slot first so a busy account only queues behind itself
+		releaseProfile := profileSlots.acquire(profile)
+		defer releaseProfile()
+		
+		// Acquire a download slot (limit concurrent downloads, highest priority first)
+		priority := download.Priority
+		log.Printf("[Queue] Download %s waiting for available slot (priority %d)...", downloadID, priority)
+		downloadSlots.acquire(downloadID, priority)
+		defer downloadSlots.release()
+		log.Printf("[Queue] Download %s acquired slot", downloadID)
+		dequeueDownload()
+	}
+
+	startJob(download)
+	defer finishJob(download)
+
+	// The whole pipeline is cancelled once the job runs past JobTimeout
+	jobCtx, cancelJob := newJobContext()
+	defer cancelJob()
+	fail := func(code, msg string) {
+		if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+			download.Logf("[Download] Job exceeded the %s timeout", JobTimeout.Get())
+			code, msg = ErrCodeTimeout, jobTimedOutMessage
+		}
+		download.SetError(code, msg, cleanupDownload)
+	}
+	
+	// Reserve temp space so concurrent jobs can't fill the disk together
+	// (TmpJobReserveBytes until the book info gives an estimate)
+	waitForTmp := func() {
+		download.Logf("[Queue] Download %s waiting for temporary disk space...", downloadID)
+		download.UpdateStatus("queued", "Waiting for temporary disk space...", 0)
+	}
+	if err := tmpSpace.reserve(jobCtx, TmpJobReserveBytes, waitForTmp); err != nil {
+		code, msg := classifyError(err)
+		fail(code, msg)
+		return
+	}
+	tmpReserved := TmpJobReserveBytes
+	defer func() { tmpSpace.release(tmpReserved) }()
+	
+	format := normalizeFormat(download.Options.Format)
+	spec := outputFormats[format]
+
+	download.UpdateStage(models.StageConnect, 0, "Connecting to O'Reilly...")
+	client.SetLogger(download.Logf)
+	client.SetContext(jobCtx)
+	client.SetJobID(download.ID)
+	if account := client.Account(); account != "" {
+		download.Logf("[Download] Using cookie account %s", account)
+	}
+	if limit := effectiveRateLimitKB(download.Options.RateLimitKB); limit > 0 {
+		download.Logf("[Download] Bandwidth limited to %d KB/s", limit)
+		client.SetRateLimit(int64(limit) * 1024)
+	}
+	customCover := download.Options.CoverURL != "" || download.Options.CoverPage != ""
+	if download.Options.CoverURL != "" {
+		client.SetCoverURL(download.Options.CoverURL)
+	}
+	if download.Options.CoverPage != "" {
+		client.SetCoverPage(download.Options.CoverPage)
+	}
+	if download.Options.Preview {
+		client.SetPreviewChapters(PreviewChapters)
+	}
+	if download.Options.IncludeAudio {
+		client.SetIncludeAudio(true)
+	}
+	// Builds that differ from the shared copy are neither taken from nor written to the cache
+	customBuild := customCover || customOutputProfile(download.Options) || download.Options.Preview || download.Options.IncludeAudio
+
+	// Fetch book info first so the ISBN can be checked against the cache
+	if err := client.GetBookInfo(); err != nil {
+		code, msg := classifyError(err)
+		fail(code, msg)
+		return
+	}
+
+	storeBookPreview(bookID, client.GetBookInfoData())
+	summary := summarizeBook(client.GetBookInfoData())
+	download.SetBookSummary(summary.Title, summary.Authors, summary.Cover)
+
+	// Enforce the allow/deny lists before any content is downloaded
+	if reason := checkBookPolicy(bookID, client.GetBookInfoData()); reason != "" {
+		download.Logf("[Policy] Denied download of %s: %s", bookID, reason)
+		fail(ErrCodeBookNotAllowed, "Download not allowed: "+reason)
+		return
+	}
+
+	// Reserve what this book needs rather than the default
+	if estimate := estimateTmpBytes(download, client.GetBookInfoData()); estimate > 0 && estimate != tmpReserved {
+		download.Logf("[Download] Temp space estimate: %.1f MB", float64(estimate)/(1024*1024))
+		if tmpReserved, err = tmpSpace.resize(jobCtx, tmpReserved, estimate, waitForTmp); err != nil {
+			code, msg := classifyError(err)
+			fail(code, msg)
+			return
+		}
+	}
+
+	// Fill missing description/subjects/cover from an external catalogue (best effort)
+	if oreilly.MetadataProvider != "" {
+		enrichBookInfo(download, client)
+	}
+
+	// Another book ID may already have produced this ISBN edition
+	if !customBuild && !download.Options.ForceRefresh && completeFromISBNCache(download, bookID, client.GetBookInfoData().ISBN, format, download.Options.Prefix) {
+		downloads.RemoveAfter(downloadID, 5*time.Minute)
 		return
 	}
 
-	// Download book
-	download.UpdateStatus("downloading", "Downloading book content...", 20)
-	epubPath, err := client.Download()
+	// Download book (CBZ skips EPUB packaging and only bundles the images)
+	download.UpdateStage(models.StageChapters, 0, "Downloading book content...")
+	var epubPath string
+	if format == "cbz" {
+		epubPath, err = client.DownloadCBZ()
+	} else {
+		epubPath, err = client.Download()
+	}
+	if chapterErrors := client.ChapterErrors(); len(chapterErrors) > 0 {
+		download.Update(func(d *models.Download) {
+			d.ChapterErrors = chapterErrors
+		})
+	}
 	if err != nil {
-		download.SetError(formatError(err), cleanupDownload)
+		if err := client.RemoveFiles(); err != nil {
+			download.Logf("[Cleanup] WARNING: Failed to remove book directory: %v", err)
+		}
+		code, msg := classifyError(err)
+		fail(code, msg)
 		return
 	}
 	
+	// Problems the book survived are reported with its status
+	if warnings := client.Warnings(); len(warnings) > 0 {
+		download.Logf("[Download] Completed with %d warning(s)", len(warnings))
+		skipped := client.SkippedChapters()
+		download.Update(func(d *models.Download) {
+			d.Warnings = warnings
+			d.SkippedChapters = skipped
+		})
+		if len(skipped) > 0 {
+			// An incomplete book must not be served to later requests as the book
+			download.Logf("[Cache] %d chapter(s) skipped, not caching this build", len(skipped))
+			customBuild = true
+		}
+	}
+	if words := client.WordCount(); words > 0 {
+		download.Logf("[Download] Book has %d words", words)
+		download.Update(func(d *models.Download) {
+			d.WordCount = words
+		})
+	}
+	if audio := client.AudioLinks(); len(audio) > 0 {
+		download.Logf("[Audio] Book has %d audio file(s)", len(audio))
+		download.Update(func(d *models.Download) {
+			d.Audio = audio
+		})
+	}
+	if trimmed := client.TrimmedChapters(); len(trimmed) > 0 {
+		download.Logf("[Download] Trimmed %d empty chapter(s)", len(trimmed))
+		download.Update(func(d *models.Download) {
+			d.TrimmedChapters = trimmed
+		})
+	}
+	
 	// Defer cleanup of original downloaded book (from Books directory)
 	defer func() {
 		if epubPath != "" {
-			log.Printf("[Cleanup] Removing original download: %s", epubPath)
-			// Also try to remove the parent directory (book folder in Books/)
+			download.Logf("[Cleanup] Removing original download: %s", epubPath)
+			// Also remove this job's book folder in Books/
 			bookDir := filepath.Dir(epubPath)
-			if err := os.RemoveAll(bookDir); err != nil {
-				log.Printf("[Cleanup] WARNING: Failed to remove book directory: %v", err)
+			if err := client.RemoveFiles(); err != nil {
+				download.Logf("[Cleanup] WARNING: Failed to remove book directory: %v", err)
 			} else {
-				log.Printf("[Cleanup] Book directory removed: %s", bookDir)
+				download.Logf("[Cleanup] Book directory removed: %s", bookDir)
 			}
 		}
 	}()
 
-	// Convert with Calibre (with concurrency control)
-	download.UpdateStatus("downloading", "Converting with Calibre...", 80)
-	
+	// Opt-in smoke test of the generated EPUB's structure (reported, never fatal)
+	var verification *models.EPUBVerification
+	if download.Options.VerifyEPUB && format != "cbz" {
+		verification = oreilly.VerifyEPUB(epubPath)
+		if verification.Valid {
+			download.Logf("[Verify] EPUB OK: %d manifest items, %d spine items", verification.ManifestItems, verification.SpineItems)
+		} else {
+			download.Logf("[Verify] WARNING: EPUB has %d problem(s): %s", len(verification.Errors), strings.Join(verification.Errors, "; "))
+		}
+		download.Update(func(d *models.Download) {
+			d.Verification = verification
+		})
+	}
+
 	bookTitle := client.GetBookTitle()
 	safeFilename := cleanFilename(bookTitle)
 	
 	// Use /tmp for temporary conversion file
-	outputEpubFile := filepath.Join(tmpDir, fmt.Sprintf("%s_%s.epub", safeFilename, bookID))
+	// (custom builds get their own name so they never replace the shared copy)
+	outputName := fmt.Sprintf("%s_%s", safeFilename, bookID)
+	if customCover {
+		outputName += "_" + coverFingerprint(download.Options.CoverURL+"|"+download.Options.CoverPage)
+	}
+	if customOutputProfile(download.Options) && download.Options.OutputProfile != "" {
+		outputName += "_" + download.Options.OutputProfile
+	}
+	if download.Options.Preview {
+		outputName += "_preview"
+	}
+	if download.Options.IncludeAudio {
+		outputName += "_audio"
+	}
+	outputEpubFile := jobTmpFile(download, outputName, "."+spec.Extension)
+	// Covers every failure (and timeout) path, the success path removes it after upload
+	defer os.Remove(outputEpubFile)
 
-	// Acquire conversion semaphore (CPU-intensive operations)
-	log.Printf("[Conversion] Waiting for conversion slot...")
-	conversionSemaphore <- struct{}{}
-	log.Printf("[Conversion] Acquired conversion slot")
-	
-	// Convert to EPUB
-	epubErr := convertWithCalibre(epubPath, outputEpubFile)
-	if epubErr != nil {
-		// Fallback: just copy the file
+	if spec.CalibreTarget == "" {
+		// Built by the client (CBZ), nothing to convert
+		if err := copyFile(epubPath, outputEpubFile); err != nil {
+			fail(ErrCodeInternal, fmt.Sprintf("Failed to save %s file: %v", strings.ToUpper(format), err))
+			return
+		}
+	} else if !calibreAvailable {
+		// No Calibre on this host - use the raw client EPUB as-is (parseFormat only allows native formats)
+		download.Logf("[Conversion] Skipping Calibre (ebook-convert not installed), using raw EPUB")
+		if err := copyFile(epubPath, outputEpubFile); err != nil {
+			fail(ErrCodeInternal, fmt.Sprintf("Failed to save EPUB file: %v", err))
+			return
+		}
+	} else if skipCalibre(download, epubPath, format, verification) {
+		// Already valid, Calibre would only normalize it
+		download.Logf("[Conversion] Client EPUB passed verification, skipping Calibre")
 		if err := copyFile(epubPath, outputEpubFile); err != nil {
-			<-conversionSemaphore // Release semaphore before returning
-			download.SetError(fmt.Sprintf("Failed to save EPUB file: %v", err), cleanupDownload)
+			fail(ErrCodeInternal, fmt.Sprintf("Failed to save EPUB file: %v", err))
+			return
+		}
+	} else {
+		// Convert with Calibre (with concurrency control)
+		download.UpdateStage(models.StageConvert, 0, "Converting with Calibre...")
+
+		// Acquire conversion semaphore (CPU-intensive operations)
+		download.Logf("[Conversion] Waiting for conversion slot...")
+		select {
+		case conversionSemaphore <- struct{}{}:
+		case <-jobCtx.Done():
+			fail(ErrCodeTimeout, jobTimedOutMessage)
+			return
+		}
+		download.Logf("[Conversion] Acquired conversion slot")
+		
+		// Convert to the requested format, reporting Calibre's 0-100% as the convert stage
+		lastProgress := models.StageProgress(models.StageConvert, 0)
+		convertErr := convertWithCalibre(jobCtx, epubPath, outputEpubFile, spec.CalibreTarget, client.CustomCoverPath(), download.Options.OutputProfile, func(percent int) {
+			if progress := models.StageProgress(models.StageConvert, percent); progress > lastProgress {
+				lastProgress = progress
+				download.UpdateStage(models.StageConvert, percent, fmt.Sprintf("Converting with Calibre... %d%%", percent))
+			}
+		})
+		if convertErr != nil && format != "epub" {
+			// No raw fallback for non-EPUB formats
+			<-conversionSemaphore
+			download.Logf("[Conversion] ERROR: Calibre failed to produce %s: %v", format, convertErr)
+			fail(ErrCodeInternal, fmt.Sprintf("Failed to convert book to %s", strings.ToUpper(format)))
 			return
 		}
+		if convertErr != nil {
+			download.Logf("[Conversion] Calibre failed, using raw EPUB: %v", convertErr)
+			// Fallback: just copy the file
+			if err := copyFile(epubPath, outputEpubFile); err != nil {
+				<-conversionSemaphore // Release semaphore before returning
+				fail(ErrCodeInternal, fmt.Sprintf("Failed to save EPUB file: %v", err))
+				return
+			}
+		}
+		
+		// Release conversion semaphore
+		<-conversionSemaphore
+		download.Logf("[Conversion] Released conversion slot")
+	}
+
+	// Don't fall back to the raw EPUB and upload it when Calibre was killed by the timeout
+	if jobCtx.Err() != nil {
+		fail(ErrCodeTimeout, jobTimedOutMessage)
+		return
+	}
+
+	// Never upload/cache a truncated or corrupt EPUB
+	if format == "epub" {
+		if err := oreilly.ValidateEPUB(outputEpubFile); err != nil {
+			download.Logf("[Validate] WARNING: Converted EPUB is invalid: %v", err)
+			if err := oreilly.ValidateEPUB(epubPath); err != nil {
+				download.Logf("[Validate] ERROR: Raw EPUB is invalid too: %v", err)
+				os.Remove(outputEpubFile)
+				fail(ErrCodeInternal, "Generated EPUB is invalid")
+				return
+			}
+			download.Logf("[Validate] Falling back to raw client EPUB")
+			if err := copyFile(epubPath, outputEpubFile); err != nil {
+				fail(ErrCodeInternal, fmt.Sprintf("Failed to save EPUB file: %v", err))
+				return
+			}
+		}
 	}
-	
-	// Release conversion semaphore
-	<-conversionSemaphore
-	log.Printf("[Conversion] Released conversion slot")
 
 	// Get file size
 	epubFileInfo, err := os.Stat(outputEpubFile)
@@ -292,104 +742,411 @@ func downloadBookAsync(downloadID, bookID string) {
 	var minioEpubURL string
 	var uploadedEpubSize int64
 	var epubObjectName string
+	var extrasObjectName, extrasURL string
+	var tocObjectName, tocURL string
 	
 	if MinIOClient != nil {
-		download.UpdateStatus("downloading", "Uploading to storage...", 90)
-		log.Printf("[Upload] Starting upload for book %s", bookID)
+		download.UpdateStage(models.StageUpload, 0, "Uploading to storage...")
+		download.Logf("[Upload] Starting upload for book %s", bookID)
 		
 		// Upload EPUB
-		epubObj, epubSize, err := MinIOClient.UploadFile(bookID, outputEpubFile)
+		uploadOpts := storage.UploadOptions{
+			ContentType: spec.ContentType,
+			Prefix:      download.Options.Prefix,
+			Name:        outputName + "." + spec.Extension,
+			Custom:      customBuild,
+		}
+		if ObjectMetadataEnabled {
+			uploadOpts.Metadata = bookObjectMetadata(bookID, client.GetBookInfoData())
+		}
+		
+		// Report upload progress as the upload stage
+		lastUploadProgress := models.StageProgress(models.StageUpload, 0)
+		uploadOpts.OnProgress = func(uploaded, total int64) {
+			if total <= 0 {
+				return
+			}
+			percent := int(uploaded * 100 / total)
+			if progress := models.StageProgress(models.StageUpload, percent); progress > lastUploadProgress {
+				lastUploadProgress = progress
+				download.UpdateStage(models.StageUpload, percent, fmt.Sprintf("Uploading to storage... %d%%", percent))
+			}
+		}
+		epubObj, epubSize, err := uploadFile(jobCtx, download, bookID, outputEpubFile, uploadOpts)
 		if err != nil {
-			log.Printf("[Upload] ERROR: Failed to upload EPUB to MinIO: %v", err)
-			download.SetError("Failed to upload to storage", cleanupDownload)
+			download.Logf("[Upload] ERROR: Failed to upload EPUB to MinIO: %v", err)
+			fail(ErrCodeStorageUnavailable, "Failed to upload to storage")
 			return
 		}
 		
 		epubObjectName = epubObj
 		uploadedEpubSize = epubSize
 		
-		log.Printf("[Upload] EPUB Success: %s", epubObjectName)
+		download.Logf("[Upload] EPUB Success: %s", epubObjectName)
 		
 		// Generate presigned URL for EPUB (valid for configured duration)
-		presignedEpubURL, err := MinIOClient.GetPresignedURL(epubObjectName, PresignedURLExpiry)
+		presignedEpubURL, err := storageFor(download.Options.Bucket).GetPresignedURL(epubObjectName, PresignedURLExpiry.Get())
 		if err != nil {
-			log.Printf("[Upload] ERROR: Failed to generate EPUB URL: %v", err)
-			download.SetError("Failed to generate download URL", cleanupDownload)
+			download.Logf("[Upload] ERROR: Failed to generate EPUB URL: %v", err)
+			fail(ErrCodeStorageUnavailable, "Failed to generate download URL")
 			return
 		}
 		
 		minioEpubURL = presignedEpubURL
 		
 	// Delete local EPUB file after successful upload
-	log.Printf("[Cleanup] Removing local EPUB file: %s", outputEpubFile)
+	download.Logf("[Cleanup] Removing local EPUB file: %s", outputEpubFile)
 	if err := os.Remove(outputEpubFile); err != nil {
-		log.Printf("[Cleanup] WARNING: Failed to remove local EPUB: %v", err)
+		download.Logf("[Cleanup] WARNING: Failed to remove local EPUB: %v", err)
 	} else {
-		log.Printf("[Cleanup] Local EPUB removed successfully")
+		download.Logf("[Cleanup] Local EPUB removed successfully")
 	}
 	
-	log.Printf("[Upload] Upload completed for book %s", bookID)		// Cache book metadata in Redis (store path, not URL)
-		if RedisClient != nil && epubObjectName != "" {
+	download.Logf("[Upload] Upload completed for book %s", bookID)
+		
+		// Supplementary files (opt-in), a failure here doesn't fail the download
+		if download.Options.IncludeExtras {
+			extrasObjectName, extrasURL = uploadExtras(jobCtx, download, client, bookID)
+		}
+		
+		// Structured table of contents (opt-in), also best effort
+		if download.Options.IncludeTOC {
+			tocObjectName, tocURL = uploadTOC(jobCtx, download, client, bookID)
+		}
+		
+		// Cache book metadata in Redis (store path, not URL), custom builds are per-request
+		if RedisClient != nil && epubObjectName != "" && !customBuild {
 			cacheInfo := &cache.BookCacheInfo{
-				BookID:     bookID,
-				BookTitle:  bookTitle,
-				EpubPath:   epubObjectName,
-				EpubSize:   uploadedEpubSize,
-				UploadedAt: time.Now(),
+				BookID:      bookID,
+				BookTitle:   bookTitle,
+				EpubPath:    epubObjectName,
+				EpubSize:    uploadedEpubSize,
+				UploadedAt:  time.Now(),
+				ISBN:        client.GetBookInfoData().ISBN,
+				ExtrasPath:  extrasObjectName,
+				TOCPath:     tocObjectName,
+				Format:      format,
+				Prefix:      download.Options.Prefix,
+				Bucket:      download.Options.Bucket,
+				WordCount:   client.WordCount(),
+				Fingerprint: oreilly.Fingerprint(client.GetBookInfoData()),
+			}
+			
+			// A forced refresh replaces the cached object; remove the old one if its name changed
+			if download.Options.ForceRefresh {
+				if previous, err := RedisClient.GetBookInfo(cache.BucketScopedID(download.Options.Bucket, download.Options.Prefix, bookID), format); err == nil && previous != nil &&
+					previous.EpubPath != "" && previous.EpubPath != epubObjectName {
+					download.Logf("[Cache] Forced refresh: removing previous object %s", previous.EpubPath)
+					if err := storageFor(previous.Bucket).DeleteFile(previous.EpubPath); err != nil {
+						download.Logf("[Cache] WARNING: Failed to remove previous object: %v", err)
+					}
+				}
+				download.Logf("[Cache] Forced refresh: overwriting cache entry for %s (%s)", bookID, format)
 			}
 			
 			if err := RedisClient.SetBookInfo(cacheInfo); err != nil {
-				log.Printf("[Cache] ERROR: Failed to cache book metadata: %v", err)
+				download.Logf("[Cache] ERROR: Failed to cache book metadata: %v", err)
 			} else {
-				log.Printf("[Cache] Stored book metadata (path only, URL generated on-demand)")
+				download.Logf("[Cache] Stored book metadata (path only, URL generated on-demand)")
 			}
 		}
 	} else {
 		// MinIO is disabled - cannot proceed without storage
-		log.Printf("[Upload] ERROR: MinIO is disabled - cannot complete download")
-		download.SetError("Storage service unavailable - please contact administrator", cleanupDownload)
+		download.Logf("[Upload] ERROR: MinIO is disabled - cannot complete download")
+		fail(ErrCodeStorageUnavailable, "Storage service unavailable - please contact administrator")
 		
 		// Clean up local file
 		if err := os.Remove(outputEpubFile); err == nil {
-			log.Printf("[Cleanup] Removed EPUB file: %s", outputEpubFile)
+			download.Logf("[Cleanup] Removed EPUB file: %s", outputEpubFile)
 		}
 		return
 	}
 
 	// Update status to completed
-	downloadsLock.Lock()
-	download.Status = "completed"
-	download.Progress = 100
-	download.Message = "Download complete!"
-	download.FilePath = "" // Local files are deleted after upload
-	download.BookTitle = bookTitle
-	download.FileSize = epubFileSize
-	download.EpubSize = epubFileSize
-	download.MinIOURL = minioEpubURL
-	download.EpubURL = minioEpubURL
-	download.Timestamp = time.Now().Unix()
-	downloadsLock.Unlock()
+	download.Update(func(d *models.Download) {
+		d.Status = "completed"
+		d.Progress = 100
+		d.Message = "Download complete!"
+		d.FilePath = "" // Local files are deleted after upload
+		d.BookTitle = bookTitle
+		d.FileSize = epubFileSize
+		d.MinIOURL = minioEpubURL
+		if format == "epub" {
+			d.EpubSize = epubFileSize
+			d.EpubURL = minioEpubURL
+		}
+		d.ExtrasURL = extrasURL
+		d.TOCURL = tocURL
+		d.Timestamp = time.Now().Unix()
+	})
 	
 	// Broadcast completion to SSE clients
 	download.UpdateStatus("completed", "Download complete!", 100)
 	
 	// Cleanup from memory after 5 minutes (enough time for client to retrieve status)
-	go func() {
-		time.Sleep(5 * time.Minute)
-		cleanupDownload(downloadID)
-	}()
+	downloads.RemoveAfter(downloadID, 5*time.Minute)
+}
+
+// completeFromISBNCache completes a download from an existing cache entry for the
+// same ISBN under a different book ID (within the same prefix and bucket). Returns false if
+// there is no usable entry.
+func completeFromISBNCache(download *models.Download, bookID, isbn, format, prefix string) bool {
+	if RedisClient == nil || MinIOClient == nil || isbn == "" {
+		return false
+	}
+
+	cachedInfo, err := RedisClient.GetBookInfoByISBN(cache.BucketScopedID(download.Options.Bucket, prefix, isbn), format)
+	if err != nil || cachedInfo == nil || cachedInfo.EpubPath == "" {
+		return false
+	}
+	// Without a stored TOC or extras bundle the job goes on and builds them
+	if download.Options.IncludeTOC && cachedInfo.TOCPath == "" {
+		return false
+	}
+	if download.Options.IncludeExtras && cachedInfo.ExtrasPath == "" {
+		return false
+	}
+
+	presignedURL, err := entryStorage(cachedInfo).GetPresignedURL(cachedInfo.EpubPath, PresignedURLExpiry.Get())
+	if err != nil {
+		log.Printf("[Cache] ERROR: Failed to generate URL for ISBN %s: %v", isbn, err)
+		return false
+	}
+
+	var tocURL string
+	if download.Options.IncludeTOC {
+		if tocURL, err = entryStorage(cachedInfo).GetPresignedURL(cachedInfo.TOCPath, PresignedURLExpiry.Get()); err != nil {
+			log.Printf("[Cache] ERROR: Failed to generate TOC URL for ISBN %s: %v", isbn, err)
+			return false
+		}
+	}
+
+	var extrasURL string
+	if download.Options.IncludeExtras {
+		if extrasURL, err = entryStorage(cachedInfo).GetPresignedURL(cachedInfo.ExtrasPath, PresignedURLExpiry.Get()); err != nil {
+			log.Printf("[Cache] ERROR: Failed to generate extras URL for ISBN %s: %v", isbn, err)
+			return false
+		}
+	}
+
+	log.Printf("[Cache] ISBN %s already cached as book %s, reusing for %s", isbn, cachedInfo.BookID, bookID)
+
+	// Index this book ID too so the next request is a direct cache hit
+	aliasInfo := *cachedInfo
+	aliasInfo.BookID = bookID
+	if err := RedisClient.SetBookInfo(&aliasInfo); err != nil {
+		log.Printf("[Cache] ERROR: Failed to cache book alias: %v", err)
+	}
+
+	download.Update(func(d *models.Download) {
+		d.Status = "completed"
+		d.Progress = 100
+		d.Message = "Book retrieved from cache"
+		d.BookTitle = cachedInfo.BookTitle
+		d.FileSize = cachedInfo.EpubSize
+		d.MinIOURL = presignedURL
+		if format == "epub" {
+			d.EpubSize = cachedInfo.EpubSize
+			d.EpubURL = presignedURL
+		}
+		d.TOCURL = tocURL
+		d.ExtrasURL = extrasURL
+		d.UploadedAt = cachedInfo.UploadedAt
+		d.WordCount = cachedInfo.WordCount
+		d.Cached = true
+		d.Timestamp = time.Now().Unix()
+	})
+
+	download.UpdateStatus("completed", "Book retrieved from cache", 100)
+	return true
+}
+
+// enrichBookInfo looks the book up with the configured metadata provider (cached
+// in Redis by ISBN) and fills gaps in its info. Failures are only logged.
+func enrichBookInfo(download *models.Download, client *oreilly.Client) {
+	isbn := client.GetBookInfoData().ISBN
+	if isbn == "" {
+		return
+	}
+
+	var enrichment *models.Enrichment
+	if RedisClient != nil {
+		if cached, err := RedisClient.GetEnrichment(isbn, oreilly.MetadataProvider); err == nil {
+			enrichment = cached
+		}
+	}
+	if enrichment == nil {
+		fetched, err := oreilly.FetchEnrichment(isbn)
+		if err != nil {
+			download.Logf("[Enrich] WARNING: %s lookup of ISBN %s failed: %v", oreilly.MetadataProvider, isbn, err)
+			return
+		}
+		enrichment = fetched
+		if RedisClient != nil {
+			if err := RedisClient.SetEnrichment(isbn, enrichment); err != nil {
+				download.Logf("[Enrich] WARNING: Failed to cache metadata: %v", err)
+			}
+		}
+	}
+
+	if filled := client.ApplyEnrichment(enrichment); len(filled) > 0 {
+		download.Logf("[Enrich] Filled %s from %s", strings.Join(filled, ", "), enrichment.Source)
+	}
+}
+
+// effectiveRateLimitKB combines a per-request limit with the global one: the
+// stricter positive value wins (0 = unlimited)
+func effectiveRateLimitKB(requested int) int {
+	limit := DownloadRateLimitKB.Get()
+	if requested <= 0 {
+		return limit
+	}
+	if limit > 0 && limit < requested {
+		return limit
+	}
+	return requested
+}
+
+// coverFingerprint names a custom cover in output file names
+func coverFingerprint(coverURL string) string {
+	sum := sha256.Sum256([]byte(coverURL))
+	return "cover-" + hex.EncodeToString(sum[:4])
 }
 
-// convertWithCalibre converts EPUB using Calibre
-func convertWithCalibre(inputPath, outputPath string) error {
-	args := []string{inputPath, outputPath}
+// uploadExtras bundles the book's supplementary files, uploads the bundle and
+// returns its object name and presigned URL (empty if there was nothing to upload)
+func uploadExtras(ctx context.Context, download *models.Download, client *oreilly.Client, bookID string) (string, string) {
+	if len(client.ExtraLinks()) == 0 {
+		download.Logf("[Extras] No supplementary files found for book %s", bookID)
+		return "", ""
+	}
 	
-	cmd := exec.Command("ebook-convert", args...)
+	download.UpdateStage(models.StageExtras, 0, "Fetching supplementary files...")
+	extrasPath := jobTmpFile(download, bookID, "_extras.zip")
+	defer os.Remove(extrasPath)
+	
+	count, err := client.DownloadExtras(ctx, extrasPath)
+	if err != nil {
+		download.Logf("[Extras] WARNING: Failed to bundle supplementary files: %v", err)
+		return "", ""
+	}
+	if count == 0 {
+		download.Logf("[Extras] WARNING: None of the supplementary files could be downloaded")
+		return "", ""
+	}
+	
+	objectName, _, err := uploadFile(ctx, download, bookID, extrasPath, storage.UploadOptions{
+		ContentType: "application/zip",
+		Prefix:      download.Options.Prefix,
+		Name:        bookID + "_extras.zip",
+	})
+	if err != nil {
+		download.Logf("[Extras] WARNING: Failed to upload supplementary files: %v", err)
+		return "", ""
+	}
+	
+	url, err := storageFor(download.Options.Bucket).GetPresignedURL(objectName, PresignedURLExpiry.Get())
+	if err != nil {
+		download.Logf("[Extras] WARNING: Failed to generate supplementary files URL: %v", err)
+		return "", ""
+	}
+	
+	download.Logf("[Extras] Uploaded %d supplementary file(s): %s", count, objectName)
+	return objectName, url
+}
+
+// enqueueDownload reserves a place in the download queue, returning false when it is full
+func enqueueDownload() bool {
+	queueDepthLock.Lock()
+	defer queueDepthLock.Unlock()
+
+	if maxDepth := MaxQueueDepth.Get(); maxDepth > 0 && queueDepth >= maxDepth {
+		return false
+	}
+	queueDepth++
+	return true
+}
+
+// dequeueDownload releases a queue place once the job holds a download slot
+func dequeueDownload() {
+	queueDepthLock.Lock()
+	queueDepth--
+	queueDepthLock.Unlock()
+}
+
+// currentQueueDepth returns the number of downloads waiting for a slot
+func currentQueueDepth() int {
+	queueDepthLock.Lock()
+	defer queueDepthLock.Unlock()
+	return queueDepth
+}
+
+// bookObjectMetadata builds the MinIO user metadata for a book
+func bookObjectMetadata(bookID string, bookInfo *models.BookInfo) map[string]string {
+	metadata := map[string]string{
+		"book-id": bookID,
+	}
+	if bookInfo == nil {
+		return metadata
+	}
+
+	authors := []string{}
+	for _, author := range bookInfo.Authors {
+		authors = append(authors, author.Name)
+	}
+
+	metadata["title"] = bookInfo.Title
+	metadata["authors"] = strings.Join(authors, ", ")
+	metadata["isbn"] = bookInfo.ISBN
+	return metadata
+}
+
+// calibreProgressPattern matches progress lines printed by ebook-convert (e.g. "34% Running transforms")
+var calibreProgressPattern = regexp.MustCompile(`^\s*(\d{1,3})%\s*(.*)$`)
+
+// convertWithCalibre converts EPUB using Calibre to the target type (e.g. mobi)
+// onProgress (optional) receives the percentage parsed from ebook-convert's output
+func convertWithCalibre(ctx context.Context, inputPath, outputPath, target, coverPath, outputProfile string, onProgress func(percent int)) error {
+	// ebook-convert picks the output type from the file extension
+	convertPath := outputPath
+	if !strings.EqualFold(strings.TrimPrefix(filepath.Ext(outputPath), "."), target) {
+		convertPath = outputPath + "." + target
+		defer os.Remove(convertPath)
+	}
+
+	args := []string{inputPath, convertPath}
+	if coverPath != "" {
+		args = append(args, "--cover", coverPath)
+	}
+	if outputProfile != "" {
+		args = append(args, "--output-profile", outputProfile)
+	}
+	if strings.EqualFold(target, "epub") {
+		if CalibreFlowSize > 0 {
+			args = append(args, "--flow-size", strconv.Itoa(CalibreFlowSize))
+		}
+		// Calibre writes EPUB2 unless told otherwise
+		if oreilly.EPUBVersion == 3 {
+			args = append(args, "--epub-version", "3")
+		}
+	}
+	
+	// Killed when the job is cancelled (JobTimeout) as well as by the timer below
+	cmd := exec.CommandContext(ctx, "ebook-convert", args...)
 	
 	// Capture stderr to see conversion errors
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	cmd.Stdout = nil
+	
+	// Capture stdout to follow conversion progress
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("conversion failed: %w", err)
+	}
+	
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("conversion failed: %w", err)
+	}
 	
 	// Set timeout
 	timeout := 5 * time.Minute
@@ -399,7 +1156,22 @@ func convertWithCalibre(inputPath, outputPath string) error {
 	})
 	defer timer.Stop()
 
-	err := cmd.Run()
+	// Parse progress lines; if none match, progress simply stays where it was
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanCalibreLines)
+	for scanner.Scan() {
+		m := calibreProgressPattern.FindStringSubmatch(scanner.Text())
+		if m == nil || onProgress == nil {
+			continue
+		}
+		if percent, err := strconv.Atoi(m[1]); err == nil && percent <= 100 {
+			onProgress(percent)
+		}
+	}
+	// Drain anything left so ebook-convert never blocks on a full pipe
+	io.Copy(io.Discard, stdout)
+
+	err = cmd.Wait()
 	if err != nil {
 		// Log the actual error for debugging
 		errorMsg := stderr.String()
@@ -411,19 +1183,47 @@ func convertWithCalibre(inputPath, outputPath string) error {
 			log.Printf("[Conversion] Calibre stderr: %s", errorMsg)
 		}
 		
-		return fmt.Errorf("conversion failed: %w", err)
+		return fmt.Errorf("conversion failed: %w: %s", err, errorMsg)
 	}
 
+	if convertPath != outputPath {
+		return os.Rename(convertPath, outputPath)
+	}
 	return nil
 }
 
-// copyFile copies a file
+// scanCalibreLines splits ebook-convert output on either \n or \r
+func scanCalibreLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// copyFile copies a file (streamed, so large EPUBs are never held in memory)
 func copyFile(src, dst string) error {
-	input, err := os.ReadFile(src)
+	input, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(dst, input, 0644)
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
 }
 
 // cleanFilename removes invalid characters
@@ -440,80 +1240,124 @@ func cleanFilename(name string) string {
 	return result
 }
 
-// formatError formats error messages for users
-func formatError(err error) string {
-	msg := err.Error()
-	
-	if contains(msg, "Book not found") || contains(msg, "API error") {
-		return "Book not found. Please check the Book ID and try again."
-	}
-	if contains(msg, "Authentication failed") || contains(msg, "cookies.json") {
-		return "Authentication failed. Please update your cookies.json file."
-	}
-	if contains(msg, "timeout") || contains(msg, "Timeout") {
-		return "Request timed out. Please try again."
-	}
-	
-	return msg
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && 
-		(s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || 
-		findSubstring(s, substr)))
-}
-
-func findSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
-
 // GetStatusHandler returns download status
 func GetStatusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	downloadID := vars["id"]
 
-	downloadsLock.RLock()
-	download, exists := downloads[downloadID]
-	downloadsLock.RUnlock()
+	download, exists := downloads.Get(downloadID)
 
 	if !exists {
-		http.Error(w, `{"error":"Download ID not found"}`, http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrCodeDownloadNotFound, "Download ID not found")
 		return
 	}
 
-	// Create response (without internal fields)
-	response := map[string]interface{}{
-		"status":     download.Status,
-		"progress":   download.Progress,
-		"message":    download.Message,
-		"book_id":    download.BookID,
-		"book_title": download.BookTitle,
-		"file_size":  download.FileSize,
-		"epub_size":  download.EpubSize,
-		"cached":     download.Cached,
-	}
+	// Read every field under the download's lock; the job updates them concurrently
+	var response map[string]interface{}
+	var queued bool
+	var formatsID string
+	download.Read(func(download *models.Download) {
+		// Create response (without internal fields)
+		response = map[string]interface{}{
+			"status":     download.Status,
+			"progress":   download.Progress,
+			"message":    download.Message,
+			"book_id":    download.BookID,
+			"format":     download.Format,
+			"book_title": download.BookTitle,
+			"file_size":  download.FileSize,
+			"epub_size":  download.EpubSize,
+			"cached":     download.Cached,
+		}
 
-	if download.Error != "" {
-		response["error"] = download.Error
-	}
+		if len(download.Authors) > 0 {
+			response["authors"] = append([]string(nil), download.Authors...)
+		}
+		if download.CoverURL != "" {
+			response["cover_url"] = download.CoverURL
+		}
+
+		queued = download.StartedAt.IsZero() && download.Status != "completed" && download.Status != "error"
+
+		if download.Error != "" {
+			response["error"] = download.Error
+		}
 	
-	// Return EPUB URL
-	if download.EpubURL != "" {
-		response["epub_url"] = download.EpubURL
-	}
+		// Return EPUB URL
+		if download.EpubURL != "" {
+			response["epub_url"] = download.EpubURL
+		}
 	
-	// Backwards compatibility
-	if download.MinIOURL != "" {
-		response["minio_url"] = download.MinIOURL
-	}
+		// Backwards compatibility
+		if download.MinIOURL != "" {
+			response["minio_url"] = download.MinIOURL
+		}
+	
+		// Supplementary files bundle (include_extras)
+		if download.ExtrasURL != "" {
+			response["extras_url"] = download.ExtrasURL
+		}
+	
+		// Only the first chapters were included (preview)
+		if download.Options.Preview {
+			response["preview"] = true
+		}
+	
+		// Table of contents as JSON (include_toc)
+		if download.TOCURL != "" {
+			response["toc_url"] = download.TOCURL
+		}
+	
+		// EPUB structure check (verify_epub)
+		if download.Verification != nil {
+			response["verification"] = download.Verification
+		}
 	
-	if !download.UploadedAt.IsZero() {
-		response["uploaded_at"] = download.UploadedAt
+		if !download.UploadedAt.IsZero() {
+			response["uploaded_at"] = download.UploadedAt
+		}
+	
+		// Non-fatal problems met while building the book
+		if len(download.Warnings) > 0 {
+			response["warnings"] = append([]string(nil), download.Warnings...)
+		}
+	
+		// Companion audio found in the book (embedded with include_audio)
+		if len(download.Audio) > 0 {
+			response["audio"] = append([]string(nil), download.Audio...)
+		}
+		addWordCount(response, download.WordCount)
+		if len(download.SkippedChapters) > 0 {
+			response["skipped_chapters"] = append([]string(nil), download.SkippedChapters...)
+		}
+		if len(download.TrimmedChapters) > 0 {
+			response["trimmed_chapters"] = append([]string(nil), download.TrimmedChapters...)
+			response["trimmed_chapter_count"] = len(download.TrimmedChapters)
+		}
+		if len(download.ChapterErrors) > 0 {
+			response["chapter_errors"] = append([]string(nil), download.ChapterErrors...)
+		}
+	
+		// Failed download that has been retried (POST /api/download/{id}/retry)
+		if download.RetriedAs != "" {
+			response["retried_as"] = download.RetriedAs
+		}
+	
+		// Every stored format of the book, so a UI can offer them all (not for previews)
+		if download.Status == "completed" && !download.Options.Preview {
+			formatsID = cache.BucketScopedID(download.Options.Bucket, download.Options.Prefix, download.BookID)
+		}
+	})
+
+	if queued {
+		if position := queuePosition(downloadID); position > 0 {
+			response["queue_position"] = position
+		}
+	}
+	if formatsID != "" {
+		if links := cachedFormatLinks(formatsID); len(links) > 0 {
+			response["formats"] = links
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -525,29 +1369,32 @@ func GetFileHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	downloadID := vars["id"]
 
-	downloadsLock.RLock()
-	download, exists := downloads[downloadID]
-	downloadsLock.RUnlock()
+	download, exists := downloads.Get(downloadID)
 
 	if !exists {
-		http.Error(w, `{"error":"Download ID not found"}`, http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrCodeDownloadNotFound, "Download ID not found")
 		return
 	}
 
-	if download.Status != "completed" {
-		http.Error(w, `{"error":"Download not completed"}`, http.StatusBadRequest)
+	var status, minioURL string
+	download.Read(func(download *models.Download) {
+		status, minioURL = download.Status, download.MinIOURL
+	})
+
+	if status != "completed" {
+		writeError(w, http.StatusBadRequest, ErrCodeDownloadNotCompleted, "Download not completed")
 		return
 	}
 
 	// Redirect to MinIO URL (files are no longer stored locally)
-	if download.MinIOURL != "" {
-		http.Redirect(w, r, download.MinIOURL, http.StatusTemporaryRedirect)
+	if minioURL != "" {
+		http.Redirect(w, r, minioURL, http.StatusTemporaryRedirect)
 		return
 	}
 
 	// No MinIO URL available - this shouldn't happen in normal operation
 	log.Printf("[GetFile] ERROR: No MinIO URL for completed download %s", downloadID)
-	http.Error(w, `{"error":"File not available - no storage URL found"}`, http.StatusNotFound)
+	writeError(w, http.StatusNotFound, ErrCodeStorageUnavailable, "File not available - no storage URL found")
 }
 
 // GetFileInfoHandler returns file information
@@ -555,26 +1402,30 @@ func GetFileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	downloadID := vars["id"]
 
-	downloadsLock.RLock()
-	download, exists := downloads[downloadID]
-	downloadsLock.RUnlock()
+	download, exists := downloads.Get(downloadID)
 
 	if !exists {
-		http.Error(w, `{"error":"Download ID not found"}`, http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrCodeDownloadNotFound, "Download ID not found")
 		return
 	}
 
-	if download.Status != "completed" {
-		http.Error(w, `{"error":"Download not completed"}`, http.StatusBadRequest)
-		return
-	}
+	var status string
+	var response map[string]interface{}
+	download.Read(func(download *models.Download) {
+		status = download.Status
+		response = map[string]interface{}{
+			"title":       download.BookTitle,
+			"format":      outputFormats[download.Format].Name(),
+			"size":        download.FileSize,
+			"download_id": downloadID,
+			"book_id":     download.BookID,
+		}
+		addWordCount(response, download.WordCount)
+	})
 
-	response := map[string]interface{}{
-		"title":       download.BookTitle,
-		"format":      "EPUB",
-		"size":        download.FileSize,
-		"download_id": downloadID,
-		"book_id":     download.BookID,
+	if status != "completed" {
+		writeError(w, http.StatusBadRequest, ErrCodeDownloadNotCompleted, "Download not completed")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -590,16 +1441,51 @@ func fileExists(path string) bool {
 // GetBookInfoHandler fetches book metadata without downloading
 func GetBookInfoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	bookID := vars["id"]
 
-	// Note: We don't check cache here because cache only has minimal info (title, epub path)
-	// but preview needs full details (authors, description, cover, etc.)
+	// A full O'Reilly URL can be passed as ?url=... since it cannot be a path segment
+	input := vars["id"]
+	if rawURL := r.URL.Query().Get("url"); rawURL != "" {
+		input = rawURL
+	}
+
+	bookID, err := oreilly.ParseBookID(input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Repeated previews (e.g. auto-preview on keystroke) are served from memory
+	if cached := getCachedPreview(bookID); cached != nil {
+		log.Printf("[BookInfo] Serving recent preview from memory: %s", bookID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bookInfoResponse(cached, false))
+		return
+	}
+
+	// Limit concurrent previews so they can't trip O'Reilly rate limits
+	if !tryAcquirePreviewSlot() {
+		log.Printf("[BookInfo] Rejecting preview for %s: too many concurrent previews", bookID)
+		w.Header().Set("Retry-After", "2")
+		writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many preview requests, please retry shortly")
+		return
+	}
+	defer releasePreviewSlot()
+
+	// Always try O'Reilly first; cached metadata is only a fallback for outages
 	log.Printf("[BookInfo] Fetching full book info from O'Reilly: %s", bookID)
 	
-	// Create a temporary client just to fetch book info
-	client, err := oreilly.NewClient(bookID, cookiesPath, nil)
+	// Create a temporary client just to fetch book info (its login retries end with the request)
+	client, err := oreilly.NewClientContext(r.Context(), bookID, CookiesPath, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"Failed to connect: %s"}`, err.Error()), http.StatusInternalServerError)
+		if writeStaleBookInfo(w, bookID, err) {
+			return
+		}
+		code, msg := classifyError(err)
+		status := http.StatusInternalServerError
+		if code == ErrCodeAuthFailed || code == ErrCodeSubscriptionExpired {
+			status = http.StatusUnauthorized
+		}
+		writeError(w, status, code, fmt.Sprintf("Failed to connect: %s", msg))
 		return
 	}
 
@@ -608,17 +1494,29 @@ func GetBookInfoHandler(w http.ResponseWriter, r *http.Request) {
 		// Check if it's a "book not found" error (status 404 from API)
 		if strings.Contains(err.Error(), "book not found") || strings.Contains(err.Error(), "status: 404") {
 			log.Printf("[BookInfo] Book not found on O'Reilly: %s", bookID)
-			http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+			writeError(w, http.StatusNotFound, ErrCodeBookNotFound, "Book not found")
 			return
 		}
 		log.Printf("[BookInfo] Error fetching book info: %v", err)
-		http.Error(w, fmt.Sprintf(`{"error":"Failed to fetch book info: %s"}`, err.Error()), http.StatusInternalServerError)
+		if writeStaleBookInfo(w, bookID, err) {
+			return
+		}
+		code, _ := classifyError(err)
+		writeError(w, http.StatusInternalServerError, code, fmt.Sprintf("Failed to fetch book info: %s", err.Error()))
 		return
 	}
 
 	bookInfo := client.GetBookInfoData()
 	log.Printf("[BookInfo] Successfully fetched: %s", bookInfo.Title)
-	
+	storeBookPreview(bookID, bookInfo)
+	setCachedPreview(bookID, bookInfo)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookInfoResponse(bookInfo, false))
+}
+
+// bookInfoResponse builds the preview JSON for a book
+func bookInfoResponse(bookInfo *models.BookInfo, stale bool) map[string]interface{} {
 	// Build authors string
 	authors := []string{}
 	for _, author := range bookInfo.Authors {
@@ -631,7 +1529,11 @@ func GetBookInfoHandler(w http.ResponseWriter, r *http.Request) {
 		publishers = append(publishers, pub.Name)
 	}
 
-	response := map[string]interface{}{
+	// Companion audio listed in the book info (chapter audio is only known after a download)
+	audio := []string{}
+	audio = append(audio, bookInfo.AudioURLs...)
+
+	return map[string]interface{}{
 		"id":          bookInfo.ID,
 		"title":       bookInfo.Title,
 		"authors":     authors,
@@ -640,6 +1542,147 @@ func GetBookInfoHandler(w http.ResponseWriter, r *http.Request) {
 		"publishers":  publishers,
 		"issued":      bookInfo.Issued,
 		"isbn":        bookInfo.ISBN,
+		"audio":       audio,
+		"stale":       stale,
+	}
+}
+
+// storeBookPreview caches full book metadata for use when O'Reilly is unreachable
+func storeBookPreview(bookID string, bookInfo *models.BookInfo) {
+	if RedisClient == nil || bookInfo == nil {
+		return
+	}
+	if err := RedisClient.SetBookPreview(bookID, bookInfo); err != nil {
+		log.Printf("[Cache] ERROR: Failed to cache book preview: %v", err)
+	}
+}
+
+// writeStaleBookInfo serves cached metadata (marked stale) after a failed live fetch.
+// Returns false if nothing is cached for the book.
+func writeStaleBookInfo(w http.ResponseWriter, bookID string, fetchErr error) bool {
+	if RedisClient == nil {
+		return false
+	}
+
+	bookInfo, err := RedisClient.GetBookPreview(bookID)
+	if err != nil || bookInfo == nil {
+		// Fall back to the minimal download cache entry (title/ISBN only)
+		cachedInfo, err := RedisClient.GetBookInfo(bookID, cache.DefaultFormat)
+		if err != nil || cachedInfo == nil {
+			return false
+		}
+		bookInfo = &models.BookInfo{
+			ID:    bookID,
+			Title: cachedInfo.BookTitle,
+			ISBN:  cachedInfo.ISBN,
+		}
+	}
+
+	log.Printf("[BookInfo] Live fetch failed (%v), serving stale metadata for %s", fetchErr, bookID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookInfoResponse(bookInfo, true))
+	return true
+}
+
+// GetBookLinkHandler returns a fresh presigned URL for an already stored book
+// without starting a download (404 if the book isn't stored in that format),
+// plus one for every other cached format under "formats"
+func GetBookLinkHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	bookID, err := oreilly.ParseBookID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	format, err := parseStoredFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	prefix, err := storage.ValidatePrefix(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	bucket, err := parseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// A preview-only server hands out full books to administrators only
+	if preview, _ := previewRequested(r, false); preview {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Full books are only available to administrators on this server")
+		return
+	}
+
+	if MinIOClient == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeStorageUnavailable, "Storage service unavailable")
+		return
+	}
+
+	// Redis knows the exact object, otherwise look for one in the book's folder
+	var objectName, bookTitle, isbn string
+	var size int64
+	store := storageFor(bucket)
+	if RedisClient != nil {
+		if cachedInfo, err := RedisClient.GetBookInfo(cache.BucketScopedID(bucket, prefix, bookID), format); err == nil && cachedInfo != nil && cachedInfo.EpubPath != "" {
+			store = entryStorage(cachedInfo)
+			isbn = cachedInfo.ISBN
+			objectName = cachedInfo.EpubPath
+			bookTitle = cachedInfo.BookTitle
+			size = cachedInfo.EpubSize
+		}
+	}
+	if objectName == "" {
+		exists, name, objectSize, err := store.FileExists(prefix, bookID, outputFormats[format].Extension)
+		if err != nil {
+			log.Printf("[Link] ERROR: Failed to look up %s (%s): %v", bookID, format, err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeStorageUnavailable, "Failed to check storage")
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeBookNotFound, fmt.Sprintf("Book %s is not stored as %s", bookID, strings.ToUpper(format)))
+			return
+		}
+		objectName = name
+		size = objectSize
+	}
+
+	// Stored copies are subject to the allow/deny lists like new downloads
+	if reason, decided := checkCachedBookPolicy(bookID, isbn); reason != "" || !decided {
+		if reason == "" {
+			reason = fmt.Sprintf("book %s must be checked against the subject rules, request it through /api/download", bookID)
+		}
+		log.Printf("[Policy] Denied link to %s: %s", bookID, reason)
+		writeError(w, http.StatusForbidden, ErrCodeBookNotAllowed, "Download not allowed: "+reason)
+		return
+	}
+
+	presignedURL, err := store.GetPresignedURL(objectName, PresignedURLExpiry.Get())
+	if err != nil {
+		log.Printf("[Link] ERROR: Failed to generate URL for %s: %v", objectName, err)
+		writeError(w, http.StatusServiceUnavailable, ErrCodeStorageUnavailable, "Failed to generate download URL")
+		return
+	}
+
+	log.Printf("[Link] Generated fresh %s URL for %s", strings.ToUpper(format), bookID)
+	response := map[string]interface{}{
+		"book_id":    bookID,
+		"format":     format,
+		"url":        presignedURL,
+		"file_size":  size,
+		"expires_at": time.Now().Add(PresignedURLExpiry.Get()),
+	}
+	if bookTitle != "" {
+		response["book_title"] = bookTitle
+	}
+	if links := cachedFormatLinks(cache.BucketScopedID(bucket, prefix, bookID)); len(links) > 0 {
+		response["formats"] = links
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -648,12 +1691,13 @@ func GetBookInfoHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetStatsHandler returns server statistics and concurrency info
 func GetStatsHandler(w http.ResponseWriter, r *http.Request) {
-	downloadsLock.RLock()
-	totalDownloads := len(downloads)
+	list := downloads.List()
+	totalDownloads := len(list)
 	
 	var activeCount, completedCount, errorCount, queuedCount int
-	for _, download := range downloads {
-		switch download.Status {
+	for _, download := range list {
+		status, _, _ := download.GetStatus()
+		switch status {
 		case "downloading":
 			activeCount++
 		case "completed":
@@ -664,14 +1708,10 @@ func GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 			queuedCount++
 		}
 	}
-	downloadsLock.RUnlock()
 	
-	// Get semaphore capacities
-	downloadSlots := cap(downloadSemaphore)
+	// Get semaphore capacities and current usage
+	downloadSlotsTotal, downloadSlotsUsed, downloadSlotsWaiting := downloadSlots.stats()
 	conversionSlots := cap(conversionSemaphore)
-	
-	// Get current usage
-	downloadSlotsUsed := len(downloadSemaphore)
 	conversionSlotsUsed := len(conversionSemaphore)
 	
 	stats := map[string]interface{}{
@@ -680,26 +1720,54 @@ func GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 		"completed_downloads":    completedCount,
 		"failed_downloads":       errorCount,
 		"queued_downloads":       queuedCount,
-		"download_slots_total":   downloadSlots,
+		"download_slots_total":   downloadSlotsTotal,
 		"download_slots_used":    downloadSlotsUsed,
-		"download_slots_free":    downloadSlots - downloadSlotsUsed,
+		"download_slots_free":    downloadSlotsTotal - downloadSlotsUsed,
+		"download_slots_waiting": downloadSlotsWaiting,
 		"conversion_slots_total": conversionSlots,
 		"conversion_slots_used":  conversionSlotsUsed,
 		"conversion_slots_free":  conversionSlots - conversionSlotsUsed,
 		"redis_enabled":          RedisClient != nil,
 		"minio_enabled":          MinIOClient != nil,
-		"presigned_url_expiry_hours": int(PresignedURLExpiry.Hours()),
+		"calibre_available":      calibreAvailable,
+		"queue_depth":            currentQueueDepth(),
+		"max_queue_depth":        MaxQueueDepth.Get(),
+		"profile_active_downloads": profileSlots.activeCounts(),
+		"max_downloads_per_profile": MaxDownloadsPerProfile,
+		"upload_slots_total":     cap(uploadSemaphore),
+		"upload_slots_used":      len(uploadSemaphore),
+		"upload_slots_free":      cap(uploadSemaphore) - len(uploadSemaphore),
+		"preview_slots_total":    cap(previewSemaphore),
+		"preview_slots_used":     len(previewSemaphore),
+		"presigned_url_expiry_hours": int(PresignedURLExpiry.Get().Hours()),
+		"sse_connections":        atomic.LoadInt64(&sseConnections),
+		"max_sse_connections":    MaxSSEConnections.Get(),
+		"prefetch":               prefetchStats(),
+		"tmp_reserved_bytes":     tmpSpace.stats(),
+		"tmp_max_bytes":          TmpMaxBytes,
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
-// StreamDownloadStatusHandler handles SSE connections for real-time download progress
+// StreamDownloadStatusHandler handles SSE connections for real-time download
+// progress. Every event carries an id, so a reconnecting EventSource resumes
+// via Last-Event-ID.
 func StreamDownloadStatusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	downloadID := vars["id"]
 	
+	// Cap the total number of open streams
+	if open, limit := atomic.AddInt64(&sseConnections, 1), MaxSSEConnections.Get(); limit > 0 && open > int64(limit) {
+		atomic.AddInt64(&sseConnections, -1)
+		log.Printf("[SSE] Rejecting stream for %s: %d connections open", downloadID, open-1)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, ErrCodeRateLimited, "Too many open progress streams, please retry later or poll /api/status")
+		return
+	}
+	defer atomic.AddInt64(&sseConnections, -1)
+	
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -709,39 +1777,58 @@ func StreamDownloadStatusHandler(w http.ResponseWriter, r *http.Request) {
 	// Get flusher
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeStreamingUnsupported, "Streaming unsupported")
 		return
 	}
 	
 	// Get download
-	downloadsLock.RLock()
-	download, exists := downloads[downloadID]
-	downloadsLock.RUnlock()
+	download, exists := downloads.Get(downloadID)
 	
 	if !exists {
 		// Send error event
-		fmt.Fprintf(w, "data: {\"error\":\"Download ID not found\"}\n\n")
+		if data, err := json.Marshal(ErrorResponse{
+			Code:    ErrCodeDownloadNotFound,
+			Message: "Download ID not found",
+			Error:   "Download ID not found",
+		}); err == nil {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
 		flusher.Flush()
 		return
 	}
 	
 	// Create client channel
 	client := make(chan models.DownloadUpdate, 10)
-	download.AddSSEClient(client)
+	if limit := MaxSSEClientsPerDownload.Get(); !download.TryAddSSEClient(client, limit) {
+		log.Printf("[SSE] Rejecting stream for %s: %d clients already connected", downloadID, limit)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, ErrCodeRateLimited, "Too many progress streams for this download")
+		return
+	}
 	defer download.RemoveSSEClient(client)
 	
-	// Send initial state immediately
-	status, message, progress := download.GetStatus()
-	initialUpdate := models.DownloadUpdate{
-		Status:   status,
-		Progress: progress,
-		Message:  message,
+	// Send the current state immediately (taken after registering, so no update
+	// falls between it and the channel). A reconnecting client (Last-Event-ID)
+	// only gets it when it has missed something; one that already saw the
+	// final event is told to stop reconnecting.
+	current := download.Snapshot()
+	lastEventID, resumed := parseLastEventID(r)
+	if resumed {
+		log.Printf("[SSE] Client resumed download %s at event %d (current %d)", downloadID, lastEventID, current.ID)
 	}
-	
-	if data, err := json.Marshal(initialUpdate); err == nil {
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
+	if resumed && lastEventID >= current.ID && current.Finished() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !resumed || lastEventID < current.ID {
+		if writeSSEUpdate(w, current) {
+			flusher.Flush()
+		}
+	}
+	if current.Finished() {
+		return
 	}
+	lastSent := current.ID
 	
 	// Listen for updates or client disconnect
 	ctx := r.Context()
@@ -754,18 +1841,20 @@ func StreamDownloadStatusHandler(w http.ResponseWriter, r *http.Request) {
 			return
 			
 		case update := <-client:
-			// Send update to client
-			data, err := json.Marshal(update)
-			if err != nil {
-				log.Printf("[SSE] Error marshaling update: %v", err)
+			// Already covered by the state sent on connect
+			if update.ID <= lastSent {
 				continue
 			}
+			lastSent = update.ID
 			
-			fmt.Fprintf(w, "data: %s\n\n", data)
+			// Send update to client
+			if !writeSSEUpdate(w, update) {
+				continue
+			}
 			flusher.Flush()
 			
 			// If completed or error, close after sending
-			if update.Status == "completed" || update.Status == "error" {
+			if update.Finished() {
 				log.Printf("[SSE] Download %s finished with status: %s", downloadID, update.Status)
 				return
 			}
@@ -773,3 +1862,44 @@ func StreamDownloadStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+
+// GetDownloadLogsHandler returns the captured log lines of a download
+func GetDownloadLogsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	downloadID := vars["id"]
+
+	download, exists := downloads.Get(downloadID)
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeDownloadNotFound, "Download ID not found")
+		return
+	}
+
+	response := map[string]interface{}{
+		"download_id": downloadID,
+		"book_id":     download.BookID,
+		"logs":        download.GetLogs(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReadyHandler reports whether the server and its dependencies are ready to serve downloads
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	// Downloads cannot complete without storage, Redis and Calibre are optional
+	ready := MinIOClient != nil
+
+	response := map[string]interface{}{
+		"ready":             ready,
+		"redis_enabled":     RedisClient != nil,
+		"minio_enabled":     MinIOClient != nil,
+		"calibre_available": calibreAvailable,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
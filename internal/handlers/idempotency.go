@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+
+	"goreilly/internal/cache"
+	"goreilly/internal/models"
+)
+
+// maxIdempotencyKeyLength caps the Idempotency-Key header (UUIDs and similar tokens fit easily)
+const maxIdempotencyKeyLength = 255
+
+// scopeIdempotencyKey qualifies a client's Idempotency-Key with who sent it:
+// a hash of its Authorization header, or else its IP address, and the object
+// prefix (tenant). Empty keys stay empty.
+func scopeIdempotencyKey(r *http.Request, prefix, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	client := "ip:" + r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = "ip:" + host
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		client = "auth:" + hex.EncodeToString(sum[:8])
+	}
+	return client + ":" + cache.ScopedID(prefix, key)
+}
+
+// claimIdempotencyKey maps an Idempotency-Key to a new download ID. When the key
+// already belongs to a download that is still tracked, that download is returned
+// instead. Without Redis (or a key) every request starts its own download.
+func claimIdempotencyKey(key, downloadID string) *models.Download {
+	if key == "" || RedisClient == nil {
+		return nil
+	}
+
+	existingID, err := RedisClient.ReserveIdempotencyKey(key, downloadID)
+	if err != nil {
+		log.Printf("[Idempotency] WARNING: Failed to reserve key: %v", err)
+		return nil
+	}
+	if existingID == "" {
+		return nil
+	}
+
+	existing, exists := downloads.Get(existingID)
+	if exists {
+		return existing
+	}
+
+	// The original download has been cleaned up from memory, start over
+	if err := RedisClient.SetIdempotencyKey(key, downloadID); err != nil {
+		log.Printf("[Idempotency] WARNING: Failed to update key: %v", err)
+	}
+	return nil
+}
+
+// releaseIdempotencyKey frees a key whose request was rejected, so a retry can start the download
+func releaseIdempotencyKey(key string) {
+	if key == "" || RedisClient == nil {
+		return
+	}
+	if err := RedisClient.ReleaseIdempotencyKey(key); err != nil {
+		log.Printf("[Idempotency] WARNING: Failed to release key: %v", err)
+	}
+}
+
+// writeIdempotentReplay answers a repeated request with the download it already started
+func writeIdempotentReplay(w http.ResponseWriter, download *models.Download) {
+	var status string
+	var cached bool
+	download.Read(func(d *models.Download) {
+		status, cached = d.Status, d.Cached
+	})
+	log.Printf("[Idempotency] Replaying download %s (%s)", download.ID, status)
+
+	code := http.StatusAccepted
+	if status == "completed" {
+		code = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"download_id": download.ID,
+		"status":      status,
+		"cached":      cached,
+		"replayed":    true,
+	})
+}
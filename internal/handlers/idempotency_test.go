@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScopeIdempotencyKey(t *testing.T) {
+	alice := httptest.NewRequest("POST", "/api/download", nil)
+	alice.RemoteAddr = "203.0.113.7:51000"
+	aliceAgain := httptest.NewRequest("POST", "/api/download", nil)
+	aliceAgain.RemoteAddr = "203.0.113.7:52000"
+	bob := httptest.NewRequest("POST", "/api/download", nil)
+	bob.RemoteAddr = "198.51.100.2:51000"
+
+	if scopeIdempotencyKey(alice, "", "") != "" {
+		t.Error("an empty key must stay empty")
+	}
+	if scopeIdempotencyKey(alice, "", "k1") != scopeIdempotencyKey(aliceAgain, "", "k1") {
+		t.Error("the same client (another port) got a different scope")
+	}
+	if scopeIdempotencyKey(alice, "", "k1") == scopeIdempotencyKey(bob, "", "k1") {
+		t.Error("two clients share an Idempotency-Key")
+	}
+	if scopeIdempotencyKey(alice, "team-a", "k1") == scopeIdempotencyKey(alice, "team-b", "k1") {
+		t.Error("two prefixes share an Idempotency-Key")
+	}
+
+	// A token identifies the client wherever it connects from
+	alice.Header.Set("Authorization", "Bearer alice-token")
+	bob.Header.Set("Authorization", "Bearer alice-token")
+	if scopeIdempotencyKey(alice, "", "k1") != scopeIdempotencyKey(bob, "", "k1") {
+		t.Error("the same token got different scopes")
+	}
+	bob.Header.Set("Authorization", "Bearer bob-token")
+	if scopeIdempotencyKey(alice, "", "k1") == scopeIdempotencyKey(bob, "", "k1") {
+		t.Error("two tokens share an Idempotency-Key")
+	}
+}
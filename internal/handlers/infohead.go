@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"goreilly/internal/oreilly"
+)
+
+// HeadBookInfoHandler answers HEAD /api/book/{id}/info from memory and Redis
+// only: 200 if the book is known (its info was fetched or it was downloaded
+// before), 404 otherwise. X-Cached tells whether a copy is stored in ?format=
+// (default DEFAULT_FORMAT) and X-Cached-Formats lists every stored format.
+func HeadBookInfoHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	input := vars["id"]
+	if rawURL := r.URL.Query().Get("url"); rawURL != "" {
+		input = rawURL
+	}
+	bookID, err := oreilly.ParseBookID(input)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	format, err := parseStoredFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	known := getCachedPreview(bookID) != nil
+	var formats []string
+	if RedisClient != nil {
+		if formats, err = RedisClient.GetBookFormats(bookID); err != nil {
+			log.Printf("[BookInfo] ERROR: Failed to look up cached formats of %s: %v", bookID, err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if !known && len(formats) == 0 {
+			info, err := RedisClient.GetBookPreview(bookID)
+			known = err == nil && info != nil
+		}
+	}
+
+	cached := false
+	for _, f := range formats {
+		if f == format {
+			cached = true
+		}
+	}
+
+	w.Header().Set("X-Cached", strconv.FormatBool(cached))
+	if len(formats) > 0 {
+		w.Header().Set("X-Cached-Formats", strings.Join(formats, ","))
+	}
+	if !known && len(formats) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
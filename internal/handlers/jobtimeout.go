@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// JobTimeout caps how long a download job may run once it has its slot,
+// covering download, conversion and upload (0 = no limit, reloadable)
+var JobTimeout Setting[time.Duration]
+
+// jobTimedOutMessage is the error of jobs cancelled by JobTimeout
+const jobTimedOutMessage = "Download timed out"
+
+// newJobContext returns the context that cancels a job after JobTimeout
+func newJobContext() (context.Context, context.CancelFunc) {
+	timeout := JobTimeout.Get()
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+// calibreOutputProfiles are the values ebook-convert accepts for --output-profile
+var calibreOutputProfiles = []string{
+	"default", "cybookg3", "cybook_opus", "galaxy", "generic_eink", "generic_eink_hd",
+	"generic_eink_large", "hanlinv3", "hanlinv5", "illiad", "ipad", "ipad3", "irexdr1000",
+	"irexdr800", "jetbook5", "kindle", "kindle_dx", "kindle_fire", "kindle_oasis", "kindle_pw",
+	"kindle_pw3", "kindle_scribe", "kindle_voyage", "kobo", "msreader", "mobipocket", "nook",
+	"nook_color", "nook_hd_plus", "pocketbook_900", "pocketbook_pro_912", "sony", "sony300",
+	"sony900", "sony-landscape", "sonyt3", "tablet",
+}
+
+// DefaultOutputProfile is the Calibre output profile of requests that don't pick
+// one (empty = let Calibre decide); cached books are built with it
+var DefaultOutputProfile string
+
+// SetDefaultOutputProfile validates and sets the server-wide output profile
+func SetDefaultOutputProfile(profile string) error {
+	profile, err := normalizeOutputProfile(profile)
+	if err != nil {
+		return err
+	}
+	DefaultOutputProfile = profile
+	return nil
+}
+
+// parseOutputProfile validates a requested output profile, falling back to
+// DefaultOutputProfile when none was given
+func parseOutputProfile(profile string) (string, error) {
+	profile, err := normalizeOutputProfile(profile)
+	if err != nil {
+		return "", err
+	}
+	if profile == "" {
+		return DefaultOutputProfile, nil
+	}
+	if !calibreAvailable {
+		return "", fmt.Errorf("output_profile requires Calibre, which is not installed on this server")
+	}
+	return profile, nil
+}
+
+// normalizeOutputProfile lowercases a profile name and checks it is known to Calibre
+func normalizeOutputProfile(profile string) (string, error) {
+	profile = strings.ToLower(strings.TrimSpace(profile))
+	if profile == "" {
+		return "", nil
+	}
+	for _, known := range calibreOutputProfiles {
+		if profile == known {
+			return profile, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output profile %q (available: %s)", profile, strings.Join(calibreOutputProfiles, ", "))
+}
+
+// customOutputProfile reports whether a download is converted with another
+// profile than the cached copies (CBZ never goes through Calibre)
+func customOutputProfile(options models.DownloadOptions) bool {
+	return options.Format != "cbz" && options.OutputProfile != DefaultOutputProfile
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"goreilly/internal/cache"
+	"goreilly/internal/oreilly"
+	"goreilly/internal/storage"
+)
+
+// CacheListHandler lists every cached book entry with its pinned flag, plus the
+// pinned book IDs (pins of books not cached yet included). Requires the admin token.
+func CacheListHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if RedisClient == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Redis is not available")
+		return
+	}
+
+	books, err := RedisClient.ListBooks()
+	if err != nil {
+		log.Printf("[Admin] ERROR: Failed to list cache entries: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to list cache entries: "+err.Error())
+		return
+	}
+	pinned, err := RedisClient.PinnedBooks()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to list pinned books: "+err.Error())
+		return
+	}
+	if books == nil {
+		books = []cache.BookCacheInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"books":  books,
+		"total":  len(books),
+		"pinned": pinned,
+	})
+}
+
+// PinBookHandler pins (PUT) or unpins (DELETE) a book: pinned entries never
+// expire and cache flushes keep them unless forced. ?prefix= selects a tenant's
+// copy and ?bucket= one stored in an allowed bucket. Requires the admin token.
+func PinBookHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	bookID, err := oreilly.ParseBookID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	prefix, err := storage.ValidatePrefix(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	bucket, err := parseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if RedisClient == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Redis is not available")
+		return
+	}
+
+	pin := r.Method != http.MethodDelete
+	scopedID := cache.BucketScopedID(bucket, prefix, bookID)
+	if pin {
+		err = RedisClient.PinBook(scopedID)
+	} else {
+		err = RedisClient.UnpinBook(scopedID)
+	}
+	if err != nil {
+		log.Printf("[Admin] ERROR: Failed to update pin of %s: %v", scopedID, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update pin: "+err.Error())
+		return
+	}
+
+	formats, err := RedisClient.GetBookFormats(scopedID)
+	if err != nil {
+		formats = nil
+	}
+	if formats == nil {
+		formats = []string{}
+	}
+
+	log.Printf("[Admin] Book %s pinned=%t by %s", scopedID, pin, r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"book_id": bookID,
+		"prefix":  prefix,
+		"pinned":  pin,
+		"formats": formats,
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"goreilly/internal/models"
+)
+
+// BookPolicy restricts which books may be downloaded. Deny rules win; when any
+// allow list is set, a book must match an allowed ID/ISBN or subject.
+type BookPolicy struct {
+	AllowIDs      []string `json:"allow_ids"`
+	DenyIDs       []string `json:"deny_ids"`
+	AllowSubjects []string `json:"allow_subjects"`
+	DenySubjects  []string `json:"deny_subjects"`
+}
+
+// bookPolicy is loaded by LoadBookPolicy at startup and on reload (nil = every book allowed)
+var bookPolicy atomic.Pointer[BookPolicy]
+
+// LoadBookPolicy reads the allow/deny lists from a JSON file ("" disables the
+// policy). On error the current policy stays in place.
+func LoadBookPolicy(path string) error {
+	if path == "" {
+		bookPolicy.Store(nil)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read book policy: %w", err)
+	}
+
+	var policy BookPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("invalid book policy %s: %w", path, err)
+	}
+
+	log.Printf("[Policy] Loaded %s: %d allowed / %d denied IDs, %d allowed / %d denied subjects",
+		path, len(policy.AllowIDs), len(policy.DenyIDs), len(policy.AllowSubjects), len(policy.DenySubjects))
+	bookPolicy.Store(&policy)
+	return nil
+}
+
+// checkBookPolicy returns why a book may not be downloaded ("" if allowed)
+func checkBookPolicy(bookID string, info *models.BookInfo) string {
+	policy := bookPolicy.Load()
+	if policy == nil {
+		return ""
+	}
+
+	ids := []string{bookID}
+	var subjects []string
+	if info != nil {
+		if info.ISBN != "" {
+			ids = append(ids, info.ISBN)
+		}
+		for _, subject := range info.Subjects {
+			subjects = append(subjects, subject.Name)
+		}
+	}
+
+	if id := firstMatch(ids, policy.DenyIDs); id != "" {
+		return fmt.Sprintf("book %s is not allowed on this server", id)
+	}
+	if subject := firstMatch(subjects, policy.DenySubjects); subject != "" {
+		return fmt.Sprintf("books on %q are not allowed on this server", subject)
+	}
+
+	if len(policy.AllowIDs) == 0 && len(policy.AllowSubjects) == 0 {
+		return ""
+	}
+	if firstMatch(ids, policy.AllowIDs) != "" || firstMatch(subjects, policy.AllowSubjects) != "" {
+		return ""
+	}
+	return fmt.Sprintf("book %s is not on this server's allowlist", bookID)
+}
+
+// firstMatch returns the first value found in list (case-insensitive)
+func firstMatch(values, list []string) string {
+	for _, value := range values {
+		for _, item := range list {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// checkCachedBookPolicy applies the policy to a book about to be served from
+// storage, without fetching its info from O'Reilly. Subjects come from the
+// cached preview when there is one. decided is false when only a subject rule
+// could tell and no subjects are known; the caller must then not serve the
+// stored copy (a fresh download fetches the info and checks it fully).
+func checkCachedBookPolicy(bookID, isbn string) (reason string, decided bool) {
+	policy := bookPolicy.Load()
+	if policy == nil {
+		return "", true
+	}
+
+	info := &models.BookInfo{ISBN: isbn}
+	if RedisClient != nil {
+		if preview, err := RedisClient.GetBookPreview(bookID); err == nil && preview != nil {
+			info = preview
+			if info.ISBN == "" {
+				info.ISBN = isbn
+			}
+		}
+	}
+	if len(info.Subjects) > 0 || (len(policy.AllowSubjects) == 0 && len(policy.DenySubjects) == 0) {
+		return checkBookPolicy(bookID, info), true
+	}
+
+	// Subject rules can't be evaluated, only the ID lists
+	ids := []string{bookID}
+	if info.ISBN != "" {
+		ids = append(ids, info.ISBN)
+	}
+	if id := firstMatch(ids, policy.DenyIDs); id != "" {
+		return fmt.Sprintf("book %s is not allowed on this server", id), true
+	}
+	if firstMatch(ids, policy.AllowIDs) != "" && len(policy.DenySubjects) == 0 {
+		return "", true
+	}
+	return "", false
+}
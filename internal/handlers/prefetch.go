@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"goreilly/internal/models"
+	"goreilly/internal/oreilly"
+)
+
+// maxPrefetchBooks caps the number of book IDs in one prefetch request
+const maxPrefetchBooks = 100
+
+var (
+	// Semaphore limiting concurrent prefetch downloads (they also need a download slot)
+	prefetchSemaphore = make(chan struct{}, 1)
+
+	// Prefetch progress (updated atomically)
+	prefetchWaiting   int64
+	prefetchActive    int64
+	prefetchCompleted int64
+	prefetchFailed    int64
+	prefetchSkipped   int64
+)
+
+// SetPrefetchConcurrency sets the maximum number of concurrent prefetch downloads
+func SetPrefetchConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	prefetchSemaphore = make(chan struct{}, n)
+}
+
+// PrefetchHandler warms the cache with a list of books. Prefetch downloads run at
+// background priority: interactive downloads waiting for a slot always go first.
+// Requires the admin token.
+func PrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		BookIDs []string `json:"book_ids"`
+		Format  string   `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request")
+		return
+	}
+	if len(req.BookIDs) == 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "book_ids is required")
+		return
+	}
+	if len(req.BookIDs) > maxPrefetchBooks {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("At most %d book IDs can be prefetched per request", maxPrefetchBooks))
+		return
+	}
+
+	format, err := parseFormat(req.Format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	queued := []map[string]string{}
+	cached := []string{}
+	inProgress := []string{}
+	invalid := []map[string]string{}
+
+	for _, rawID := range req.BookIDs {
+		bookID, err := oreilly.ParseBookID(rawID)
+		if err != nil {
+			invalid = append(invalid, map[string]string{"book_id": rawID, "error": err.Error()})
+			continue
+		}
+
+		if RedisClient != nil {
+			if info, err := RedisClient.GetBookInfo(bookID, format); err == nil && info != nil {
+				atomic.AddInt64(&prefetchSkipped, 1)
+				cached = append(cached, bookID)
+				continue
+			}
+		}
+		if downloadInProgress(bookID, format) {
+			inProgress = append(inProgress, bookID)
+			continue
+		}
+
+		downloadID := uuid.New().String()
+		downloads.Add(&models.Download{
+			ID:        downloadID,
+			BookID:    bookID,
+			Format:    format,
+			Status:    "queued",
+			Progress:  0,
+			Message:   "Waiting for an idle download slot (prefetch)...",
+			Timestamp: time.Now().Unix(),
+			Priority:  models.PriorityBackground,
+			Options: models.DownloadOptions{
+				Format:        format,
+				VerifyEPUB:    VerifyEPUBDefault,
+				OutputProfile: DefaultOutputProfile,
+				Prefetch:      true,
+			},
+		})
+
+		atomic.AddInt64(&prefetchWaiting, 1)
+		go runPrefetch(downloadID, bookID)
+		queued = append(queued, map[string]string{"book_id": bookID, "download_id": downloadID})
+	}
+
+	log.Printf("[Prefetch] Requested %d books (%s): %d queued, %d cached, %d in progress, %d invalid",
+		len(req.BookIDs), format, len(queued), len(cached), len(inProgress), len(invalid))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"format":      format,
+		"queued":      queued,
+		"cached":      cached,
+		"in_progress": inProgress,
+		"invalid":     invalid,
+	})
+}
+
+// downloadInProgress reports whether a book is already being downloaded in a format
+func downloadInProgress(bookID, format string) bool {
+	for _, download := range downloads.List() {
+		if download.BookID != bookID || download.Format != format {
+			continue
+		}
+		if status, _, _ := download.GetStatus(); status != "completed" && status != "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// runPrefetch runs a prefetch download and records its outcome
+func runPrefetch(downloadID, bookID string) {
+	downloadBookAsync(downloadID, bookID)
+
+	if download, exists := downloads.Get(downloadID); exists {
+		if status, _, _ := download.GetStatus(); status == "completed" {
+			atomic.AddInt64(&prefetchCompleted, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&prefetchFailed, 1)
+}
+
+// acquirePrefetchSlots waits for a prefetch slot, the profile slot and then a
+// download slot at the job's (background) priority, so interactive jobs
+// waiting for a download slot always go first. The profile slot is taken
+// before the download slot: a prefetch never holds a download slot while
+// waiting for its profile.
+func acquirePrefetchSlots(download *models.Download, profile string) func() {
+	prefetchSemaphore <- struct{}{}
+	releaseProfile := profileSlots.acquire(profile)
+	downloadSlots.acquire(download.ID, download.Priority)
+
+	atomic.AddInt64(&prefetchWaiting, -1)
+	atomic.AddInt64(&prefetchActive, 1)
+	log.Printf("[Prefetch] Download %s acquired slot", download.ID)
+	return func() {
+		atomic.AddInt64(&prefetchActive, -1)
+		downloadSlots.release()
+		releaseProfile()
+		<-prefetchSemaphore
+	}
+}
+
+// prefetchStats reports prefetch progress for the stats endpoint
+func prefetchStats() map[string]interface{} {
+	return map[string]interface{}{
+		"waiting":     atomic.LoadInt64(&prefetchWaiting),
+		"active":      atomic.LoadInt64(&prefetchActive),
+		"completed":   atomic.LoadInt64(&prefetchCompleted),
+		"failed":      atomic.LoadInt64(&prefetchFailed),
+		"cached":      atomic.LoadInt64(&prefetchSkipped),
+		"slots_total": cap(prefetchSemaphore),
+	}
+}
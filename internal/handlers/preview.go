@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+var (
+	// Semaphore for book info/preview requests (separate from downloads)
+	previewSemaphore = make(chan struct{}, 4)
+
+	// How long a fetched preview is reused before asking O'Reilly again
+	PreviewCacheTTL = 5 * time.Minute
+
+	previewCache     = make(map[string]previewCacheEntry)
+	previewCacheLock sync.Mutex
+)
+
+// previewCacheEntry is a recently fetched book preview
+type previewCacheEntry struct {
+	info      *models.BookInfo
+	fetchedAt time.Time
+}
+
+// SetPreviewConcurrency sets the maximum number of concurrent preview fetches
+func SetPreviewConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	previewSemaphore = make(chan struct{}, n)
+}
+
+// tryAcquirePreviewSlot takes a preview slot without blocking
+func tryAcquirePreviewSlot() bool {
+	select {
+	case previewSemaphore <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releasePreviewSlot frees a preview slot
+func releasePreviewSlot() {
+	<-previewSemaphore
+}
+
+// getCachedPreview returns a preview fetched within PreviewCacheTTL
+func getCachedPreview(bookID string) *models.BookInfo {
+	previewCacheLock.Lock()
+	defer previewCacheLock.Unlock()
+
+	entry, exists := previewCache[bookID]
+	if !exists {
+		return nil
+	}
+	if time.Since(entry.fetchedAt) > PreviewCacheTTL {
+		delete(previewCache, bookID)
+		return nil
+	}
+	return entry.info
+}
+
+// setCachedPreview remembers a freshly fetched preview and drops expired ones
+func setCachedPreview(bookID string, info *models.BookInfo) {
+	previewCacheLock.Lock()
+	defer previewCacheLock.Unlock()
+
+	now := time.Now()
+	for id, entry := range previewCache {
+		if now.Sub(entry.fetchedAt) > PreviewCacheTTL {
+			delete(previewCache, id)
+		}
+	}
+	previewCache[bookID] = previewCacheEntry{info: info, fetchedAt: now}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// Chapters included in a preview download (0 = preview downloads are disabled)
+	PreviewChapters int
+
+	// Turn every download into a preview unless the request carries the admin token
+	PreviewOnly bool
+)
+
+// previewRequested decides whether a download is a preview: requested by the
+// client, or forced for everyone but admins by PreviewOnly
+func previewRequested(r *http.Request, requested bool) (bool, error) {
+	if PreviewChapters <= 0 {
+		if requested {
+			return false, errors.New("Preview downloads are disabled on this server")
+		}
+		return false, nil
+	}
+	if PreviewOnly && !hasAdminToken(r) {
+		return true, nil
+	}
+	return requested, nil
+}
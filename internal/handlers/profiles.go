@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sync"
+
+	"goreilly/internal/oreilly"
+)
+
+// MaxDownloadsPerProfile caps concurrent downloads per cookie profile (0 = unlimited)
+var MaxDownloadsPerProfile int
+
+// profileSlots hands out per-profile download slots
+var profileSlots = &profileLimiter{
+	slots: make(map[string]chan struct{}),
+}
+
+// profileLimiter caps concurrent downloads per cookie profile so one account
+// cannot take every global download slot. Jobs over a profile's cap block on
+// that profile's channel only.
+type profileLimiter struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// channel returns (creating if needed) the slot channel of a profile
+func (l *profileLimiter) channel(profile string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch, exists := l.slots[profile]
+	if !exists {
+		ch = make(chan struct{}, MaxDownloadsPerProfile)
+		l.slots[profile] = ch
+	}
+	return ch
+}
+
+// acquire blocks until the profile has a free slot and returns its release func
+func (l *profileLimiter) acquire(profile string) func() {
+	if MaxDownloadsPerProfile <= 0 {
+		return func() {}
+	}
+
+	ch := l.channel(profile)
+	ch <- struct{}{}
+	return func() { <-ch }
+}
+
+// activeCounts returns the number of running downloads per profile
+func (l *profileLimiter) activeCounts() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int, len(l.slots))
+	for profile, ch := range l.slots {
+		counts[profile] = len(ch)
+	}
+	return counts
+}
+
+// cookieProfile names the cookie profile a download runs under (never the cookie values)
+func cookieProfile(cookiesPath string) string {
+	return filepath.Base(cookiesPath)
+}
+
+// clientProfile names the profile of a client: its cookie account when
+// rotating among CookiesDir, or the single cookies file
+func clientProfile(client *oreilly.Client) string {
+	if account := client.Account(); account != "" {
+		return account
+	}
+	return cookieProfile(CookiesPath)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+// jobDurationSamples is how many recent jobs the start time estimate averages
+const jobDurationSamples = 20
+
+var (
+	jobDurations     []time.Duration // Durations of the most recent successful jobs
+	jobDurationsLock sync.Mutex
+)
+
+// QueuedDownload is a download waiting for a slot, as listed by /api/queue
+type QueuedDownload struct {
+	DownloadID     string     `json:"download_id"`
+	BookID         string     `json:"book_id"`
+	Format         string     `json:"format,omitempty"`
+	Position       int        `json:"position"`
+	Priority       int        `json:"priority"`
+	Prefetch       bool       `json:"prefetch,omitempty"`
+	QueuedAt       time.Time  `json:"queued_at"`
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+}
+
+// RunningDownload is a download holding a slot, as listed by /api/queue
+type RunningDownload struct {
+	DownloadID string    `json:"download_id"`
+	BookID     string    `json:"book_id"`
+	Format     string    `json:"format,omitempty"`
+	Status     string    `json:"status"`
+	Progress   int       `json:"progress"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// startJob marks a download as running once it holds its slots
+func startJob(download *models.Download) {
+	download.Update(func(d *models.Download) {
+		d.StartedAt = time.Now()
+	})
+}
+
+// finishJob records how long a successful job took, for start time estimates
+func finishJob(download *models.Download) {
+	if status, _, _ := download.GetStatus(); status != "completed" {
+		return
+	}
+	var elapsed time.Duration
+	download.Update(func(d *models.Download) {
+		elapsed = time.Since(d.StartedAt)
+	})
+
+	jobDurationsLock.Lock()
+	defer jobDurationsLock.Unlock()
+	jobDurations = append(jobDurations, elapsed)
+	if len(jobDurations) > jobDurationSamples {
+		jobDurations = jobDurations[len(jobDurations)-jobDurationSamples:]
+	}
+}
+
+// averageJobDuration returns the mean duration of recent jobs (0 before the first one)
+func averageJobDuration() time.Duration {
+	jobDurationsLock.Lock()
+	defer jobDurationsLock.Unlock()
+
+	if len(jobDurations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range jobDurations {
+		total += d
+	}
+	return total / time.Duration(len(jobDurations))
+}
+
+// queueSnapshot lists the queued downloads in the order they will start (the
+// download slot's waiters first, then jobs still waiting for their profile or
+// prefetch slot, oldest first) and the running downloads
+func queueSnapshot() ([]QueuedDownload, []RunningDownload) {
+	waiting := downloadSlots.waitingIDs()
+
+	var queued []QueuedDownload
+	var running []RunningDownload
+	inSlotQueue := make(map[string]bool, len(waiting))
+	for _, id := range waiting {
+		inSlotQueue[id] = true
+		if download, exists := downloads.Get(id); exists {
+			download.Read(func(d *models.Download) {
+				queued = append(queued, queuedDownload(d))
+			})
+		}
+	}
+
+	var others []QueuedDownload
+	for _, download := range downloads.List() {
+		// The status and start time are read together, startJob sets StartedAt
+		// under the same lock
+		download.Read(func(d *models.Download) {
+			if d.Status == "completed" || d.Status == "error" || inSlotQueue[d.ID] {
+				return
+			}
+			if d.StartedAt.IsZero() {
+				others = append(others, queuedDownload(d))
+				return
+			}
+			running = append(running, RunningDownload{
+				DownloadID: d.ID,
+				BookID:     d.BookID,
+				Format:     d.Format,
+				Status:     d.Status,
+				Progress:   d.Progress,
+				StartedAt:  d.StartedAt,
+			})
+		})
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].QueuedAt.Before(others[j].QueuedAt) })
+	queued = append(queued, others...)
+	sort.Slice(running, func(i, j int) bool { return running[i].StartedAt.Before(running[j].StartedAt) })
+
+	for i := range queued {
+		queued[i].Position = i + 1
+	}
+	estimateStarts(queued, running)
+	return queued, running
+}
+
+// queuedDownload builds the queue entry of a download (callers hold its lock,
+// see Download.Read)
+func queuedDownload(download *models.Download) QueuedDownload {
+	return QueuedDownload{
+		DownloadID: download.ID,
+		BookID:     download.BookID,
+		Format:     download.Format,
+		Priority:   download.Priority,
+		Prefetch:   download.Options.Prefetch,
+		QueuedAt:   time.Unix(download.Timestamp, 0),
+	}
+}
+
+// estimateStarts fills in estimated start times, assuming every job takes the
+// recent average and each freed slot goes to the next queued download
+func estimateStarts(queued []QueuedDownload, running []RunningDownload) {
+	average := averageJobDuration()
+	if average == 0 || len(queued) == 0 {
+		return
+	}
+	capacity, _, _ := downloadSlots.stats()
+
+	now := time.Now()
+	freeAt := make([]time.Time, 0, capacity)
+	for _, job := range running {
+		done := job.StartedAt.Add(average)
+		if done.Before(now) {
+			done = now
+		}
+		freeAt = append(freeAt, done)
+	}
+	for len(freeAt) < capacity {
+		freeAt = append(freeAt, now)
+	}
+
+	for i := range queued {
+		sort.Slice(freeAt, func(a, b int) bool { return freeAt[a].Before(freeAt[b]) })
+		start := freeAt[0]
+		queued[i].EstimatedStart = &start
+		freeAt[0] = start.Add(average)
+	}
+}
+
+// queuePosition returns a download's 1-based place in the queue (0 if it isn't queued)
+func queuePosition(downloadID string) int {
+	queued, _ := queueSnapshot()
+	for _, entry := range queued {
+		if entry.DownloadID == downloadID {
+			return entry.Position
+		}
+	}
+	return 0
+}
+
+// QueueHandler lists the queued downloads in start order, with estimated start
+// times once a job has completed, and the running downloads
+func QueueHandler(w http.ResponseWriter, r *http.Request) {
+	queued, running := queueSnapshot()
+	if queued == nil {
+		queued = []QueuedDownload{}
+	}
+	if running == nil {
+		running = []RunningDownload{}
+	}
+	capacity, _, _ := downloadSlots.stats()
+
+	response := map[string]interface{}{
+		"queued":               queued,
+		"running":              running,
+		"queue_depth":          len(queued),
+		"max_queue_depth":      MaxQueueDepth.Get(),
+		"download_slots_total": capacity,
+	}
+	if average := averageJobDuration(); average > 0 {
+		response["average_job_seconds"] = int(average.Seconds())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
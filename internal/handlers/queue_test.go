@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+
+	"goreilly/internal/models"
+)
+
+// Listing the queue while jobs start must read StartedAt under the download's
+// lock (run with -race)
+func TestQueueSnapshotWhileStarting(t *testing.T) {
+	download := &models.Download{ID: "queue-race", BookID: "9781492052197", Status: "pending"}
+	downloads.Add(download)
+	defer downloads.Remove(download.ID)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		startJob(download)
+	}()
+	go func() {
+		defer wg.Done()
+		queueSnapshot()
+	}()
+	wg.Wait()
+
+	_, running := queueSnapshot()
+	if len(running) != 1 || running[0].DownloadID != download.ID {
+		t.Fatalf("running = %+v, want the started download", running)
+	}
+}
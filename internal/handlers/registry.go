@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+// DownloadRegistry holds the downloads known to this instance and owns the
+// locking of the map. Fields of a download are changed through its own methods
+// (UpdateStatus, Update, ...), never under the registry's lock, so the two
+// locks are never held together.
+type DownloadRegistry struct {
+	mu        sync.RWMutex
+	downloads map[string]*models.Download
+}
+
+// NewDownloadRegistry creates an empty registry
+func NewDownloadRegistry() *DownloadRegistry {
+	return &DownloadRegistry{downloads: make(map[string]*models.Download)}
+}
+
+// Add registers a download under its ID
+func (r *DownloadRegistry) Add(download *models.Download) {
+	r.mu.Lock()
+	r.downloads[download.ID] = download
+	r.mu.Unlock()
+}
+
+// Get returns a download by ID
+func (r *DownloadRegistry) Get(id string) (*models.Download, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	download, exists := r.downloads[id]
+	return download, exists
+}
+
+// Remove forgets a download, reporting whether it was registered
+func (r *DownloadRegistry) Remove(id string) bool {
+	r.mu.Lock()
+	download, exists := r.downloads[id]
+	delete(r.downloads, id)
+	r.mu.Unlock()
+
+	if exists {
+		status, _, _ := download.GetStatus()
+		log.Printf("[Cleanup] Removing download from memory: %s (Status: %s)", id, status)
+	}
+	return exists
+}
+
+// RemoveAfter forgets a download once clients have had time to fetch its final status
+func (r *DownloadRegistry) RemoveAfter(id string, delay time.Duration) {
+	go func() {
+		time.Sleep(delay)
+		r.Remove(id)
+	}()
+}
+
+// List returns a snapshot of the registered downloads (in no particular order)
+func (r *DownloadRegistry) List() []*models.Download {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*models.Download, 0, len(r.downloads))
+	for _, download := range r.downloads {
+		list = append(list, download)
+	}
+	return list
+}
+
+// Len returns the number of registered downloads
+func (r *DownloadRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.downloads)
+}
+
+// UpdateStatus updates the status of a download and notifies its SSE clients,
+// reporting whether the download is registered
+func (r *DownloadRegistry) UpdateStatus(id, status, message string, progress int) bool {
+	download, exists := r.Get(id)
+	if !exists {
+		return false
+	}
+	download.UpdateStatus(status, message, progress)
+	return true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"goreilly/internal/models"
+)
+
+// RetryDownloadHandler relaunches a failed download with the same book and
+// options. Failed downloads are kept for a couple of minutes (see SetError),
+// retrying the same failed download twice returns the first retry's ID.
+func RetryDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	downloadID := vars["id"]
+
+	failed, exists := downloads.Get(downloadID)
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeDownloadNotFound, "Download ID not found")
+		return
+	}
+
+	if status, _, _ := failed.GetStatus(); status != "error" {
+		writeError(w, http.StatusConflict, ErrCodeDownloadNotFailed, "Only failed downloads can be retried (status: "+status+")")
+		return
+	}
+
+	// Only the first retry of a failed download starts a job
+	retryID := uuid.New().String()
+	if existingID := failed.ClaimRetry(retryID); existingID != "" {
+		writeRetryResponse(w, existingID, downloadID, true)
+		return
+	}
+
+	if !enqueueDownload() {
+		// Let a later retry try again
+		failed.Update(func(d *models.Download) {
+			d.RetriedAs = ""
+		})
+		log.Printf("[Queue] Rejecting retry of %s: queue full (%d waiting)", downloadID, MaxQueueDepth.Get())
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter.Seconds())))
+		writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Server is busy, please retry later")
+		return
+	}
+
+	// A manual retry is an interactive download, even if the failed one was prefetched
+	options := failed.Options
+	options.Prefetch = false
+
+	downloads.Add(&models.Download{
+		ID:        retryID,
+		BookID:    failed.BookID,
+		Format:    failed.Format,
+		Status:    "starting",
+		Progress:  0,
+		Message:   "Initializing download...",
+		Timestamp: time.Now().Unix(),
+		Priority:  models.PriorityInteractive,
+		Options:   options,
+	})
+
+	log.Printf("[Download] Retrying %s (%s) as %s", failed.BookID, downloadID, retryID)
+	go downloadBookAsync(retryID, failed.BookID)
+
+	writeRetryResponse(w, retryID, downloadID, false)
+}
+
+// writeRetryResponse writes the 202 response of a (possibly already started) retry
+func writeRetryResponse(w http.ResponseWriter, retryID, failedID string, reused bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"download_id": retryID,
+		"retry_of":    failedID,
+		"reused":      reused,
+		"cached":      "false",
+	})
+}
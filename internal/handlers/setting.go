@@ -0,0 +1,23 @@
+package handlers
+
+import "sync/atomic"
+
+// Setting holds a configuration value that a reload (SIGHUP) may replace while
+// requests are reading it. The zero value holds T's zero value.
+type Setting[T any] struct {
+	value atomic.Pointer[T]
+}
+
+// Get returns the current value
+func (s *Setting[T]) Get() T {
+	if v := s.value.Load(); v != nil {
+		return *v
+	}
+	var zero T
+	return zero
+}
+
+// Set replaces the value
+func (s *Setting[T]) Set(value T) {
+	s.value.Store(&value)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+)
+
+// slotQueue is a counting semaphore that hands freed slots to the waiter with
+// the highest priority, first come first served within a priority
+type slotQueue struct {
+	mu       sync.Mutex
+	capacity int
+	used     int
+	nextSeq  uint64
+	waiters  []*slotWaiter
+}
+
+// slotWaiter is a job blocked in acquire
+type slotWaiter struct {
+	id       string // Download ID, for the queue listing
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// newSlotQueue creates a slot queue with n slots
+func newSlotQueue(n int) *slotQueue {
+	return &slotQueue{capacity: n}
+}
+
+// acquire blocks until a slot is handed to the job with this download ID
+func (q *slotQueue) acquire(id string, priority int) {
+	q.mu.Lock()
+	if q.used < q.capacity && len(q.waiters) == 0 {
+		q.used++
+		q.mu.Unlock()
+		return
+	}
+
+	waiter := &slotWaiter{id: id, priority: priority, seq: q.nextSeq, ready: make(chan struct{})}
+	q.nextSeq++
+	// Keep waiters ordered: highest priority first, then arrival order
+	i := sort.Search(len(q.waiters), func(i int) bool {
+		w := q.waiters[i]
+		return w.priority < priority || (w.priority == priority && w.seq > waiter.seq)
+	})
+	q.waiters = append(q.waiters, nil)
+	copy(q.waiters[i+1:], q.waiters[i:])
+	q.waiters[i] = waiter
+	q.mu.Unlock()
+
+	<-waiter.ready
+}
+
+// release frees a slot, passing it straight to the next waiter if there is one
+func (q *slotQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters) > 0 {
+		next := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		close(next.ready)
+		return
+	}
+	q.used--
+}
+
+// waitingIDs returns the download IDs of the waiting jobs, next in line first
+func (q *slotQueue) waitingIDs() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, len(q.waiters))
+	for i, w := range q.waiters {
+		ids[i] = w.id
+	}
+	return ids
+}
+
+// stats returns the number of slots, slots in use and jobs waiting
+func (q *slotQueue) stats() (capacity, used, waiting int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.capacity, q.used, len(q.waiters)
+}
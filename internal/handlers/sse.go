@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"goreilly/internal/models"
+)
+
+// parseLastEventID returns the Last-Event-ID a reconnecting SSE client sends
+// (EventSource does so automatically); ok is false on a first connect
+func parseLastEventID(r *http.Request) (int64, bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeSSEUpdate writes an update as an SSE event with its ID
+func writeSSEUpdate(w http.ResponseWriter, update models.DownloadUpdate) bool {
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("[SSE] Error marshaling update: %v", err)
+		return false
+	}
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", update.ID, data)
+	return true
+}
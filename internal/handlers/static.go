@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// spaEntryPoint is served for client-side routes of the web UI
+const spaEntryPoint = "index.html"
+
+// StaticHandler serves the frontend from content. GET requests for paths that
+// aren't files and have no extension (client-side routes such as /book/123) get
+// index.html so deep links work; unknown /api/ paths and missing assets stay 404.
+func StaticHandler(content fs.FS) http.Handler {
+	fileServer := http.FileServer(http.FS(content))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Unknown API endpoint")
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "."
+		}
+		if _, err := fs.Stat(content, name); err == nil ||
+			(r.Method != http.MethodGet && r.Method != http.MethodHead) || path.Ext(name) != "" {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		serveSPAEntryPoint(w, r, content)
+	})
+}
+
+// serveSPAEntryPoint writes index.html (404 if the frontend has none)
+func serveSPAEntryPoint(w http.ResponseWriter, r *http.Request, content fs.FS) {
+	data, err := fs.ReadFile(content, spaEntryPoint)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	modTime := time.Time{}
+	if info, err := fs.Stat(content, spaEntryPoint); err == nil {
+		modTime = info.ModTime()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, spaEntryPoint, modTime, bytes.NewReader(data))
+}
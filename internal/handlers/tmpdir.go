@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"goreilly/internal/models"
+	"goreilly/internal/oreilly"
+)
+
+// tmpSubdir is the dedicated directory created inside TMP_DIR; cleanup never leaves it
+const tmpSubdir = "goreilly"
+
+// Files this service leaves in tmpDir: converted books, extras bundles and TOCs
+var tmpFilePattern = regexp.MustCompile(`\.(epub|mobi|azw3|pdf|cbz)$|_extras\.zip$|_toc\.json$`)
+
+// jobTmpFile returns the path of a temporary file of a download job in tmpDir:
+// name, the download ID, then suffix. The ID keeps overlapping jobs for the
+// same book from removing or overwriting each other's files; uploads pass the
+// name without it (UploadOptions.Name).
+func jobTmpFile(download *models.Download, name, suffix string) string {
+	return filepath.Join(tmpDir, name+"_"+download.ID+suffix)
+}
+
+// Book build directories in the books subdirectory: "<title> (<book id>)_<download id>"
+// (without the download ID when built outside a download job)
+var bookDirPattern = regexp.MustCompile(`\([0-9A-Za-z_-]+\)(_[0-9a-f-]+)?$`)
+
+// SetupTmpDir points the working directories at a dedicated subdirectory of
+// base and removes leftovers of previous runs older than minAge. Only files
+// and directories matching the names this service creates are removed.
+func SetupTmpDir(base string, minAge time.Duration) error {
+	if base == "" {
+		base = os.TempDir()
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return fmt.Errorf("invalid tmp directory: %w", err)
+	}
+
+	tmpDir = filepath.Join(base, tmpSubdir)
+	oreilly.BooksDir = filepath.Join(tmpDir, "books")
+	if err := os.MkdirAll(oreilly.BooksDir, 0755); err != nil {
+		return fmt.Errorf("failed to create tmp directory: %w", err)
+	}
+
+	log.Printf("[Init] Cleaning leftovers older than %v in %s", minAge, tmpDir)
+	removed := removeStale(tmpDir, minAge, func(entry os.DirEntry) bool {
+		return !entry.IsDir() && tmpFilePattern.MatchString(entry.Name())
+	})
+	removed += removeStale(oreilly.BooksDir, minAge, func(entry os.DirEntry) bool {
+		return entry.IsDir() && bookDirPattern.MatchString(entry.Name())
+	})
+	log.Printf("[Init] Removed %d leftover tmp entries", removed)
+	return nil
+}
+
+// removeStale removes the entries of dir that match and are older than minAge
+func removeStale(dir string, minAge time.Duration, match func(os.DirEntry) bool) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("[Init] WARNING: Cannot read %s: %v", dir, err)
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < minAge {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("[Init] WARNING: Failed to remove %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"goreilly/internal/models"
+)
+
+// Overlapping jobs for the same book get their own converted file, extras
+// bundle and TOC, so one job's cleanup never removes the other's upload
+func TestJobTmpFilesSameBook(t *testing.T) {
+	tmpDir = t.TempDir()
+	first := &models.Download{ID: "11111111-aaaa", BookID: "9781492052197"}
+	second := &models.Download{ID: "22222222-bbbb", BookID: "9781492052197"}
+
+	names := []struct{ name, suffix string }{
+		{"Same_Book_9781492052197", ".epub"},
+		{"9781492052197", "_extras.zip"},
+		{"9781492052197", "_toc.json"},
+	}
+	for _, n := range names {
+		a, b := jobTmpFile(first, n.name, n.suffix), jobTmpFile(second, n.name, n.suffix)
+		if a == b {
+			t.Fatalf("%s%s: both jobs use %s", n.name, n.suffix, a)
+		}
+		if filepath.Dir(a) != tmpDir || !tmpFilePattern.MatchString(filepath.Base(a)) {
+			t.Errorf("%s is not a tmp file startup cleanup recognizes", a)
+		}
+	}
+
+	// Write both, then let the first job clean up while the second still needs its files
+	var wg sync.WaitGroup
+	for _, d := range []*models.Download{first, second} {
+		wg.Add(1)
+		go func(d *models.Download) {
+			defer wg.Done()
+			for _, n := range names {
+				if err := os.WriteFile(jobTmpFile(d, n.name, n.suffix), []byte(d.ID), 0644); err != nil {
+					t.Error(err)
+				}
+			}
+		}(d)
+	}
+	wg.Wait()
+	for _, n := range names {
+		os.Remove(jobTmpFile(first, n.name, n.suffix))
+	}
+
+	for _, n := range names {
+		data, err := os.ReadFile(jobTmpFile(second, n.name, n.suffix))
+		if err != nil || string(data) != second.ID {
+			t.Errorf("%s%s of the second job = %q, %v", n.name, n.suffix, data, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"goreilly/internal/cache"
+	"goreilly/internal/models"
+)
+
+var (
+	// Cap on the temp space reserved by running jobs in bytes (0 = unlimited)
+	TmpMaxBytes int64
+
+	// Temp space reserved per job (book build directory plus converted copy)
+	// until the book's own size can be estimated, or when it can't
+	TmpJobReserveBytes int64 = 300 << 20
+
+	tmpSpace = newTmpBudget()
+)
+
+// tmpBudget accounts the temp space reserved by running jobs so that
+// concurrent downloads can't fill the disk together
+type tmpBudget struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	reserved int64
+}
+
+// newTmpBudget creates an empty temp space budget
+func newTmpBudget() *tmpBudget {
+	b := &tmpBudget{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// fits reports whether n more bytes can be reserved right away
+func (b *tmpBudget) fits(n int64) bool {
+	// A lone job always runs, even if it is larger than the cap
+	return TmpMaxBytes <= 0 || b.reserved == 0 || b.reserved+n <= TmpMaxBytes
+}
+
+// reserve blocks until n bytes fit under TmpMaxBytes and reserves them,
+// calling onWait once if the job has to wait. It gives up when ctx is done.
+func (b *tmpBudget) reserve(ctx context.Context, n int64, onWait func()) error {
+	// Wake the wait below once ctx is done (taking the lock so the wakeup
+	// can't slip in between the ctx check and Wait)
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.mu.Unlock()
+		b.cond.Broadcast()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.fits(n) && onWait != nil {
+		onWait()
+	}
+	for !b.fits(n) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.cond.Wait()
+	}
+	b.reserved += n
+	return nil
+}
+
+// resize changes a job's reservation from held to n bytes. Shrinking never
+// waits; growing gives up the held bytes first and reserves n like reserve,
+// so jobs waiting to grow can't deadlock holding space each other needs. It
+// returns the bytes the job holds afterwards (0 if ctx ended the wait).
+func (b *tmpBudget) resize(ctx context.Context, held, n int64, onWait func()) (int64, error) {
+	if n <= held {
+		b.release(held - n)
+		return n, nil
+	}
+	b.release(held)
+	if err := b.reserve(ctx, n, onWait); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// release returns n reserved bytes and wakes up waiting jobs
+func (b *tmpBudget) release(n int64) {
+	b.mu.Lock()
+	b.reserved -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// stats returns the reserved bytes
+func (b *tmpBudget) stats() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reserved
+}
+
+// Temp space estimate of a book: its stored EPUB is unpacked, packed again
+// and possibly converted, so a build needs a few times its size. Without a
+// stored copy each chapter counts for an average chapter with its images.
+const (
+	tmpEPUBSizeFactor  = 3
+	tmpBytesPerChapter = 2 << 20
+)
+
+// estimateTmpBytes estimates the temp space a job needs for a book (0 if
+// nothing is known about its size)
+func estimateTmpBytes(download *models.Download, bookInfo *models.BookInfo) int64 {
+	if RedisClient != nil {
+		id := cache.BucketScopedID(download.Options.Bucket, download.Options.Prefix, download.BookID)
+		if cached, err := RedisClient.GetBookInfo(id, "epub"); err == nil && cached != nil && cached.EpubSize > 0 {
+			return cached.EpubSize * tmpEPUBSizeFactor
+		}
+	}
+	if bookInfo != nil && bookInfo.ChapterCount > 0 {
+		return int64(bookInfo.ChapterCount) * tmpBytesPerChapter
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A job waiting for temp space gives up when its context ends
+func TestTmpBudgetReserveCancelled(t *testing.T) {
+	defer func(previous int64) { TmpMaxBytes = previous }(TmpMaxBytes)
+	TmpMaxBytes = 100
+
+	budget := newTmpBudget()
+	if err := budget.reserve(context.Background(), 80, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waited := false
+	err := budget.reserve(ctx, 50, func() { waited = true })
+	if !errors.Is(err, context.DeadlineExceeded) || !waited {
+		t.Fatalf("reserve = %v (waited %v), want a deadline error after waiting", err, waited)
+	}
+	if reserved := budget.stats(); reserved != 80 {
+		t.Errorf("reserved = %d after the cancelled wait, want 80", reserved)
+	}
+}
+
+// Growing a reservation waits for space, shrinking returns it right away
+func TestTmpBudgetResize(t *testing.T) {
+	defer func(previous int64) { TmpMaxBytes = previous }(TmpMaxBytes)
+	TmpMaxBytes = 100
+
+	budget := newTmpBudget()
+	ctx := context.Background()
+	first, _ := budget.resize(ctx, 0, 40, nil)
+	second, _ := budget.resize(ctx, 0, 40, nil)
+
+	grown := make(chan int64)
+	go func() {
+		held, _ := budget.resize(ctx, first, 90, nil)
+		grown <- held
+	}()
+	select {
+	case <-grown:
+		t.Fatal("grew past TmpMaxBytes while the other job holds its space")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if second, _ = budget.resize(ctx, second, 10, nil); second != 10 {
+		t.Fatalf("shrunk to %d, want 10", second)
+	}
+	if held := <-grown; held != 90 || budget.stats() != 100 {
+		t.Errorf("held %d of %d reserved, want 90 of 100", held, budget.stats())
+	}
+}
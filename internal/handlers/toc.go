@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"goreilly/internal/models"
+	"goreilly/internal/oreilly"
+	"goreilly/internal/storage"
+)
+
+// uploadTOC uploads the book's table of contents (the []models.TOCItem hierarchy)
+// as toc.json next to the book and returns its object name and presigned URL
+// (empty if there was no TOC or the upload failed)
+func uploadTOC(ctx context.Context, download *models.Download, client *oreilly.Client, bookID string) (string, string) {
+	toc := client.TOC()
+	if len(toc) == 0 {
+		download.Logf("[TOC] No table of contents available for book %s", bookID)
+		return "", ""
+	}
+
+	data, err := json.MarshalIndent(toc, "", "  ")
+	if err != nil {
+		download.Logf("[TOC] WARNING: Failed to encode table of contents: %v", err)
+		return "", ""
+	}
+
+	tocPath := jobTmpFile(download, bookID, "_toc.json")
+	defer os.Remove(tocPath)
+	if err := os.WriteFile(tocPath, data, 0644); err != nil {
+		download.Logf("[TOC] WARNING: Failed to write table of contents: %v", err)
+		return "", ""
+	}
+
+	objectName, _, err := uploadFile(ctx, download, bookID, tocPath, storage.UploadOptions{
+		Prefix: download.Options.Prefix,
+		Name:   bookID + "_toc.json",
+	})
+	if err != nil {
+		download.Logf("[TOC] WARNING: Failed to upload table of contents: %v", err)
+		return "", ""
+	}
+
+	url, err := storageFor(download.Options.Bucket).GetPresignedURL(objectName, PresignedURLExpiry.Get())
+	if err != nil {
+		download.Logf("[TOC] WARNING: Failed to generate table of contents URL: %v", err)
+		return "", ""
+	}
+
+	download.Logf("[TOC] Uploaded table of contents (%d entries): %s", len(toc), objectName)
+	return objectName, url
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+
+	"goreilly/internal/models"
+	"goreilly/internal/storage"
+)
+
+// Semaphore bounding concurrent MinIO uploads (separate from download/conversion slots)
+var uploadSemaphore = make(chan struct{}, 2)
+
+// SetUploadConcurrency sets the maximum number of concurrent uploads
+func SetUploadConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	uploadSemaphore = make(chan struct{}, n)
+}
+
+// uploadFile uploads a file to the download's bucket once an upload slot is
+// free, giving up when ctx is done
+func uploadFile(ctx context.Context, download *models.Download, bookID, localFilePath string, opts storage.UploadOptions) (string, int64, error) {
+	select {
+	case uploadSemaphore <- struct{}{}:
+	default:
+		download.Logf("[Upload] Waiting for upload slot...")
+		select {
+		case uploadSemaphore <- struct{}{}:
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+		download.Logf("[Upload] Acquired upload slot")
+	}
+	defer func() { <-uploadSemaphore }()
+
+	opts.Context = ctx
+	return storageFor(download.Options.Bucket).UploadFile(bookID, localFilePath, opts)
+}
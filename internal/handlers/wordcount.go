@@ -0,0 +1,15 @@
+package handlers
+
+// wordsPerMinute is the average adult reading speed behind reading_time_minutes
+const wordsPerMinute = 238
+
+// addWordCount adds a book's word count and estimated reading time to a
+// response (nothing if the count is unknown, e.g. a book cached before counts
+// were kept)
+func addWordCount(response map[string]interface{}, words int) {
+	if words <= 0 {
+		return
+	}
+	response["word_count"] = words
+	response["reading_time_minutes"] = (words + wordsPerMinute - 1) / wordsPerMinute
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,10 +22,33 @@ type BookInfo struct {
 	Issued      string   `json:"issued"`
 	Rights      string   `json:"rights"`
 	Cover       string   `json:"cover"`
+	LastModified string   `json:"last_modified_time,omitempty"` // Changes when O'Reilly updates the book
+	ChapterCount int      `json:"chapter_count,omitempty"`      // Length of the API's chapter list (set by GetBookInfo)
+	AudioURLs    []string `json:"audio_urls,omitempty"`         // Companion audio files found in the book info (set by GetBookInfo)
+}
+
+// Enrichment is book metadata from an external catalogue, used to fill gaps in BookInfo
+type Enrichment struct {
+	Source      string   `json:"source"`
+	Description string   `json:"description,omitempty"`
+	Subjects    []string `json:"subjects,omitempty"`
+	CoverURL    string   `json:"cover_url,omitempty"`
 }
 
 type Author struct {
 	Name string `json:"name"`
+	Role string `json:"role,omitempty"` // e.g. author, editor, translator (when the API provides it)
+}
+
+// MARCRole returns the MARC relator code of the author's role (aut when unknown)
+func (a Author) MARCRole() string {
+	switch strings.ToLower(strings.TrimSpace(a.Role)) {
+	case "edt", "editor", "edited by":
+		return "edt"
+	case "trl", "translator", "translated by":
+		return "trl"
+	}
+	return "aut"
 }
 
 type Publisher struct {
@@ -59,41 +86,103 @@ type TOCItem struct {
 	Children []TOCItem `json:"children"`
 }
 
+// DownloadOptions holds the opt-in settings of a download request
+type DownloadOptions struct {
+	Format        string `json:"format"`                   // Output format (epub, mobi, azw3, pdf)
+	IncludeExtras bool   `json:"include_extras,omitempty"` // Also fetch supplementary files (code archives)
+	IncludeTOC    bool   `json:"include_toc,omitempty"`    // Also upload the table of contents as toc.json
+	OutputProfile string `json:"output_profile,omitempty"` // Calibre --output-profile (e.g. kindle, kobo, tablet)
+	Preview       bool   `json:"preview,omitempty"`        // Only the first PreviewChapters chapters, with a preview front page
+	CoverURL      string `json:"-"`                        // User-supplied cover (may be a large data: URL)
+	CoverPage     string `json:"cover_page,omitempty"`     // Chapter (filename or title) used as the front cover
+	RateLimitKB   int    `json:"rate_limit_kb,omitempty"`  // Bandwidth cap in KB/s (0 = server default)
+	ForceRefresh  bool   `json:"force_refresh,omitempty"`  // Ignore cached copies and rebuild the book
+	VerifyEPUB    bool   `json:"verify_epub,omitempty"`    // Check the generated EPUB's manifest/spine
+	Prefix        string `json:"prefix,omitempty"`         // Storage folder the book is uploaded under (e.g. users/alice)
+	Bucket        string `json:"bucket,omitempty"`         // Bucket the book is uploaded to ("" = the configured bucket)
+	Prefetch      bool   `json:"prefetch,omitempty"`       // Low-priority cache warming (POST /api/prefetch)
+	IncludeAudio  bool   `json:"include_audio,omitempty"`  // Embed the audio chapters play (EPUB3)
+}
+
+// EPUBVerification is the result of opening a generated EPUB like a reader would
+type EPUBVerification struct {
+	Valid         bool     `json:"valid"`
+	OPFPath       string   `json:"opf_path,omitempty"`
+	ManifestItems int      `json:"manifest_items"`
+	SpineItems    int      `json:"spine_items"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
 // Download represents a download job
 type Download struct {
 	ID         string    `json:"id"`
 	BookID     string    `json:"book_id"`
+	Format     string    `json:"format,omitempty"`
 	Status     string    `json:"status"`
 	Progress   int       `json:"progress"`
 	Message    string    `json:"message"`
 	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
 	FilePath   string    `json:"file_path,omitempty"`
 	BookTitle  string    `json:"book_title,omitempty"`
+	Authors    []string  `json:"authors,omitempty"`
+	CoverURL   string    `json:"cover_url,omitempty"` // O'Reilly cover image of the book
 	FileSize   int64     `json:"file_size,omitempty"`
 	EpubSize   int64     `json:"epub_size,omitempty"`
 	Timestamp  int64     `json:"timestamp"`
 	Cached     bool      `json:"cached"`
 	MinIOURL   string    `json:"minio_url,omitempty"`
 	EpubURL    string    `json:"epub_url,omitempty"`
+	ExtrasURL  string    `json:"extras_url,omitempty"`
+	TOCURL     string    `json:"toc_url,omitempty"`
 	UploadedAt time.Time `json:"uploaded_at,omitempty"`
+	Verification *EPUBVerification `json:"verification,omitempty"`
+	RetriedAs  string    `json:"retried_as,omitempty"` // ID of the download that retried this failed one
+	Warnings   []string  `json:"warnings,omitempty"`   // Non-fatal problems (e.g. a chapter saved as plain text)
+	SkippedChapters []string `json:"skipped_chapters,omitempty"` // Chapters left out after failing (within tolerance)
+	ChapterErrors []string `json:"chapter_errors,omitempty"` // Every chapter download failure and its cause
+	TrimmedChapters []string `json:"trimmed_chapters,omitempty"` // Empty placeholder chapters left out (TRIM_EMPTY_CHAPTERS)
+	Audio      []string  `json:"audio,omitempty"`    // Audio files found in the book (embedded with include_audio)
+	WordCount  int       `json:"word_count,omitempty"` // Words across the book's chapters
+	Priority   int       `json:"priority"` // Download slot priority (see PriorityInteractive)
+	StartedAt  time.Time `json:"started_at,omitempty"` // When the job got its download slot (zero while queued)
+	Options    DownloadOptions `json:"options"`
 	mutex      sync.RWMutex
 	
+	// Per-download log capture (ring buffer, see Logf)
+	logs      []string
+	logsNext  int
+	logsMutex sync.Mutex
+	
 	// SSE support
 	sseClients map[chan DownloadUpdate]bool
 	sseMutex   sync.RWMutex
+	eventID    int64 // ID of the latest update sent to SSE clients (guarded by mutex)
 }
 
+// Download priorities; a freed download slot goes to the highest priority waiter
+const (
+	PriorityBackground  = 0  // Prefetch and other bulk jobs
+	PriorityInteractive = 10 // Downloads requested by a user
+)
+
 // DownloadUpdate represents a status update sent via SSE
 type DownloadUpdate struct {
+	ID        int64  `json:"-"` // SSE event ID, increases with every update of the download
 	Status    string `json:"status"`
 	Progress  int    `json:"progress"`
 	Message   string `json:"message"`
 	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
 	BookTitle string `json:"book_title,omitempty"`
+	Authors   []string `json:"authors,omitempty"`
+	CoverURL  string `json:"cover_url,omitempty"`
 	FileSize  int64  `json:"file_size,omitempty"`
 	EpubSize  int64  `json:"epub_size,omitempty"`
 	EpubURL   string `json:"epub_url,omitempty"`
 	MinIOURL  string `json:"minio_url,omitempty"`
+	ExtrasURL string `json:"extras_url,omitempty"`
+	TOCURL    string `json:"toc_url,omitempty"`
 	Cached    bool   `json:"cached,omitempty"`
 }
 
@@ -102,29 +191,35 @@ func (d *Download) UpdateStatus(status, message string, progress int) {
 	d.mutex.Lock()
 	d.Status = status
 	d.Message = message
-	d.Progress = progress
+	// Progress never goes back (a stage may report late) and never passes 100
+	if progress = clampProgress(progress); progress > d.Progress {
+		d.Progress = progress
+	}
 	d.mutex.Unlock()
 	
 	// Broadcast to SSE clients
 	d.broadcastUpdate()
 }
 
+// Finished reports whether the status is final (completed or error)
+func (u DownloadUpdate) Finished() bool {
+	return u.Status == "completed" || u.Status == "error"
+}
+
+// Snapshot returns the current state as an SSE update carrying the ID of the
+// latest event, e.g. for a client that (re)connects
+func (d *Download) Snapshot() DownloadUpdate {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.snapshot()
+}
+
 // broadcastUpdate sends updates to all connected SSE clients
 func (d *Download) broadcastUpdate() {
-	d.mutex.RLock()
-	update := DownloadUpdate{
-		Status:    d.Status,
-		Progress:  d.Progress,
-		Message:   d.Message,
-		Error:     d.Error,
-		BookTitle: d.BookTitle,
-		FileSize:  d.FileSize,
-		EpubSize:  d.EpubSize,
-		EpubURL:   d.EpubURL,
-		MinIOURL:  d.MinIOURL,
-		Cached:    d.Cached,
-	}
-	d.mutex.RUnlock()
+	d.mutex.Lock()
+	d.eventID++
+	update := d.snapshot()
+	d.mutex.Unlock()
 	
 	d.sseMutex.RLock()
 	defer d.sseMutex.RUnlock()
@@ -139,6 +234,28 @@ func (d *Download) broadcastUpdate() {
 	}
 }
 
+// snapshot builds the SSE update of the current state (mutex must be held)
+func (d *Download) snapshot() DownloadUpdate {
+	return DownloadUpdate{
+		ID:        d.eventID,
+		Status:    d.Status,
+		Progress:  d.Progress,
+		Message:   d.Message,
+		Error:     d.Error,
+		ErrorCode: d.ErrorCode,
+		BookTitle: d.BookTitle,
+		Authors:   d.Authors,
+		CoverURL:  d.CoverURL,
+		FileSize:  d.FileSize,
+		EpubSize:  d.EpubSize,
+		EpubURL:   d.EpubURL,
+		MinIOURL:  d.MinIOURL,
+		ExtrasURL: d.ExtrasURL,
+		TOCURL:    d.TOCURL,
+		Cached:    d.Cached,
+	}
+}
+
 // AddSSEClient registers a new SSE client
 func (d *Download) AddSSEClient(client chan DownloadUpdate) {
 	d.sseMutex.Lock()
@@ -150,6 +267,22 @@ func (d *Download) AddSSEClient(client chan DownloadUpdate) {
 	d.sseClients[client] = true
 }
 
+// TryAddSSEClient registers a new SSE client unless the download already has
+// max clients (0 = unlimited)
+func (d *Download) TryAddSSEClient(client chan DownloadUpdate, max int) bool {
+	d.sseMutex.Lock()
+	defer d.sseMutex.Unlock()
+	
+	if max > 0 && len(d.sseClients) >= max {
+		return false
+	}
+	if d.sseClients == nil {
+		d.sseClients = make(map[chan DownloadUpdate]bool)
+	}
+	d.sseClients[client] = true
+	return true
+}
+
 // RemoveSSEClient unregisters an SSE client
 func (d *Download) RemoveSSEClient(client chan DownloadUpdate) {
 	d.sseMutex.Lock()
@@ -159,11 +292,12 @@ func (d *Download) RemoveSSEClient(client chan DownloadUpdate) {
 	close(client)
 }
 
-// SetError safely sets error and schedules cleanup
-func (d *Download) SetError(err string, cleanupFunc func(string)) {
+// SetError safely sets error (with its API error code) and schedules cleanup
+func (d *Download) SetError(code, err string, cleanupFunc func(string)) {
 	d.mutex.Lock()
 	d.Status = "error"
 	d.Error = err
+	d.ErrorCode = code
 	d.Message = err
 	downloadID := d.ID
 	d.mutex.Unlock()
@@ -187,5 +321,95 @@ func (d *Download) GetStatus() (string, string, int) {
 	return d.Status, d.Message, d.Progress
 }
 
-// ProgressCallback is a function type for progress updates
+// ProgressCallback is a function type for progress updates (progress is the
+// stage's own 0-100, see StageProgress)
 type ProgressCallback func(stage string, progress int, message string)
+
+// LogFunc is a printf-style logger, used to route a job's logs through its Download
+type LogFunc func(format string, args ...interface{})
+
+// MaxDownloadLogLines caps the per-download log ring buffer
+const MaxDownloadLogLines = 200
+
+var (
+	// Query strings carry presigned URL signatures and tokens
+	urlQueryPattern = regexp.MustCompile(`(https?://[^\s?"']+)\?[^\s"']*`)
+
+	// key=value / key: value pairs for anything that looks like a secret
+	secretPattern = regexp.MustCompile(`(?i)\b(cookie|cookies|token|session|sessionid|password|secret|authorization)(\s*[=:]\s*)[^\s,;]+`)
+)
+
+// RedactLogLine removes URL query strings and secret-looking values from a log line
+func RedactLogLine(line string) string {
+	line = urlQueryPattern.ReplaceAllString(line, "$1?<redacted>")
+	return secretPattern.ReplaceAllString(line, "$1$2<redacted>")
+}
+
+// Logf logs to the global logger and records a redacted copy in the download's log buffer
+func (d *Download) Logf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+
+	line := fmt.Sprintf("%s %s", time.Now().UTC().Format(time.RFC3339), RedactLogLine(fmt.Sprintf(format, args...)))
+
+	d.logsMutex.Lock()
+	defer d.logsMutex.Unlock()
+
+	if len(d.logs) < MaxDownloadLogLines {
+		d.logs = append(d.logs, line)
+		return
+	}
+	d.logs[d.logsNext] = line
+	d.logsNext = (d.logsNext + 1) % MaxDownloadLogLines
+}
+
+// GetLogs returns the captured log lines, oldest first
+func (d *Download) GetLogs() []string {
+	d.logsMutex.Lock()
+	defer d.logsMutex.Unlock()
+
+	lines := make([]string, 0, len(d.logs))
+	lines = append(lines, d.logs[d.logsNext:]...)
+	lines = append(lines, d.logs[:d.logsNext]...)
+	return lines
+}
+
+// SetBookSummary records the book's title, authors and cover as soon as they
+// are known and sends them to SSE clients, so the UI doesn't wait for completion
+func (d *Download) SetBookSummary(title string, authors []string, cover string) {
+	d.mutex.Lock()
+	d.BookTitle = title
+	d.Authors = authors
+	d.CoverURL = cover
+	d.mutex.Unlock()
+
+	d.broadcastUpdate()
+}
+
+// Update changes several fields of the download at once under its lock (fn
+// must not call other methods of the download). SSE clients are not notified.
+func (d *Download) Update(fn func(d *Download)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	fn(d)
+}
+
+// Read gives fn a consistent view of the download under its read lock (fn
+// must not call other methods of the download or keep references to slices)
+func (d *Download) Read(fn func(d *Download)) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	fn(d)
+}
+
+// ClaimRetry records retryID as the retry of this failed download, unless it
+// has already been retried; the existing retry's ID is returned then
+func (d *Download) ClaimRetry(retryID string) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.RetriedAs != "" {
+		return d.RetriedAs
+	}
+	d.RetriedAs = retryID
+	return ""
+}
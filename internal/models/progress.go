@@ -0,0 +1,61 @@
+package models
+
+// Pipeline stages, in order. Each owns a slice of the overall 0-100 progress
+// and reports its own progress as 0-100 within that slice.
+const (
+	StageConnect  = "connect"  // Logging in to O'Reilly
+	StageInfo     = "info"     // Book info
+	StageChapters = "chapters" // Chapter list
+	StageCover    = "cover"    // Cover image
+	StageDownload = "download" // Chapter content
+	StageEPUB     = "epub"     // EPUB packaging
+	StageCBZ      = "cbz"      // CBZ packaging
+	StageConvert  = "convert"  // Calibre conversion
+	StageUpload   = "upload"   // Upload to storage
+	StageExtras   = "extras"   // Supplementary files
+)
+
+// progressRange is the share [start, end] of the overall progress a stage owns
+type progressRange struct {
+	start, end int
+}
+
+var progressStages = map[string]progressRange{
+	StageConnect:  {10, 15},
+	StageInfo:     {15, 20},
+	StageChapters: {20, 28},
+	StageCover:    {28, 30},
+	StageDownload: {30, 50},
+	StageEPUB:     {50, 80},
+	StageCBZ:      {50, 80},
+	StageConvert:  {80, 90},
+	StageUpload:   {90, 99},
+	StageExtras:   {99, 99},
+}
+
+// StageProgress maps a stage's own 0-100 progress onto the overall progress
+// (unknown stages keep percent as is, clamped to 0-100)
+func StageProgress(stage string, percent int) int {
+	percent = clampProgress(percent)
+	r, ok := progressStages[stage]
+	if !ok {
+		return percent
+	}
+	return r.start + (r.end-r.start)*percent/100
+}
+
+// clampProgress keeps a progress value within 0-100
+func clampProgress(progress int) int {
+	if progress < 0 {
+		return 0
+	}
+	if progress > 100 {
+		return 100
+	}
+	return progress
+}
+
+// UpdateStage reports progress of a pipeline stage (percent of the stage itself)
+func (d *Download) UpdateStage(stage string, percent int, message string) {
+	d.UpdateStatus("downloading", message, StageProgress(stage, percent))
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+// Progress never goes back or past 100 over a whole run, even when stages
+// report late, out of order or beyond their range
+func TestProgressMonotonic(t *testing.T) {
+	d := &Download{ID: "run"}
+	last := 0
+	check := func(step string) {
+		t.Helper()
+		_, _, progress := d.GetStatus()
+		if progress < last || progress > 100 {
+			t.Fatalf("%s: progress %d after %d", step, progress, last)
+		}
+		last = progress
+	}
+
+	d.UpdateStage(StageConnect, 0, "Connecting")
+	check("connect")
+	d.UpdateStage(StageInfo, 100, "Book info")
+	check("info")
+	d.UpdateStage(StageChapters, 50, "Chapters")
+	check("chapters")
+	d.UpdateStage(StageCover, 100, "Cover")
+	check("cover")
+
+	// Chapter workers finish in any order; a retried chapter reports a lower count
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for done := worker; done <= 100; done += 8 {
+				d.UpdateStage(StageDownload, done, "Chapters")
+			}
+		}(worker)
+	}
+	wg.Wait()
+	check("download")
+	d.UpdateStage(StageDownload, 40, "Retrying chapter")
+	check("retried chapter")
+
+	// A stage reporting past its range, then a late report of an earlier stage
+	d.UpdateStage(StageEPUB, 250, "Packaging")
+	check("epub")
+	d.UpdateStage(StageCover, 0, "Late cover report")
+	check("late cover")
+	d.UpdateStage(StageConvert, 100, "Converted")
+	check("convert")
+	d.UpdateStage(StageUpload, 100, "Uploaded")
+	check("upload")
+	d.UpdateStatus("queued", "Waiting for temporary disk space...", 0)
+	check("requeued")
+
+	d.UpdateStatus("completed", "Done", 130)
+	check("completed")
+	if last != 100 {
+		t.Errorf("completed download at %d%%, want 100", last)
+	}
+}
+
+// Each stage's range starts where the previous stage's ends
+func TestProgressStagesOrdered(t *testing.T) {
+	order := []string{StageConnect, StageInfo, StageChapters, StageCover, StageDownload, StageEPUB, StageConvert, StageUpload, StageExtras}
+	end := 0
+	for _, stage := range order {
+		r := progressStages[stage]
+		if r.start < end || r.end < r.start || r.end > 100 {
+			t.Errorf("stage %s owns %d-%d after a stage ending at %d", stage, r.start, r.end, end)
+		}
+		end = r.end
+	}
+}
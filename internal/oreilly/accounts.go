@@ -0,0 +1,232 @@
+package oreilly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+// CookiesDir holds one cookie file (*.json) per O'Reilly account. When set,
+// NewClient rotates among the accounts instead of using a single cookies file.
+var CookiesDir string
+
+var (
+	// AccountMaxFailures is the number of consecutive login failures after which
+	// an account is marked unhealthy and no longer selected
+	AccountMaxFailures = 3
+
+	// AccountCooldown is how long an unhealthy account rests before a probe
+	// checks whether its cookies work again
+	AccountCooldown = 15 * time.Minute
+)
+
+// accountHealth tracks recent login results of one cookie file
+type accountHealth struct {
+	failures       int // Consecutive failures
+	lastError      string
+	unhealthyUntil time.Time // Zero while the account is healthy
+}
+
+// AccountStatus is the health of a cookie account as reported by the admin API
+type AccountStatus struct {
+	Account        string     `json:"account"`
+	Healthy        bool       `json:"healthy"`
+	Failures       int        `json:"consecutive_failures"`
+	LastError      string     `json:"last_error,omitempty"`
+	UnhealthyUntil *time.Time `json:"unhealthy_until,omitempty"`
+}
+
+var (
+	accounts     = make(map[string]*accountHealth)
+	accountsLock sync.Mutex
+	nextAccount  int
+)
+
+// listAccounts returns the cookie files in CookiesDir, sorted by name
+func listAccounts() ([]string, error) {
+	entries, err := os.ReadDir(CookiesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookies directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// newRotatingClient creates a client with the next healthy account, falling
+// over to the following accounts when one's cookies are rejected
+func newRotatingClient(ctx context.Context, bookID string, callback models.ProgressCallback) (*Client, error) {
+	names, err := listAccounts()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no cookie files found in %s, please add a cookies.json", CookiesDir)
+	}
+
+	accountsLock.Lock()
+	start := nextAccount % len(names)
+	nextAccount++
+	accountsLock.Unlock()
+
+	tried := 0
+	var lastErr error
+	for i := range names {
+		account := names[(start+i)%len(names)]
+		if !accountAvailable(account) {
+			log.Printf("[Accounts] Skipping %s: marked unhealthy", account)
+			continue
+		}
+		tried++
+
+		cookies, err := readCookieFile(filepath.Join(CookiesDir, account))
+		if err != nil {
+			log.Printf("[Accounts] Failed to load %s: %v", account, err)
+			markAccountFailed(account, err)
+			lastErr = fmt.Errorf("failed to load cookies: %w", err)
+			continue
+		}
+
+		log.Printf("[Accounts] Using account %s (%d cookies)", account, len(cookies))
+		client, err := newClientWithCookies(ctx, bookID, cookies, callback)
+		if err != nil {
+			if !errors.Is(err, errAuthFailed) && !errors.Is(err, errSubscriptionExpired) {
+				// Network problems are not the account's fault, another one won't fare better
+				return nil, err
+			}
+			log.Printf("[Accounts] Account %s rejected: %v", account, err)
+			markAccountFailed(account, err)
+			lastErr = err
+			continue
+		}
+
+		markAccountHealthy(account)
+		client.account = account
+		return client, nil
+	}
+
+	if tried == 0 {
+		return nil, fmt.Errorf("authentication failed: all %d cookie accounts are unhealthy, retry later", len(names))
+	}
+	return nil, lastErr
+}
+
+// accountAvailable reports whether an account may be used (it is not marked unhealthy)
+func accountAvailable(account string) bool {
+	accountsLock.Lock()
+	defer accountsLock.Unlock()
+
+	health, exists := accounts[account]
+	return !exists || health.unhealthyUntil.IsZero()
+}
+
+// markAccountFailed records a login failure and marks the account unhealthy
+// once it has failed AccountMaxFailures times in a row
+func markAccountFailed(account string, err error) {
+	accountsLock.Lock()
+	defer accountsLock.Unlock()
+
+	health, exists := accounts[account]
+	if !exists {
+		health = &accountHealth{}
+		accounts[account] = health
+	}
+	health.failures++
+	health.lastError = err.Error()
+
+	if health.failures < AccountMaxFailures || !health.unhealthyUntil.IsZero() {
+		return
+	}
+	health.unhealthyUntil = time.Now().Add(AccountCooldown)
+	log.Printf("[Accounts] Marking %s unhealthy for %s after %d failures: %v",
+		account, AccountCooldown, health.failures, err)
+	time.AfterFunc(AccountCooldown, func() { probeAccount(account) })
+}
+
+// markAccountHealthy clears an account's failures after a successful login
+func markAccountHealthy(account string) {
+	accountsLock.Lock()
+	defer accountsLock.Unlock()
+
+	delete(accounts, account)
+}
+
+// probeAccount checks an unhealthy account's login after its cooldown, returning
+// it to the rotation if it works and starting another cooldown if it doesn't
+func probeAccount(account string) {
+	cookies, err := readCookieFile(filepath.Join(CookiesDir, account))
+	if os.IsNotExist(err) {
+		log.Printf("[Accounts] %s was removed, no longer probing it", account)
+		markAccountHealthy(account)
+		return
+	}
+	if err == nil {
+		_, err = newClientWithCookies(context.Background(), "", cookies, nil)
+	}
+
+	if err == nil {
+		log.Printf("[Accounts] Probe of %s succeeded, account is healthy again", account)
+		markAccountHealthy(account)
+		return
+	}
+
+	accountsLock.Lock()
+	defer accountsLock.Unlock()
+
+	health, exists := accounts[account]
+	if !exists {
+		return
+	}
+	health.failures++
+	health.lastError = err.Error()
+	health.unhealthyUntil = time.Now().Add(AccountCooldown)
+	log.Printf("[Accounts] Probe of %s failed, retrying in %s: %v", account, AccountCooldown, err)
+	time.AfterFunc(AccountCooldown, func() { probeAccount(account) })
+}
+
+// AccountStatuses returns the health of every cookie file in CookiesDir
+func AccountStatuses() ([]AccountStatus, error) {
+	names, err := listAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	accountsLock.Lock()
+	defer accountsLock.Unlock()
+
+	statuses := make([]AccountStatus, 0, len(names))
+	for _, name := range names {
+		status := AccountStatus{Account: name, Healthy: true}
+		if health, exists := accounts[name]; exists {
+			status.Failures = health.failures
+			status.LastError = health.lastError
+			if !health.unhealthyUntil.IsZero() {
+				until := health.unhealthyUntil
+				status.Healthy = false
+				status.UnhealthyUntil = &until
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Account returns the cookie file the client authenticated with (empty without CookiesDir)
+func (c *Client) Account() string {
+	return c.account
+}
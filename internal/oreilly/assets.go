@@ -0,0 +1,63 @@
+package oreilly
+
+import (
+	"fmt"
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+// Asset API versions
+const (
+	assetAPIv1 = "v1"
+	assetAPIv2 = "v2"
+)
+
+// assetBase is a base URL that relative chapter assets can be fetched from
+type assetBase struct {
+	version string
+	url     string
+}
+
+// assetBases returns the candidate base URLs for a chapter's relative assets,
+// most likely first: the version that already worked for this book, otherwise
+// v2 when the chapter references /api/v2/ (or has no v1 base), then v1
+func (c *Client) assetBases(chapter *models.Chapter) []assetBase {
+	v2 := assetBase{assetAPIv2, fmt.Sprintf("%s/api/v2/epubs/urn:orm:book:%s/files", SafariBaseURL, c.bookID)}
+	if chapter.AssetBaseURL == "" {
+		return []assetBase{v2}
+	}
+	v1 := assetBase{assetAPIv1, strings.TrimSuffix(chapter.AssetBaseURL, "/")}
+
+	c.mu.Lock()
+	preferred := c.assetVersion
+	c.mu.Unlock()
+
+	if preferred == assetAPIv1 || (preferred == "" && !strings.Contains(chapter.Content, "/api/v2/")) {
+		return []assetBase{v1, v2}
+	}
+	return []assetBase{v2, v1}
+}
+
+// downloadRelativeAsset fetches an asset path relative to the book's asset base,
+// trying each API version until one succeeds and remembering the one that worked
+func (c *Client) downloadRelativeAsset(chapter *models.Chapter, path, subdir, filename string) error {
+	var lastErr error
+	for _, base := range c.assetBases(chapter) {
+		err := c.downloadAsset(base.url+"/"+strings.TrimPrefix(path, "/"), chapterReferer(chapter), subdir, filename)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		changed := c.assetVersion != base.version
+		c.assetVersion = base.version
+		c.mu.Unlock()
+		if changed {
+			c.logf("[O'Reilly] Using API %s asset URLs for book %s", base.version, c.bookID)
+		}
+		return nil
+	}
+	return lastErr
+}
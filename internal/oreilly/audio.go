@@ -0,0 +1,172 @@
+package oreilly
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"goreilly/internal/models"
+)
+
+// Audio file extensions and their EPUB3 media types
+var audioMediaTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".mp4a": "audio/mp4",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+}
+
+// audioMediaType returns the media type of an audio URL or filename ("" if it isn't audio)
+func audioMediaType(name string) string {
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	return audioMediaTypes[strings.ToLower(path.Ext(name))]
+}
+
+// audioURLsInJSON returns the audio file URLs anywhere in a JSON document (the
+// book info API has no dedicated field for companion audio)
+func audioURLsInJSON(data []byte) []string {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	var urls []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			if (strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")) && audioMediaType(v) != "" && !contains(urls, v) {
+				urls = append(urls, v)
+			}
+		}
+	}
+	walk(doc)
+	return urls
+}
+
+// SetIncludeAudio embeds the audio files chapters play (<audio>) in the EPUB
+// (EPUB3 only; EPUB2 has no audio support, the files are only listed then)
+func (c *Client) SetIncludeAudio(include bool) {
+	c.includeAudio = include
+}
+
+// processAudio records the audio a chapter plays and, with SetIncludeAudio on
+// an EPUB3 book, downloads it into Audio/ and points the elements at the copy
+func (c *Client) processAudio(content *goquery.Selection, chapter *models.Chapter) {
+	content.Find("audio[src], audio source[src]").Each(func(i int, el *goquery.Selection) {
+		src := strings.TrimSpace(el.AttrOr("src", ""))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return
+		}
+
+		link := c.resolveAssetURL(chapter, src)
+		c.mu.Lock()
+		found := !contains(c.audio, link)
+		if found {
+			c.audio = append(c.audio, link)
+		}
+		c.mu.Unlock()
+		if found {
+			c.logf("[Audio] Found audio in chapter %q: %s", chapter.Title, link)
+		}
+
+		if !c.includeAudio || !isEPUB3() || audioMediaType(src) == "" {
+			return
+		}
+
+		// Claim the filename before downloading (like processImages) so chapters
+		// processed in parallel don't fetch the same file into the same path
+		filename := filepath.Base(strings.SplitN(src, "?", 2)[0])
+		c.mu.Lock()
+		claimed := contains(c.audioFiles, filename)
+		if !claimed {
+			c.audioFiles = append(c.audioFiles, filename)
+		}
+		c.mu.Unlock()
+		if !claimed {
+			if err := c.downloadAudio(chapter, src, filename); err != nil {
+				c.warnf("Audio %s of chapter %q could not be downloaded: %v", filename, chapter.Title, err)
+				// Not listed in the manifest without the file
+				c.mu.Lock()
+				if i := indexOf(c.audioFiles, filename); i >= 0 {
+					c.audioFiles = append(c.audioFiles[:i], c.audioFiles[i+1:]...)
+				}
+				c.mu.Unlock()
+				return
+			}
+		}
+		el.SetAttr("src", "Audio/"+filename)
+	})
+}
+
+// downloadAudio fetches one audio file into OEBPS/Audio
+func (c *Client) downloadAudio(chapter *models.Chapter, src, filename string) error {
+	if err := os.MkdirAll(filepath.Join(c.bookPath, "OEBPS", "Audio"), 0755); err != nil {
+		return err
+	}
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return c.downloadAsset(src, chapterReferer(chapter), "Audio", filename)
+	}
+	if strings.HasPrefix(src, "/") {
+		return c.downloadAsset(SafariBaseURL+src, chapterReferer(chapter), "Audio", filename)
+	}
+	return c.downloadRelativeAsset(chapter, src, "Audio", filename)
+}
+
+// resolveAssetURL makes a chapter asset reference absolute (relative paths
+// resolve against the chapter's preferred asset API)
+func (c *Client) resolveAssetURL(chapter *models.Chapter, src string) string {
+	switch {
+	case strings.HasPrefix(src, "http://"), strings.HasPrefix(src, "https://"):
+		return src
+	case strings.HasPrefix(src, "/"):
+		return SafariBaseURL + src
+	}
+	return c.assetBases(chapter)[0].url + "/" + src
+}
+
+// audioManifest returns the manifest items of the embedded audio files
+func (c *Client) audioManifest() string {
+	var manifest strings.Builder
+	for i, audio := range c.audioFiles {
+		// Indexed ids: filenames needn't be valid XML ids
+		manifest.WriteString(fmt.Sprintf(`<item id="audio_%d" href="Audio/%s" media-type="%s" />`, i, html.EscapeString(audio), audioMediaType(audio)))
+		manifest.WriteString("\n")
+	}
+	return manifest.String()
+}
+
+// AudioLinks returns the audio files found in the book info and chapters
+func (c *Client) AudioLinks() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var links []string
+	if c.bookInfo != nil {
+		links = append(links, c.bookInfo.AudioURLs...)
+	}
+	for _, link := range c.audio {
+		if !contains(links, link) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
@@ -0,0 +1,119 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"goreilly/internal/models"
+)
+
+// Image types packaged into a CBZ (what comic readers display)
+var cbzImageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// CreateCBZ packages the downloaded images in reading order into a CBZ
+// (a ZIP of images named so that sorting by name keeps the order)
+func (c *Client) CreateCBZ() (string, error) {
+	c.updateProgress(models.StageCBZ, 0, "Collecting pages...")
+
+	pages := c.readingOrderImages()
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no images found to build a CBZ")
+	}
+	c.logf("[O'Reilly] Packaging %d images into CBZ", len(pages))
+
+	c.updateProgress(models.StageCBZ, 50, "Packaging CBZ...")
+	cbzPath := filepath.Join(c.bookPath, c.bookID+".cbz")
+	file, err := os.Create(cbzPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	imagesDir := filepath.Join(c.bookPath, "OEBPS", "Images")
+	for i, page := range pages {
+		// Images are already compressed, store them as-is
+		name := fmt.Sprintf("%04d%s", i+1, strings.ToLower(filepath.Ext(page)))
+		zipFile, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return "", err
+		}
+
+		src, err := os.Open(filepath.Join(imagesDir, page))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(zipFile, src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	c.updateProgress(models.StageCBZ, 100, "CBZ created successfully!")
+	return cbzPath, nil
+}
+
+// readingOrderImages lists the downloaded images in reading order: the cover,
+// then every image in the order it appears in the chapters
+func (c *Client) readingOrderImages() []string {
+	imagesDir := filepath.Join(c.bookPath, "OEBPS", "Images")
+	seen := make(map[string]bool)
+	var pages []string
+
+	add := func(name string) {
+		if name == "" || seen[name] || !isCBZImage(name) {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(imagesDir, name)); err != nil {
+			return
+		}
+		seen[name] = true
+		pages = append(pages, name)
+	}
+
+	add(c.coverImage)
+
+	for _, chapter := range c.chapters {
+		chapterPath := filepath.Join(c.bookPath, "OEBPS", xhtmlFilename(chapter.Filename))
+		f, err := os.Open(chapterPath)
+		if err != nil {
+			c.logf("[O'Reilly] WARNING: Cannot read %s for CBZ: %v", chapterPath, err)
+			continue
+		}
+		doc, err := goquery.NewDocumentFromReader(f)
+		f.Close()
+		if err != nil {
+			c.logf("[O'Reilly] WARNING: Cannot parse %s for CBZ: %v", chapterPath, err)
+			continue
+		}
+
+		doc.Find("img").Each(func(i int, img *goquery.Selection) {
+			if src, exists := img.Attr("src"); exists {
+				add(filepath.Base(src))
+			}
+		})
+	}
+
+	return pages
+}
+
+// isCBZImage reports whether a file is an image type packaged into a CBZ
+func isCBZImage(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range cbzImageExtensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package oreilly
+
+import (
+	"fmt"
+)
+
+// ChapterError is the failure of one chapter download
+type ChapterError struct {
+	Index   int // Position in the chapter list
+	Chapter string
+	Err     error
+}
+
+func (e *ChapterError) Error() string {
+	return fmt.Sprintf("chapter %d %q: %v", e.Index+1, e.Chapter, e.Err)
+}
+
+func (e *ChapterError) Unwrap() error {
+	return e.Err
+}
+
+// ChapterErrors collects every chapter failure of a download. Its message names
+// the first failure only; Strings lists them all.
+type ChapterErrors []*ChapterError
+
+func (errs ChapterErrors) Error() string {
+	switch len(errs) {
+	case 0:
+		return "no chapter errors"
+	case 1:
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", errs[0].Error(), len(errs)-1)
+}
+
+// Unwrap exposes each chapter error to errors.Is and errors.As
+func (errs ChapterErrors) Unwrap() []error {
+	wrapped := make([]error, len(errs))
+	for i, err := range errs {
+		wrapped[i] = err
+	}
+	return wrapped
+}
+
+// Strings returns one message per failed chapter
+func (errs ChapterErrors) Strings() []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// ChapterErrors returns every chapter download failure of the book
+func (c *Client) ChapterErrors() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chapterErrors.Strings()
+}
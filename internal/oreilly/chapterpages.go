@@ -0,0 +1,79 @@
+package oreilly
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"goreilly/internal/models"
+)
+
+// ChapterPageConcurrency is how many pages of the chapter list are fetched at
+// once when the first page tells how many there are (1 = one after another)
+var ChapterPageConcurrency = 4
+
+// chapterPage is one page of the chapter list API
+type chapterPage struct {
+	Count   int              `json:"count"`
+	Results []models.Chapter `json:"results"`
+	Next    *string          `json:"next"`
+}
+
+// pageCount estimates the number of pages from the first page's count and size
+// (0 if unknown)
+func (p *chapterPage) pageCount() int {
+	if p.Count <= 0 || len(p.Results) == 0 {
+		return 0
+	}
+	return (p.Count + len(p.Results) - 1) / len(p.Results)
+}
+
+// fetchChapterPage fetches one page of the chapter list
+func (c *Client) fetchChapterPage(page int) (*chapterPage, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/book/%s/chapter/?page=%d", SafariBaseURL, c.bookID, page)
+	c.logf("[O'Reilly] Fetching chapters page %d", page)
+
+	resp, err := c.httpClient.Get(apiURL)
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to retrieve chapters: %v", err)
+		return nil, fmt.Errorf("failed to retrieve chapters: %w", err)
+	}
+	defer resp.Body.Close()
+	c.checkAuthStatus(resp.StatusCode)
+
+	var response chapterPage
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to parse chapters: %v", err)
+		return nil, fmt.Errorf("failed to parse chapters: %w", err)
+	}
+
+	c.logf("[O'Reilly] Found %d chapters on page %d", len(response.Results), page)
+	return &response, nil
+}
+
+// fetchChapterPages fetches pages from..to with up to ChapterPageConcurrency
+// requests at once and returns them in page order
+func (c *Client) fetchChapterPages(from, to int) ([]*chapterPage, error) {
+	pages := make([]*chapterPage, to-from+1)
+	errs := make([]error, len(pages))
+
+	sem := make(chan struct{}, ChapterPageConcurrency)
+	var wg sync.WaitGroup
+	for i := range pages {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			pages[i], errs[i] = c.fetchChapterPage(from + i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
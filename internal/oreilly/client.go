@@ -2,9 +2,16 @@ package oreilly
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"log"
 	"net/http"
@@ -13,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -28,9 +36,18 @@ const (
 	APIOriginHost  = "api." + OrlyBaseHost
 	SafariBaseURL  = "https://" + SafariBaseHost
 	ProfileURL     = SafariBaseURL + "/profile/"
-	tmpBooksDir    = "/tmp/goreilly/books"
 )
 
+// Generator is written to the OPF metadata of every EPUB this tool produces
+const Generator = "Go-Reilly"
+
+// BooksDir holds the per-book build directories
+var BooksDir = "/tmp/goreilly/books"
+
+// PrefetchTOC fetches the table of contents concurrently with the chapter
+// downloads instead of at EPUB creation time
+var PrefetchTOC = true
+
 // Client handles O'Reilly book downloads
 type Client struct {
 	httpClient       *http.Client
@@ -38,17 +55,58 @@ type Client struct {
 	bookInfo         *models.BookInfo
 	chapters         []models.Chapter
 	bookPath         string
+	jobID            string // Download this client works for, keeps concurrent jobs' build directories apart
+	imageBytesSaved  int64  // Total saved by OptimizeImages
+	chapterWords     map[string]int // Word count per chapter file (see WordCount)
 	cssFiles         []string
 	imageFiles       []string
 	coverImage       string
+	toc              []models.TOCItem
+	pageMarkers      map[string][]pageMarker // Page breaks per chapter file (EPUB3)
+	extras           []string                // Supplementary-file links found in chapters
+	audio            []string                // Audio files played by chapters
+	audioFiles       []string                // Of those, the ones embedded in Audio/ (include_audio)
+	includeAudio     bool
+	customCover      string                  // User-supplied cover (http(s) or data: URL)
+	customCoverUsed  bool
+	coverPage        string // Requested front cover page (chapter filename or title)
+	frontCover       string // File of the chapter chosen as front cover
+	coverXHTML       bool   // cover.xhtml was created for the cover image
+	contentSelector  string // Chapter content container of this book (see ContentSelector)
+	limiter          *rateLimiter            // Per-download bandwidth cap (nil = unlimited)
+	assetVersion     string                  // Asset API version (v1/v2) that worked for this book
+	externalCover    bool                    // bookInfo.Cover comes from a metadata provider
+	warnings         []string                // Non-fatal problems worth reporting with the download
+	skipped          map[string]bool         // Files of chapters left out (failed within MaxFailedChapters, or beyond the preview)
+	skippedTitles    []string
+	emptyChapters    map[string]bool         // Files of chapters found empty (TrimEmptyChapters)
+	trimmedTitles    []string
+	chapterErrors    ChapterErrors           // Every chapter download failure
+	previewChapters  int                     // Only include this many chapters (0 = full book)
+	previewTotal     int                     // Chapter count of the full book when the preview left some out
 	progressCallback models.ProgressCallback
-	mu               sync.Mutex // Protects shared slices during concurrent access
+	logger           models.LogFunc // Optional job-scoped logger
+	fingerprint      string         // Cookie fingerprint of the pooled session
+	account          string         // Cookie file in CookiesDir the client uses (empty = single cookies file)
+	ctx              context.Context // Ends waits between retries (see SetContext, nil = never)
+	mu               sync.Mutex     // Protects shared slices during concurrent access
 }
 
 // NewClient creates a new O'Reilly client
 func NewClient(bookID string, cookiesPath string, callback models.ProgressCallback) (*Client, error) {
+	return NewClientContext(context.Background(), bookID, cookiesPath, callback)
+}
+
+// NewClientContext is NewClient with a context that ends the login check
+// (including its retries), e.g. when the request that needs the client is gone
+func NewClientContext(ctx context.Context, bookID string, cookiesPath string, callback models.ProgressCallback) (*Client, error) {
 	log.Printf("[O'Reilly] Creating new client for book ID: %s", bookID)
 	
+	// Pick one of several accounts when a cookies directory is configured
+	if CookiesDir != "" {
+		return newRotatingClient(ctx, bookID, callback)
+	}
+	
 	// Load cookies
 	log.Printf("[O'Reilly] Loading cookies from: %s", cookiesPath)
 	cookies, err := loadCookies(cookiesPath)
@@ -58,6 +116,28 @@ func NewClient(bookID string, cookiesPath string, callback models.ProgressCallba
 	}
 	log.Printf("[O'Reilly] Successfully loaded %d cookies", len(cookies))
 
+	return newClientWithCookies(ctx, bookID, cookies, callback)
+}
+
+// newClientWithCookies creates a client for a cookie set, reusing its pooled
+// session or checking the login
+func newClientWithCookies(ctx context.Context, bookID string, cookies []*http.Cookie, callback models.ProgressCallback) (*Client, error) {
+	fingerprint := cookieFingerprint(cookies)
+
+	// Reuse a recently validated session for the same cookies
+	if httpClient := getPooledSession(fingerprint); httpClient != nil {
+		log.Printf("[O'Reilly] Reusing authenticated session %s", fingerprint)
+		return &Client{
+			httpClient:       httpClient,
+			bookID:           bookID,
+			cssFiles:         []string{},
+			imageFiles:       []string{},
+			progressCallback: callback,
+			fingerprint:      fingerprint,
+			ctx:              ctx,
+		}, nil
+	}
+
 	// Create cookie jar
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
@@ -81,19 +161,71 @@ func NewClient(bookID string, cookiesPath string, callback models.ProgressCallba
 		cssFiles:         []string{},
 		imageFiles:       []string{},
 		progressCallback: callback,
+		fingerprint:      fingerprint,
+		ctx:              ctx,
 	}
 
 	// Check authentication
 	log.Printf("[O'Reilly] Checking authentication...")
 	if err := client.checkLogin(); err != nil {
 		log.Printf("[O'Reilly] ERROR: Authentication failed: %v", err)
+		invalidateSession(fingerprint)
 		return nil, err
 	}
 	log.Printf("[O'Reilly] Authentication successful")
+	putPooledSession(fingerprint, client.httpClient)
 
 	return client, nil
 }
 
+var (
+	// Matches a bare book ID (ISBN-like or O'Reilly internal IDs)
+	bookIDPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z_-]*$`)
+
+	// Matches the book ID segment of common O'Reilly URL shapes:
+	//   /library/view/<slug>/<id>/...
+	//   /library/cover/<id>/
+	//   /api/v1/book/<id>/...
+	//   /api/v2/epubs/urn:orm:book:<id>/...
+	bookURLPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^/library/view/[^/]+/([0-9A-Za-z_-]+)`),
+		regexp.MustCompile(`^/library/cover/([0-9A-Za-z_-]+)`),
+		regexp.MustCompile(`^/api/v1/book/([0-9A-Za-z_-]+)`),
+		regexp.MustCompile(`^/api/v2/epubs/urn:orm:book:([0-9A-Za-z_-]+)`),
+	}
+)
+
+// ParseBookID extracts a book ID from either a bare ID or an O'Reilly URL
+func ParseBookID(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("book ID is required")
+	}
+
+	input = strings.TrimPrefix(input, "urn:orm:book:")
+	if bookIDPattern.MatchString(input) {
+		return input, nil
+	}
+
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid book ID or URL: %s", input)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host != OrlyBaseHost && !strings.HasSuffix(host, "."+OrlyBaseHost) {
+		return "", fmt.Errorf("not an O'Reilly URL: %s", u.Host)
+	}
+
+	for _, pattern := range bookURLPatterns {
+		if m := pattern.FindStringSubmatch(u.Path); m != nil {
+			return m[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognized O'Reilly URL, expected a /library/view/<title>/<id>/ link")
+}
+
 // loadCookies loads cookies from JSON file
 func loadCookies(path string) ([]*http.Cookie, error) {
 	// Check multiple locations
@@ -113,6 +245,20 @@ func loadCookies(path string) ([]*http.Cookie, error) {
 		return nil, fmt.Errorf("cookies.json not found")
 	}
 
+	return parseCookies(data)
+}
+
+// readCookieFile loads cookies from exactly one JSON file (no fallback locations)
+func readCookieFile(path string) ([]*http.Cookie, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCookies(data)
+}
+
+// parseCookies decodes a {"name": "value"} cookie file
+func parseCookies(data []byte) ([]*http.Cookie, error) {
 	var cookieMap map[string]string
 	if err := json.Unmarshal(data, &cookieMap); err != nil {
 		return nil, err
@@ -130,24 +276,89 @@ func loadCookies(path string) ([]*http.Cookie, error) {
 	return cookies, nil
 }
 
+// Login failures caused by the cookies themselves (as opposed to the network)
+var (
+	errAuthFailed          = errors.New("authentication failed, please refresh cookies.json")
+	errSubscriptionExpired = errors.New("account subscription expired")
+)
+
+var (
+	// LoginCheckTimeout bounds each login check request (shorter than the client's 30s)
+	LoginCheckTimeout = 10 * time.Second
+
+	// LoginCheckRetries is how often a login check that could not reach O'Reilly is retried
+	LoginCheckRetries = 2
+)
+
+// loginRetryBackoff is the wait before the first login check retry (doubles after each)
+const loginRetryBackoff = time.Second
+
 // checkLogin verifies authentication
 func (c *Client) checkLogin() error {
-	resp, err := c.httpClient.Get(ProfileURL)
+	var err error
+	for attempt := 0; attempt <= LoginCheckRetries; attempt++ {
+		if attempt > 0 {
+			backoff := loginRetryBackoff * time.Duration(1<<(attempt-1))
+			c.logf("[O'Reilly] Login check failed (%v), retrying in %v (attempt %d/%d)", err, backoff, attempt+1, LoginCheckRetries+1)
+			if waitErr := c.wait(backoff); waitErr != nil {
+				return err
+			}
+		}
+
+		var transient bool
+		if transient, err = c.probeLogin(); err == nil || !transient {
+			return err
+		}
+	}
+	return err
+}
+
+// probeLogin requests the profile page once. Transient errors (network failures,
+// timeouts, 5xx) are worth retrying, any other answer is final.
+func (c *Client) probeLogin() (bool, error) {
+	ctx, cancel := context.WithTimeout(c.context(), LoginCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ProfileURL, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to reach O'Reilly: %w", err)
+		return true, fmt.Errorf("unable to reach O'Reilly: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= 500 {
+		return true, fmt.Errorf("unable to reach O'Reilly: status %d", resp.StatusCode)
+	}
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("authentication failed, please refresh cookies.json")
+		return false, errAuthFailed
 	}
 
-	body, _ := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, fmt.Errorf("unable to reach O'Reilly: %w", err)
+	}
 	if strings.Contains(string(body), `user_type":"Expired"`) {
-		return fmt.Errorf("account subscription expired")
+		return false, errSubscriptionExpired
 	}
 
-	return nil
+	return false, nil
+}
+
+// SetLogger routes the client's log output through a job-scoped logger
+func (c *Client) SetLogger(logger models.LogFunc) {
+	c.logger = logger
+}
+
+// logf logs through the job-scoped logger if set, otherwise the global logger
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger(format, args...)
+		return
+	}
+	log.Printf(format, args...)
 }
 
 // updateProgress calls the progress callback
@@ -159,108 +370,141 @@ func (c *Client) updateProgress(stage string, progress int, message string) {
 
 // GetBookInfo fetches book metadata
 func (c *Client) GetBookInfo() error {
-	c.updateProgress("info", 15, "Retrieving book info...")
-	log.Printf("[O'Reilly] Fetching book info for ID: %s", c.bookID)
+	c.updateProgress(models.StageInfo, 0, "Retrieving book info...")
+	c.logf("[O'Reilly] Fetching book info for ID: %s", c.bookID)
 
 	apiURL := fmt.Sprintf("%s/api/v1/book/%s/", SafariBaseURL, c.bookID)
 	resp, err := c.httpClient.Get(apiURL)
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to retrieve book info: %v", err)
+		c.logf("[O'Reilly] ERROR: Failed to retrieve book info: %v", err)
 		return fmt.Errorf("failed to retrieve book info: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Printf("[O'Reilly] ERROR: Book not found, status code: %d", resp.StatusCode)
+		c.checkAuthStatus(resp.StatusCode)
+		c.logf("[O'Reilly] ERROR: Book not found, status code: %d", resp.StatusCode)
 		return fmt.Errorf("book not found or API error (status: %d)", resp.StatusCode)
 	}
 
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to retrieve book info: %v", err)
+		return fmt.Errorf("failed to retrieve book info: %w", err)
+	}
+
 	var bookInfo models.BookInfo
-	if err := json.NewDecoder(resp.Body).Decode(&bookInfo); err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to parse book info: %v", err)
+	if err := json.Unmarshal(data, &bookInfo); err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to parse book info: %v", err)
 		return fmt.Errorf("failed to parse book info: %w", err)
 	}
 
+	// Only the number of chapters is kept, as part of the book's fingerprint
+	var chapterList struct {
+		Chapters []json.RawMessage `json:"chapters"`
+	}
+	if json.Unmarshal(data, &chapterList) == nil {
+		bookInfo.ChapterCount = len(chapterList.Chapters)
+	}
+
+	// Companion audio is only surfaced (see AudioLinks)
+	bookInfo.AudioURLs = audioURLsInJSON(data)
+	if len(bookInfo.AudioURLs) > 0 {
+		c.logf("[Audio] Book info lists %d audio file(s)", len(bookInfo.AudioURLs))
+	}
+
 	// Replace nil values with "n/a"
 	if bookInfo.Title == "" {
-		log.Printf("[O'Reilly] ERROR: Invalid book data - no title")
+		c.logf("[O'Reilly] ERROR: Invalid book data - no title")
 		return fmt.Errorf("invalid book data")
 	}
 
-	log.Printf("[O'Reilly] Successfully fetched book info: %s", bookInfo.Title)
-	log.Printf("[O'Reilly] Authors: %d, Cover URL: %s", len(bookInfo.Authors), bookInfo.Cover)
+	c.logf("[O'Reilly] Successfully fetched book info: %s", bookInfo.Title)
+	c.logf("[O'Reilly] Authors: %d, Cover URL: %s", len(bookInfo.Authors), bookInfo.Cover)
 	c.bookInfo = &bookInfo
 	return nil
 }
 
 // GetChapters fetches book chapters (with pagination support)
 func (c *Client) GetChapters() error {
-	c.updateProgress("chapters", 25, "Retrieving book chapters...")
-	log.Printf("[O'Reilly] Fetching chapters for book: %s", c.bookID)
+	c.updateProgress(models.StageChapters, 0, "Retrieving book chapters...")
+	c.logf("[O'Reilly] Fetching chapters for book: %s", c.bookID)
 
-	var allChapters []models.Chapter
-	page := 1
+	first, err := c.fetchChapterPage(1)
+	if err != nil {
+		return err
+	}
+	allChapters := first.Results
 
-	for {
-		apiURL := fmt.Sprintf("%s/api/v1/book/%s/chapter/?page=%d", SafariBaseURL, c.bookID, page)
-		log.Printf("[O'Reilly] Fetching chapters page %d", page)
-		
-		resp, err := c.httpClient.Get(apiURL)
+	// The first page's count tells how many pages follow, fetch them in parallel
+	next := first.Next
+	page := 1
+	if pages := first.pageCount(); next != nil && pages > 1 && ChapterPageConcurrency > 1 {
+		rest, err := c.fetchChapterPages(2, pages)
 		if err != nil {
-			log.Printf("[O'Reilly] ERROR: Failed to retrieve chapters: %v", err)
-			return fmt.Errorf("failed to retrieve chapters: %w", err)
+			return err
 		}
-		defer resp.Body.Close()
-
-		var response struct {
-			Results []models.Chapter `json:"results"`
-			Next    *string          `json:"next"`
+		for _, response := range rest {
+			allChapters = append(allChapters, response.Results...)
 		}
+		next = rest[len(rest)-1].Next
+		page = pages
+	}
 
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			log.Printf("[O'Reilly] ERROR: Failed to parse chapters: %v", err)
-			return fmt.Errorf("failed to parse chapters: %w", err)
+	// Without a count (or if chapters were added meanwhile) follow the next links
+	for next != nil && *next != "" {
+		page++
+		response, err := c.fetchChapterPage(page)
+		if err != nil {
+			return err
 		}
+		allChapters = append(allChapters, response.Results...)
+		next = response.Next
+	}
 
-		log.Printf("[O'Reilly] Found %d chapters on page %d", len(response.Results), page)
-
-		// Separate cover pages from regular chapters
-		var covers []models.Chapter
-		var regular []models.Chapter
+	c.logf("[O'Reilly] Total chapters found: %d", len(allChapters))
+	c.chapters = c.coversFirst(allChapters)
+	return nil
+}
 
-		for _, ch := range response.Results {
-			if strings.Contains(strings.ToLower(ch.Filename), "cover") || 
-			   strings.Contains(strings.ToLower(ch.Title), "cover") {
-				covers = append(covers, ch)
-				log.Printf("[O'Reilly] Found cover chapter: %s", ch.Title)
-			} else {
-				regular = append(regular, ch)
-			}
+// coversFirst moves the front cover, then the other front cover pages, to the
+// front of the whole chapter list (not just of the API page they were on).
+// Back covers and everything else keep the API order.
+func (c *Client) coversFirst(chapters []models.Chapter) []models.Chapter {
+	front := c.frontCoverIndex(chapters)
+	if front < 0 {
+		return chapters
+	}
+	c.frontCover = xhtmlFilename(chapters[front].Filename)
+	c.logf("[O'Reilly] Using %q as front cover page", chapters[front].Title)
+
+	covers := []models.Chapter{chapters[front]}
+	var regular []models.Chapter
+	for i, ch := range chapters {
+		if i == front {
+			continue
 		}
-
-		// Add covers first, then regular chapters
-		allChapters = append(allChapters, covers...)
-		allChapters = append(allChapters, regular...)
-
-		// Check if there are more pages
-		if response.Next == nil || *response.Next == "" {
-			break
+		if isCoverChapter(ch) && !isBackCoverChapter(ch) {
+			covers = append(covers, ch)
+			c.logf("[O'Reilly] Found cover chapter: %s", ch.Title)
+		} else {
+			regular = append(regular, ch)
 		}
-		page++
 	}
-
-	log.Printf("[O'Reilly] Total chapters found: %d", len(allChapters))
-	c.chapters = allChapters
-	return nil
+	return append(covers, regular...)
 }
 
 // createDirectories creates necessary directory structure
 func (c *Client) createDirectories() error {
 	// Ensure tmp books directory exists
-	os.MkdirAll(tmpBooksDir, 0755)
+	os.MkdirAll(BooksDir, 0755)
 	
 	cleanTitle := cleanFilename(c.bookInfo.Title)
-	c.bookPath = filepath.Join(tmpBooksDir, fmt.Sprintf("%s (%s)", cleanTitle, c.bookID))
+	dirName := fmt.Sprintf("%s (%s)", cleanTitle, c.bookID)
+	if c.jobID != "" {
+		dirName += "_" + c.jobID
+	}
+	c.bookPath = filepath.Join(BooksDir, dirName)
 
 	dirs := []string{
 		c.bookPath,
@@ -293,55 +537,103 @@ func cleanFilename(name string) string {
 	return strings.TrimSpace(clean)
 }
 
-// downloadCover downloads the book cover image
+// xhtmlFilename returns the output file name of a chapter: .html/.htm become
+// .xhtml, .xhtml is kept and names without an extension get one
+func xhtmlFilename(name string) string {
+	ext := filepath.Ext(name)
+	switch strings.ToLower(ext) {
+	case ".xhtml":
+		return name
+	case ".html", ".htm":
+		return strings.TrimSuffix(name, ext) + ".xhtml"
+	}
+	return name + ".xhtml"
+}
+
+// xhtmlHref normalizes the file part of a chapter reference, keeping any #fragment
+func xhtmlHref(href string) string {
+	file, fragment, hasFragment := strings.Cut(href, "#")
+	if file == "" {
+		return href
+	}
+	file = xhtmlFilename(filepath.Base(file))
+	if hasFragment {
+		return file + "#" + fragment
+	}
+	return file
+}
+
+// downloadCover downloads the book cover image (a user-supplied cover wins when valid)
 func (c *Client) downloadCover() error {
+	if c.customCover != "" {
+		c.updateProgress(models.StageCover, 0, "Downloading custom cover...")
+		data, contentType, err := c.fetchCustomCover()
+		if err == nil {
+			err = c.saveCover(data, contentType)
+		}
+		if err == nil {
+			c.customCoverUsed = true
+			return nil
+		}
+		c.logf("[O'Reilly] WARNING: Custom cover rejected, using the book's cover: %v", err)
+	}
+
 	if c.bookInfo.Cover == "" {
-		log.Printf("[O'Reilly] No cover URL found in book info")
+		c.logf("[O'Reilly] No cover URL found in book info, the first page will provide one")
 		return nil
 	}
 
-	log.Printf("[O'Reilly] Downloading cover from: %s", c.bookInfo.Cover)
-	c.updateProgress("cover", 28, "Downloading book cover...")
+	c.logf("[O'Reilly] Downloading cover from: %s", c.bookInfo.Cover)
+	c.updateProgress(models.StageCover, 0, "Downloading book cover...")
 
-	resp, err := c.httpClient.Get(c.bookInfo.Cover)
+	// Covers from an external catalogue (see ApplyEnrichment) don't get the session cookies
+	httpClient := c.httpClient
+	if c.externalCover {
+		httpClient = metadataHTTPClient
+	}
+
+	resp, err := httpClient.Get(c.bookInfo.Cover)
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to download cover: %v", err)
+		c.logf("[O'Reilly] ERROR: Failed to download cover: %v", err)
 		return fmt.Errorf("failed to download cover: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Printf("[O'Reilly] ERROR: Cover download failed with status: %d", resp.StatusCode)
+		c.logf("[O'Reilly] ERROR: Cover download failed with status: %d", resp.StatusCode)
 		return fmt.Errorf("cover download failed: status %d", resp.StatusCode)
 	}
 
-	// Determine file extension from Content-Type
-	contentType := resp.Header.Get("Content-Type")
-	ext := "jpg"
-	if strings.Contains(contentType, "png") {
-		ext = "png"
-	} else if strings.Contains(contentType, "gif") {
-		ext = "gif"
+	// Read at most one byte over the cap so oversized covers are detected
+	data, err := io.ReadAll(io.LimitReader(c.throttle(resp.Body), MaxCoverSize+1))
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to read cover: %v", err)
+		return fmt.Errorf("failed to read cover: %w", err)
 	}
 
-	coverFilename := "cover." + ext
-	coverPath := filepath.Join(c.bookPath, "OEBPS", "Images", coverFilename)
+	return c.saveCover(data, resp.Header.Get("Content-Type"))
+}
 
-	// Save cover image
-	out, err := os.Create(coverPath)
+// saveCover validates cover image data, saves it and creates the cover.xhtml page
+func (c *Client) saveCover(data []byte, contentType string) error {
+	// Reject HTML error pages, truncated or oversized files (the chapter scan picks a cover instead)
+	ext, err := validateCover(contentType, data)
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to create cover file: %v", err)
+		c.logf("[O'Reilly] WARNING: Rejecting cover: %v", err)
 		return err
 	}
-	defer out.Close()
 
-	written, err := io.Copy(out, resp.Body)
-	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to write cover file: %v", err)
+	coverFilename := "cover." + ext
+	coverPath := filepath.Join(c.bookPath, "OEBPS", "Images", coverFilename)
+
+	// Save cover image
+	if err := os.WriteFile(coverPath, data, 0644); err != nil {
+		c.logf("[O'Reilly] ERROR: Failed to create cover file: %v", err)
 		return err
 	}
+	written := len(data)
 
-	log.Printf("[O'Reilly] Cover image downloaded successfully (%d bytes): %s", written, coverFilename)
+	c.logf("[O'Reilly] Cover image downloaded successfully (%d bytes): %s", written, coverFilename)
 	c.coverImage = coverFilename
 	c.imageFiles = append(c.imageFiles, coverFilename)
 
@@ -359,23 +651,25 @@ img { max-width: 100%%; }
 <div id="sbo-rt-content">
 <img src="Images/%s" alt="Cover"/>
 </div>
-</body>
-</html>`, coverFilename)
+%s</body>
+</html>`, coverFilename, c.sourceLinkHTML())
 
 	coverHTMLPath := filepath.Join(c.bookPath, "OEBPS", "cover.xhtml")
 	if err := os.WriteFile(coverHTMLPath, []byte(coverHTML), 0644); err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to create cover.xhtml: %v", err)
+		c.logf("[O'Reilly] ERROR: Failed to create cover.xhtml: %v", err)
 		return err
 	}
 
-	log.Printf("[O'Reilly] Created cover.xhtml page")
+	c.coverXHTML = true
+	c.logf("[O'Reilly] Created cover.xhtml page")
 	return nil
 }
 
 // DownloadContent downloads all chapters with concurrency
 func (c *Client) DownloadContent() error {
 	totalChapters := len(c.chapters)
-	log.Printf("[O'Reilly] Starting concurrent download of %d chapters", totalChapters)
+	c.logf("[O'Reilly] Starting concurrent download of %d chapters", totalChapters)
+	c.contentSelector = c.resolveContentSelector()
 
 	// Use concurrency for faster downloads (max 5 concurrent downloads)
 	maxConcurrent := 5
@@ -389,8 +683,13 @@ func (c *Client) DownloadContent() error {
 		idx     int
 	}
 	
+	type chapterResult struct {
+		idx int
+		err error
+	}
+	
 	jobs := make(chan chapterJob, totalChapters)
-	results := make(chan error, totalChapters)
+	results := make(chan chapterResult, totalChapters)
 	
 	// Progress tracking
 	completed := 0
@@ -400,11 +699,11 @@ func (c *Client) DownloadContent() error {
 	for w := 0; w < maxConcurrent; w++ {
 		go func(workerID int) {
 			for job := range jobs {
-				log.Printf("[O'Reilly] Worker %d: Downloading chapter %d/%d: %s", 
+				c.logf("[O'Reilly] Worker %d: Downloading chapter %d/%d: %s", 
 					workerID, job.idx+1, totalChapters, job.chapter.Title)
 				
 				err := c.downloadChapter(job.chapter, job.idx == 0)
-				results <- err
+				results <- chapterResult{idx: job.idx, err: err}
 				progressChan <- 1
 			}
 		}(w)
@@ -424,29 +723,55 @@ func (c *Client) DownloadContent() error {
 	// Collect results and update progress
 	go func() {
 		for range progressChan {
-			completed++
-			progress := 30 + int((float64(completed)/float64(totalChapters))*20)
-			c.updateProgress("download", progress,
+			if completed < totalChapters {
+				completed++
+			}
+			c.updateProgress(models.StageDownload, completed*100/totalChapters,
 				fmt.Sprintf("Downloaded %d/%d chapters", completed, totalChapters))
 		}
 	}()
 
-	// Wait for all downloads to complete
-	var lastErr error
+	// Wait for all downloads to complete, keeping every failure (in chapter order)
+	failed := make(map[int]bool)
+	var chapterErrs ChapterErrors
 	for i := 0; i < totalChapters; i++ {
-		if err := <-results; err != nil {
-			log.Printf("[O'Reilly] ERROR: Failed to download chapter: %v", err)
-			lastErr = err
+		if result := <-results; result.err != nil {
+			c.logf("[O'Reilly] ERROR: Failed to download chapter: %v", result.err)
+			failed[result.idx] = true
+			chapterErrs = append(chapterErrs, &ChapterError{
+				Index:   result.idx,
+				Chapter: c.chapters[result.idx].Title,
+				Err:     result.err,
+			})
 		}
 	}
 	
 	close(progressChan)
 
-	if lastErr != nil {
-		return fmt.Errorf("some chapters failed to download: %w", lastErr)
+	if len(chapterErrs) > 0 {
+		sort.Slice(chapterErrs, func(i, j int) bool { return chapterErrs[i].Index < chapterErrs[j].Index })
+		c.mu.Lock()
+		c.chapterErrors = chapterErrs
+		c.mu.Unlock()
+
+		// No tolerance for teaser pages, the rest of the book is locked too
+		for _, chapterErr := range chapterErrs {
+			if errors.Is(chapterErr.Err, ErrPaywalled) {
+				c.logf("[O'Reilly] ERROR: Chapter pages are paywalled: %v", chapterErr.Err)
+				return chapterErr.Err
+			}
+		}
+
+		if !chapterFailuresTolerated(len(failed), totalChapters) {
+			return fmt.Errorf("%d of %d chapters failed to download: %w", len(failed), totalChapters, chapterErrs)
+		}
+		c.skipChapters(failed)
+		c.trimEmptyChapters()
+		return nil
 	}
 
-	log.Printf("[O'Reilly] All %d chapters downloaded successfully", totalChapters)
+	c.logf("[O'Reilly] All %d chapters downloaded successfully", totalChapters)
+	c.trimEmptyChapters()
 	return nil
 }
 
@@ -458,18 +783,47 @@ func (c *Client) downloadChapter(chapter *models.Chapter, isFirst bool) error {
 		return err
 	}
 	defer resp.Body.Close()
+	c.checkAuthStatus(resp.StatusCode)
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	data, err := io.ReadAll(c.throttle(resp.Body))
 	if err != nil {
 		return err
 	}
 
+	// One malformed page shouldn't fail the book: keep its text instead
+	doc, err := parseChapterHTML(data)
+	if err != nil {
+		c.warnf("Chapter %q could not be parsed (%v), saved as plain text", chapter.Title, err)
+		return c.saveRawChapter(chapter, data)
+	}
+
 	// Extract main content
-	content := doc.Find("#sbo-rt-content")
+	content := doc.Find(c.contentSelector).First()
+
+	// A teaser instead of the chapter would end up in the book as "subscribe to read"
+	// (a teaser may lack the content container, then the page body is checked)
+	teaser := content
+	if teaser.Length() == 0 {
+		teaser = doc.Find("body")
+	}
+	if marker := paywallMarker(teaser); marker != "" {
+		return fmt.Errorf("%w (chapter %q contains %q)", ErrPaywalled, chapter.Title, marker)
+	}
+
 	if content.Length() == 0 {
-		return fmt.Errorf("book content not found in page")
+		return fmt.Errorf("book content not found in page (selector %q)", c.contentSelector)
 	}
 
+	// Placeholder chapters would only add blank pages. The file is still
+	// written: trimEmptyChapters may keep it after all (and removes it otherwise).
+	if TrimEmptyChapters && isEmptyChapter(chapter, content) {
+		c.logf("[O'Reilly] Chapter %q is empty, leaving it out", chapter.Title)
+		c.markEmptyChapter(chapter)
+	}
+
+	// Count the words while the text is in memory
+	c.recordWords(chapter, content)
+
 	// Process stylesheets
 	pageCSS := c.processStylesheets(doc, chapter)
 
@@ -479,27 +833,37 @@ func (c *Client) downloadChapter(chapter *models.Chapter, isFirst bool) error {
 	// Process images
 	c.processImages(content, chapter)
 
+	// Companion audio (<audio>), embedded with include_audio
+	c.processAudio(content, chapter)
+
 	// Get cover from first page
 	if isFirst && c.coverImage == "" {
 		c.extractCover(content)
 	}
 
+	// Record code/sample archive links before links are rewritten
+	c.collectExtras(content)
+
 	// Fix links
 	c.fixLinks(content)
 
+	filename := xhtmlFilename(chapter.Filename)
+
+	// Keep print page markers (EPUB3 page-list)
+	c.processPageBreaks(content, filename)
+
 	// Generate XHTML
 	contentHTML, _ := content.Html()
 	xhtml := fmt.Sprintf(baseHTML, pageCSS, contentHTML)
 
 	// Save chapter
-	filename := strings.Replace(chapter.Filename, ".html", ".xhtml", 1)
 	filepath := filepath.Join(c.bookPath, "OEBPS", filename)
 	
 	return os.WriteFile(filepath, []byte(xhtml), 0644)
 }
 
 const baseHTML = `<!DOCTYPE html>
-<html lang="en" xmlns="http://www.w3.org/1999/xhtml">
+<html lang="en" xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
 <head>
 %s
 <style type="text/css">
@@ -522,7 +886,7 @@ func (c *Client) processStylesheets(doc *goquery.Document, chapter *models.Chapt
 			c.cssFiles = append(c.cssFiles, ss.URL)
 			cssIdx := len(c.cssFiles) - 1
 			c.mu.Unlock()
-			c.downloadAsset(ss.URL, "Styles", fmt.Sprintf("Style%02d.css", cssIdx))
+			c.downloadAsset(ss.URL, chapterReferer(chapter), "Styles", fmt.Sprintf("Style%02d.css", cssIdx))
 			c.mu.Lock()
 		}
 		idx := indexOf(c.cssFiles, ss.URL)
@@ -538,7 +902,7 @@ func (c *Client) processStylesheets(doc *goquery.Document, chapter *models.Chapt
 			c.cssFiles = append(c.cssFiles, ss)
 			cssIdx := len(c.cssFiles) - 1
 			c.mu.Unlock()
-			c.downloadAsset(ss, "Styles", fmt.Sprintf("Style%02d.css", cssIdx))
+			c.downloadAsset(ss, chapterReferer(chapter), "Styles", fmt.Sprintf("Style%02d.css", cssIdx))
 			c.mu.Lock()
 		}
 		idx := indexOf(c.cssFiles, ss)
@@ -592,7 +956,7 @@ func (c *Client) convertSVGImages(doc *goquery.Document) {
 				svg.Remove()
 				svgParent.AppendHtml(imgHTML)
 				
-				log.Printf("[O'Reilly] Converted SVG image tag to img: %s", svgURL)
+				c.logf("[O'Reilly] Converted SVG image tag to img: %s", svgURL)
 			}
 		}
 	})
@@ -600,28 +964,23 @@ func (c *Client) convertSVGImages(doc *goquery.Document) {
 
 // processImages downloads images from chapter metadata and HTML content
 func (c *Client) processImages(content *goquery.Selection, chapter *models.Chapter) {
-	log.Printf("[O'Reilly] Processing images for chapter: %s", chapter.Title)
-	
-	assetBaseURL := chapter.AssetBaseURL
-	apiV2Detected := strings.Contains(chapter.Content, "/api/v2/")
-	
-	if apiV2Detected || assetBaseURL == "" {
-		assetBaseURL = fmt.Sprintf("%s/api/v2/epubs/urn:orm:book:%s/files", SafariBaseURL, c.bookID)
-		log.Printf("[O'Reilly] Using API v2 asset base URL")
+	c.logf("[O'Reilly] Processing images for chapter: %s", chapter.Title)
+
+	// Relative paths resolve against the v1 or v2 asset API, whichever serves them
+	download := func(src, filename string) error {
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+			return c.downloadAsset(src, chapterReferer(chapter), "Images", filename)
+		}
+		if strings.HasPrefix(src, "/") {
+			// Absolute path
+			return c.downloadAsset(SafariBaseURL+src, chapterReferer(chapter), "Images", filename)
+		}
+		return c.downloadRelativeAsset(chapter, src, "Images", filename)
 	}
 
 	// Download images from chapter metadata
-	log.Printf("[O'Reilly] Chapter has %d images in metadata", len(chapter.Images))
+	c.logf("[O'Reilly] Chapter has %d images in metadata", len(chapter.Images))
 	for _, imgURL := range chapter.Images {
-		fullURL := imgURL
-		if !strings.HasPrefix(imgURL, "http") {
-			if apiV2Detected {
-				fullURL = assetBaseURL + "/" + imgURL
-			} else {
-				fullURL = assetBaseURL + "/" + imgURL
-			}
-		}
-		
 		filename := filepath.Base(imgURL)
 		c.mu.Lock()
 		alreadyExists := contains(c.imageFiles, filename)
@@ -631,9 +990,9 @@ func (c *Client) processImages(content *goquery.Selection, chapter *models.Chapt
 		c.mu.Unlock()
 		
 		if !alreadyExists {
-			log.Printf("[O'Reilly] Downloading image from metadata: %s", filename)
-			if err := c.downloadAsset(fullURL, "Images", filename); err != nil {
-				log.Printf("[O'Reilly] WARNING: Failed to download image %s: %v", filename, err)
+			c.logf("[O'Reilly] Downloading image from metadata: %s", filename)
+			if err := download(imgURL, filename); err != nil {
+				c.logf("[O'Reilly] WARNING: Failed to download image %s: %v", filename, err)
 			}
 		}
 	}
@@ -642,27 +1001,8 @@ func (c *Client) processImages(content *goquery.Selection, chapter *models.Chapt
 	content.Find("img").Each(func(i int, img *goquery.Selection) {
 		src, exists := img.Attr("src")
 		if exists && src != "" {
-			// Determine full URL for the image
-			var fullURL string
 			filename := filepath.Base(src)
 			
-			if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
-				fullURL = src
-			} else if strings.HasPrefix(src, "/") {
-				// Absolute path
-				fullURL = SafariBaseURL + src
-			} else if strings.Contains(src, "images/") || strings.Contains(src, "graphics/") || strings.Contains(src, "cover") {
-				// Relative image path
-				if apiV2Detected {
-					fullURL = assetBaseURL + "/" + src
-				} else {
-					fullURL = assetBaseURL + "/" + src
-				}
-			} else {
-				// Try asset base URL
-				fullURL = assetBaseURL + "/" + src
-			}
-			
 			c.mu.Lock()
 			alreadyExists := contains(c.imageFiles, filename)
 			if !alreadyExists {
@@ -671,59 +1011,127 @@ func (c *Client) processImages(content *goquery.Selection, chapter *models.Chapt
 			c.mu.Unlock()
 			
 			if !alreadyExists {
-				log.Printf("[O'Reilly] Downloading image from HTML: %s (from src: %s)", filename, src)
-				if err := c.downloadAsset(fullURL, "Images", filename); err != nil {
-					log.Printf("[O'Reilly] WARNING: Failed to download image %s from %s: %v", filename, fullURL, err)
+				c.logf("[O'Reilly] Downloading image from HTML: %s (from src: %s)", filename, src)
+				if err := download(src, filename); err != nil {
+					c.logf("[O'Reilly] WARNING: Failed to download image %s from %s: %v", filename, src, err)
 				}
 			}
 		}
 	})
 	
-	log.Printf("[O'Reilly] Total unique images collected: %d", len(c.imageFiles))
+	c.logf("[O'Reilly] Total unique images collected: %d", len(c.imageFiles))
+}
+
+// chapterReferer returns the page an asset is embedded in, sent as Referer
+// because some protected images are refused without it
+func chapterReferer(chapter *models.Chapter) string {
+	if chapter.Content != "" {
+		return chapter.Content
+	}
+	return chapter.URL
 }
 
-// downloadAsset downloads an asset (CSS or image)
-func (c *Client) downloadAsset(url, subdir, filename string) error {
-	log.Printf("[O'Reilly] Downloading asset: %s to %s/%s", url, subdir, filename)
+// downloadAsset downloads an asset (CSS or image) referenced by the referer page
+func (c *Client) downloadAsset(url, referer, subdir, filename string) error {
+	c.logf("[O'Reilly] Downloading asset: %s to %s/%s", url, subdir, filename)
+	
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: Invalid asset URL %s: %v", url, err)
+		return err
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
 	
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to download asset from %s: %v", url, err)
+		c.logf("[O'Reilly] ERROR: Failed to download asset from %s: %v", url, err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Printf("[O'Reilly] ERROR: Asset download failed with status %d: %s", resp.StatusCode, url)
+		c.logf("[O'Reilly] ERROR: Asset download failed with status %d: %s", resp.StatusCode, url)
 		return fmt.Errorf("download failed with status %d", resp.StatusCode)
 	}
 
 	assetPath := filepath.Join(c.bookPath, "OEBPS", subdir, filename)
 	file, err := os.Create(assetPath)
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to create file %s: %v", assetPath, err)
+		c.logf("[O'Reilly] ERROR: Failed to create file %s: %v", assetPath, err)
 		return err
 	}
 	defer file.Close()
 
-	written, err := io.Copy(file, resp.Body)
+	written, err := io.Copy(file, c.throttle(resp.Body))
 	if err != nil {
-		log.Printf("[O'Reilly] ERROR: Failed to write asset %s: %v", filename, err)
+		c.logf("[O'Reilly] ERROR: Failed to write asset %s: %v", filename, err)
 		return err
 	}
 	
-	log.Printf("[O'Reilly] Successfully downloaded asset: %s (%d bytes)", filename, written)
+	c.logf("[O'Reilly] Successfully downloaded asset: %s (%d bytes)", filename, written)
+	if OptimizeImages && subdir == "Images" {
+		file.Close()
+		if saved := c.optimizeImage(assetPath); saved > 0 {
+			c.logf("[O'Reilly] Optimized %s: %d bytes saved", filename, saved)
+		}
+	}
 	return nil
 }
 
-// extractCover extracts cover image
+// extractCover picks a cover from the first content page when the book info has
+// no usable cover: an image named like a cover, otherwise the largest image
 func (c *Client) extractCover(content *goquery.Selection) {
-	content.Find("img").Each(func(i int, img *goquery.Selection) {
+	imagesDir := filepath.Join(c.bookPath, "OEBPS", "Images")
+	best := ""
+	var bestArea, bestBytes int64
+
+	content.Find("img").EachWithBreak(func(i int, img *goquery.Selection) bool {
 		src, exists := img.Attr("src")
-		if exists && (strings.Contains(src, "cover") || i == 0) {
-			c.coverImage = filepath.Base(src)
+		if !exists || src == "" {
+			return true
+		}
+		name := filepath.Base(src)
+		if strings.Contains(strings.ToLower(name), "cover") {
+			best = name
+			return false
+		}
+
+		area, size := imageDimensions(filepath.Join(imagesDir, name))
+		if size == 0 {
+			return true // Not downloaded
+		}
+		if area > bestArea || (area == bestArea && size > bestBytes) {
+			best, bestArea, bestBytes = name, area, size
 		}
+		return true
 	})
+
+	if best != "" {
+		c.logf("[O'Reilly] Using %s from the first page as cover", best)
+		c.coverImage = best
+	}
+}
+
+// imageDimensions returns the pixel area (0 if undecodable, e.g. SVG) and file size of an image
+func imageDimensions(path string) (int64, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0
+	}
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, info.Size()
+	}
+	return int64(config.Width) * int64(config.Height), info.Size()
 }
 
 // fixLinks fixes relative links in content (matching Python link_replace logic)
@@ -747,8 +1155,15 @@ func (c *Client) fixLinks(content *goquery.Selection) {
 			}
 		}
 		
-		// Replace .html with .xhtml
-		newHref := strings.Replace(href, ".html", ".xhtml", 1)
+		// Point chapter links (.html/.htm) at the .xhtml files
+		file, fragment, hasFragment := strings.Cut(href, "#")
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".html" || ext == ".htm" {
+			file = xhtmlFilename(file)
+		}
+		newHref := file
+		if hasFragment {
+			newHref += "#" + fragment
+		}
 		a.SetAttr("href", newHref)
 	})
 
@@ -806,6 +1221,14 @@ func (c *Client) GetBookTitle() string {
 	return "Unknown"
 }
 
+// TOC returns the parsed table of contents (nil if it was never fetched, e.g. for CBZ)
+func (c *Client) TOC() []models.TOCItem {
+	if c.toc == nil {
+		return nil
+	}
+	return c.withoutSkipped(c.toc)
+}
+
 // GetBookInfoData returns the book info
 func (c *Client) GetBookInfoData() *models.BookInfo {
 	return c.bookInfo
@@ -813,7 +1236,7 @@ func (c *Client) GetBookInfoData() *models.BookInfo {
 
 // CreateEPUB generates the EPUB file
 func (c *Client) CreateEPUB() (string, error) {
-	c.updateProgress("epub", 50, "Creating EPUB structure...")
+	c.updateProgress(models.StageEPUB, 0, "Creating EPUB structure...")
 
 	// Create META-INF/container.xml
 	containerXML := `<?xml version="1.0"?>
@@ -832,8 +1255,15 @@ func (c *Client) CreateEPUB() (string, error) {
 		return "", err
 	}
 
+	// Front page of a preview build
+	if c.IsPreview() {
+		if err := c.writePreviewPage(); err != nil {
+			return "", err
+		}
+	}
+
 	// Create content.opf
-	c.updateProgress("epub", 60, "Generating content.opf...")
+	c.updateProgress(models.StageEPUB, 20, "Generating content.opf...")
 	contentOPF, err := c.createContentOPF()
 	if err != nil {
 		return "", err
@@ -843,7 +1273,7 @@ func (c *Client) CreateEPUB() (string, error) {
 	}
 
 	// Create toc.ncx
-	c.updateProgress("epub", 70, "Generating toc.ncx...")
+	c.updateProgress(models.StageEPUB, 40, "Generating toc.ncx...")
 	tocNCX, err := c.createTOC()
 	if err != nil {
 		return "", err
@@ -852,37 +1282,52 @@ func (c *Client) CreateEPUB() (string, error) {
 		return "", err
 	}
 
+	// Create nav.xhtml (EPUB3 navigation document, toc.ncx is kept for older readers)
+	if isEPUB3() {
+		if err := os.WriteFile(filepath.Join(c.bookPath, "OEBPS", "nav.xhtml"), []byte(c.createNav(c.withoutSkipped(c.toc))), 0644); err != nil {
+			return "", err
+		}
+	}
+
 	// Create ZIP/EPUB
-	c.updateProgress("epub", 80, "Packaging EPUB...")
+	c.updateProgress(models.StageEPUB, 60, "Packaging EPUB...")
 	epubPath := filepath.Join(c.bookPath, c.bookID+".epub")
 	if err := c.createZIP(epubPath); err != nil {
 		return "", err
 	}
 
-	c.updateProgress("epub", 100, "EPUB created successfully!")
+	c.updateProgress(models.StageEPUB, 100, "EPUB created successfully!")
 	return epubPath, nil
 }
 
 // createContentOPF generates content.opf file
 func (c *Client) createContentOPF() (string, error) {
-	log.Printf("[O'Reilly] Creating content.opf manifest...")
+	c.logf("[O'Reilly] Creating content.opf manifest...")
 	
 	var manifest strings.Builder
 	var spine strings.Builder
 
 	// Add cover.xhtml first if we have a cover
-	if c.coverImage != "" {
-		log.Printf("[O'Reilly] Adding cover.xhtml to manifest and spine")
+	if c.coverXHTML {
+		c.logf("[O'Reilly] Adding cover.xhtml to manifest and spine")
 		manifest.WriteString(`<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml" />`)
 		manifest.WriteString("\n")
 		spine.WriteString(`<itemref idref="cover"/>`)
 		spine.WriteString("\n")
 	}
 
+	// The preview notice comes right after the cover
+	if c.IsPreview() {
+		manifest.WriteString(fmt.Sprintf(`<item id="preview" href="%s" media-type="application/xhtml+xml" />`, previewPage))
+		manifest.WriteString("\n")
+		spine.WriteString(`<itemref idref="preview"/>`)
+		spine.WriteString("\n")
+	}
+
 	// Add chapters
-	log.Printf("[O'Reilly] Adding %d chapters to manifest", len(c.chapters))
+	c.logf("[O'Reilly] Adding %d chapters to manifest", len(c.chapters))
 	for _, chapter := range c.chapters {
-		filename := strings.Replace(chapter.Filename, ".html", ".xhtml", 1)
+		filename := xhtmlFilename(chapter.Filename)
 		itemID := html.EscapeString(strings.TrimSuffix(filename, filepath.Ext(filename)))
 		
 		manifest.WriteString(fmt.Sprintf(`<item id="%s" href="%s" media-type="application/xhtml+xml" />`, itemID, filename))
@@ -893,7 +1338,7 @@ func (c *Client) createContentOPF() (string, error) {
 	}
 
 	// Add images
-	log.Printf("[O'Reilly] Adding %d images to manifest", len(c.imageFiles))
+	c.logf("[O'Reilly] Adding %d images to manifest", len(c.imageFiles))
 	for _, img := range c.imageFiles {
 		ext := strings.ToLower(filepath.Ext(img))
 		imgName := strings.TrimSuffix(img, ext)
@@ -910,27 +1355,54 @@ func (c *Client) createContentOPF() (string, error) {
 		
 		// Use "coverimg" as ID for cover image
 		imgID := "img_" + html.EscapeString(imgName)
+		properties := ""
 		if img == c.coverImage {
 			imgID = "coverimg"
+			if isEPUB3() {
+				properties = ` properties="cover-image"`
+			}
 		}
 		
-		manifest.WriteString(fmt.Sprintf(`<item id="%s" href="Images/%s" media-type="%s" />`,
-			imgID, img, mimeType))
+		manifest.WriteString(fmt.Sprintf(`<item id="%s" href="Images/%s" media-type="%s"%s />`,
+			imgID, img, mimeType, properties))
 		manifest.WriteString("\n")
 	}
 
+	// Add audio (include_audio)
+	if len(c.audioFiles) > 0 {
+		c.logf("[O'Reilly] Adding %d audio files to manifest", len(c.audioFiles))
+		manifest.WriteString(c.audioManifest())
+	}
+
 	// Add CSS
-	log.Printf("[O'Reilly] Adding %d CSS files to manifest", len(c.cssFiles))
+	c.logf("[O'Reilly] Adding %d CSS files to manifest", len(c.cssFiles))
 	for i := range c.cssFiles {
 		manifest.WriteString(fmt.Sprintf(`<item id="style_%02d" href="Styles/Style%02d.css" media-type="text/css" />`, i, i))
 		manifest.WriteString("\n")
 	}
 
-	// Build authors
+	// EPUB3 navigation document
+	packageVersion := "2.0"
+	if isEPUB3() {
+		packageVersion = "3.0"
+		manifest.WriteString(`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav" />`)
+		manifest.WriteString("\n")
+	}
+
+	// Build authors (EPUB3 drops the opf: attributes in favour of refining meta elements)
 	var authors strings.Builder
-	for _, author := range c.bookInfo.Authors {
-		authors.WriteString(fmt.Sprintf(`<dc:creator opf:file-as="%s" opf:role="aut">%s</dc:creator>`,
-			html.EscapeString(author.Name), html.EscapeString(author.Name)))
+	for i, author := range c.bookInfo.Authors {
+		name := html.EscapeString(author.Name)
+		if isEPUB3() {
+			authors.WriteString(fmt.Sprintf(`<dc:creator id="creator%02d">%s</dc:creator>`, i, name))
+			authors.WriteString("\n")
+			authors.WriteString(fmt.Sprintf(`<meta refines="#creator%02d" property="file-as">%s</meta>`, i, name))
+			authors.WriteString("\n")
+			authors.WriteString(fmt.Sprintf(`<meta refines="#creator%02d" property="role" scheme="marc:relators">%s</meta>`, i, author.MARCRole()))
+		} else {
+			authors.WriteString(fmt.Sprintf(`<dc:creator opf:file-as="%s" opf:role="%s">%s</dc:creator>`,
+				name, author.MARCRole(), name))
+		}
 		authors.WriteString("\n")
 	}
 
@@ -955,14 +1427,24 @@ func (c *Client) createContentOPF() (string, error) {
 		isbn = c.bookID
 	}
 
-	// Cover reference for guide
-	coverPageRef := "cover.xhtml"
-	if c.coverImage == "" && len(c.chapters) > 0 {
-		coverPageRef = strings.Replace(c.chapters[0].Filename, ".html", ".xhtml", 1)
+	// EPUB2 points readers at the cover with a guide, EPUB3 uses the nav landmarks instead
+	guide := ""
+	if !isEPUB3() {
+		coverPageRef := c.coverPageRef()
+		if coverPageRef == "" && len(c.chapters) > 0 {
+			coverPageRef = xhtmlFilename(c.chapters[0].Filename)
+		}
+		guide = fmt.Sprintf("<guide><reference href=\"%s\" title=\"Cover\" type=\"cover\" /></guide>\n", coverPageRef)
+	}
+
+	// EPUB3 requires a last-modified timestamp (UTC, second precision)
+	modified := ""
+	if isEPUB3() {
+		modified = fmt.Sprintf("<meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
 	}
 
 	contentOPF := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
-<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="bookid" version="2.0">
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="bookid" version="%s">
 <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
 <dc:title>%s</dc:title>
 %s
@@ -973,8 +1455,9 @@ func (c *Client) createContentOPF() (string, error) {
 <dc:language>en-US</dc:language>
 <dc:date>%s</dc:date>
 <dc:identifier id="bookid">%s</dc:identifier>
-<meta name="cover" content="coverimg"/>
-</metadata>
+%s<meta name="cover" content="coverimg"/>
+<meta name="generator" content="%s"/>
+%s</metadata>
 <manifest>
 <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml" />
 %s
@@ -982,40 +1465,73 @@ func (c *Client) createContentOPF() (string, error) {
 <spine toc="ncx">
 %s
 </spine>
-<guide><reference href="%s" title="Cover" type="cover" /></guide>
-</package>`,
+%s</package>`,
+		packageVersion,
 		html.EscapeString(c.bookInfo.Title),
 		authors.String(),
 		html.EscapeString(c.bookInfo.Description),
 		subjects.String(),
 		publishers.String(),
-		html.EscapeString(c.bookInfo.Rights),
-		c.bookInfo.Issued,
+		html.EscapeString(normalizeRights(c.bookInfo.Rights)),
+		html.EscapeString(normalizeIssued(c.bookInfo.Issued)),
 		isbn,
+		c.sourceMetadata(),
+		Generator,
+		modified,
 		manifest.String(),
 		spine.String(),
-		coverPageRef,
+		guide,
 	)
 
-	log.Printf("[O'Reilly] content.opf created successfully")
+	c.logf("[O'Reilly] content.opf created successfully")
 	return contentOPF, nil
 }
 
-// createTOC generates toc.ncx file
-func (c *Client) createTOC() (string, error) {
+// fetchTOC retrieves the book's table of contents from the API
+func (c *Client) fetchTOC() error {
 	apiURL := fmt.Sprintf("%s/api/v1/book/%s/toc/", SafariBaseURL, c.bookID)
 	resp, err := c.httpClient.Get(apiURL)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 
 	var toc []models.TOCItem
 	if err := json.NewDecoder(resp.Body).Decode(&toc); err != nil {
-		return "", err
+		return err
+	}
+
+	c.toc = toc
+	return nil
+}
+
+// prefetchTOC fetches the TOC in the background while chapters download.
+// The returned channel yields the fetch result once c.toc is set; receiving
+// from it is what makes c.toc safe to read.
+func (c *Client) prefetchTOC() <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		start := time.Now()
+		err := c.fetchTOC()
+		if err != nil {
+			c.logf("[O'Reilly] WARNING: Background TOC fetch failed after %v: %v", time.Since(start).Round(time.Millisecond), err)
+		} else {
+			c.logf("[O'Reilly] TOC fetched in background in %v", time.Since(start).Round(time.Millisecond))
+		}
+		done <- err
+	}()
+	return done
+}
+
+// createTOC generates toc.ncx file
+func (c *Client) createTOC() (string, error) {
+	if c.toc == nil {
+		if err := c.fetchTOC(); err != nil {
+			return "", err
+		}
 	}
 
-	navMap, maxDepth := c.parseTOC(toc, 1)
+	navMap, maxDepth, _ := c.parseTOC(c.withoutSkipped(c.toc), 1, 1)
 
 	authors := ""
 	if len(c.bookInfo.Authors) > 0 {
@@ -1050,18 +1566,16 @@ func (c *Client) createTOC() (string, error) {
 	return tocNCX, nil
 }
 
-// parseTOC recursively parses TOC items
-func (c *Client) parseTOC(items []models.TOCItem, playOrder int) (string, int) {
+// parseTOC recursively renders TOC items as navPoints starting at playOrder.
+// It returns the nesting depth reached (level is the depth of items, counted
+// from 1, since the API's Depth field is often unset) and the next playOrder.
+func (c *Client) parseTOC(items []models.TOCItem, playOrder, level int) (string, int, int) {
 	var result strings.Builder
 	maxDepth := 0
 
 	for _, item := range items {
-		depth := item.Depth
-		if depth == 0 {
-			depth = 1
-		}
-		if depth > maxDepth {
-			maxDepth = depth
+		if level > maxDepth {
+			maxDepth = level
 		}
 
 		id := item.Fragment
@@ -1069,7 +1583,7 @@ func (c *Client) parseTOC(items []models.TOCItem, playOrder int) (string, int) {
 			id = item.ID
 		}
 
-		href := strings.Replace(filepath.Base(item.Href), ".html", ".xhtml", 1)
+		href := xhtmlHref(item.Href)
 
 		result.WriteString(fmt.Sprintf(`<navPoint id="%s" playOrder="%d">`,
 			html.EscapeString(id), playOrder))
@@ -1077,23 +1591,35 @@ func (c *Client) parseTOC(items []models.TOCItem, playOrder int) (string, int) {
 			html.EscapeString(item.Label)))
 		result.WriteString(fmt.Sprintf(`<content src="%s"/>`, href))
 
+		playOrder++
 		if len(item.Children) > 0 {
-			childNav, childDepth := c.parseTOC(item.Children, playOrder+1)
+			childNav, childDepth, next := c.parseTOC(item.Children, playOrder, level+1)
 			result.WriteString(childNav)
 			if childDepth > maxDepth {
 				maxDepth = childDepth
 			}
-			playOrder += len(item.Children)
+			playOrder = next
 		}
 
 		result.WriteString("</navPoint>\n")
-		playOrder++
 	}
 
-	return result.String(), maxDepth
+	return result.String(), maxDepth, playOrder
 }
 
+// EPUBCompression is the deflate level of the EPUB's entries: 0 stores them
+// uncompressed (fastest), 9 is the smallest (slowest). The default 6 is the
+// level zip.NewWriter uses on its own.
+var EPUBCompression = 6
+
 // createZIP creates the EPUB ZIP file
+//
+// Memory/disk profile: chapters are parsed one at a time per worker (at most
+// 5 goquery documents in memory) and written straight to disk, so memory stays
+// flat regardless of book size. Packaging reads and compresses up to
+// PackageConcurrency files at once (see packFiles), adds them in walk order and
+// removes each source once it has been added, so peak disk usage is roughly
+// the unpacked book size instead of twice that.
 func (c *Client) createZIP(epubPath string) error {
 	file, err := os.Create(epubPath)
 	if err != nil {
@@ -1101,8 +1627,15 @@ func (c *Client) createZIP(epubPath string) error {
 	}
 	defer file.Close()
 
+	started := time.Now()
+	var uncompressed int64
+
 	w := zip.NewWriter(file)
-	defer w.Close()
+	level := EPUBCompression
+	// Large files are compressed by the writer itself (see writeEntry)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
 
 	// Add mimetype first (uncompressed)
 	mimeWriter, err := w.CreateHeader(&zip.FileHeader{
@@ -1114,8 +1647,10 @@ func (c *Client) createZIP(epubPath string) error {
 	}
 	mimeWriter.Write([]byte("application/epub+zip"))
 
-	// Add all other files
-	return filepath.Walk(c.bookPath, func(path string, info os.FileInfo, err error) error {
+	// Collect all other files, then read and compress them in parallel
+	customCover := c.CustomCoverPath()
+	var paths, names []string
+	err = filepath.Walk(c.bookPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() || strings.HasSuffix(path, ".epub") {
 			return err
 		}
@@ -1124,67 +1659,154 @@ func (c *Client) createZIP(epubPath string) error {
 		if err != nil {
 			return err
 		}
+		paths = append(paths, path)
+		names = append(names, relPath)
+		return nil
+	})
+	if err == nil {
+		err = packFiles(paths, names, level, func(path string, entry packedEntry) error {
+			if err := writeEntry(w, path, entry); err != nil {
+				return err
+			}
+			uncompressed += int64(entry.header.UncompressedSize64)
 
-		zipFile, err := w.Create(relPath)
-		if err != nil {
-			return err
-		}
-
-		fsFile, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer fsFile.Close()
-
-		_, err = io.Copy(zipFile, fsFile)
+			// The archive now holds the data, free the disk space early
+			// (the custom cover is still needed by Calibre's --cover)
+			if path == customCover {
+				return nil
+			}
+			return os.Remove(path)
+		})
+	}
+	if err != nil {
+		w.Close()
 		return err
-	})
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if stat, err := file.Stat(); err == nil && uncompressed > 0 {
+		c.logf("[O'Reilly] Packaged EPUB in %v: %.2f MB from %.2f MB of %d files (%.0f%%, compression level %d, %d workers)",
+			time.Since(started).Round(time.Millisecond), float64(stat.Size())/(1024*1024), float64(uncompressed)/(1024*1024),
+			len(paths), float64(stat.Size())*100/float64(uncompressed), level, PackageConcurrency)
+	}
+	return nil
 }
 
 // Download is the main download function
 func (c *Client) Download() (string, error) {
-	log.Printf("[O'Reilly] ===== Starting book download =====")
+	c.logf("[O'Reilly] ===== Starting book download =====")
+
+	tocDone, err := c.fetchContent(PrefetchTOC)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure the background TOC fetch has finished (createTOC retries if it failed)
+	if tocDone != nil {
+		waitStart := time.Now()
+		if err := <-tocDone; err != nil {
+			c.toc = nil
+		}
+		c.logf("[O'Reilly] Waited %v for background TOC fetch", time.Since(waitStart).Round(time.Millisecond))
+	}
+
+	// Create EPUB
+	c.logf("[O'Reilly] Step 6: Creating EPUB file...")
+	epubPath, err := c.CreateEPUB()
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: EPUB creation failed: %v", err)
+		return "", err
+	}
+
+	// A "successful" book without content must not go out silently
+	if err := c.checkEPUBSize(epubPath); err != nil {
+		return "", err
+	}
 	
-	// Get book info
-	log.Printf("[O'Reilly] Step 1: Fetching book info...")
-	if err := c.GetBookInfo(); err != nil {
+	c.logf("[O'Reilly] ===== Download completed successfully =====")
+	c.logf("[O'Reilly] EPUB created at: %s", epubPath)
+	return epubPath, nil
+}
+
+// DownloadCBZ downloads the book and packages its images as a CBZ instead of an EPUB
+func (c *Client) DownloadCBZ() (string, error) {
+	c.logf("[O'Reilly] ===== Starting book download (CBZ) =====")
+
+	if _, err := c.fetchContent(false); err != nil {
 		return "", err
 	}
 
+	c.logf("[O'Reilly] Step 6: Creating CBZ file...")
+	cbzPath, err := c.CreateCBZ()
+	if err != nil {
+		c.logf("[O'Reilly] ERROR: CBZ creation failed: %v", err)
+		return "", err
+	}
+
+	c.logf("[O'Reilly] ===== Download completed successfully =====")
+	c.logf("[O'Reilly] CBZ created at: %s", cbzPath)
+	return cbzPath, nil
+}
+
+// fetchContent runs the download steps shared by every output format: book info,
+// chapter list, cover and chapter content. With prefetchTOC the TOC is fetched in
+// the background and the returned channel reports when it is done.
+func (c *Client) fetchContent(prefetchTOC bool) (<-chan error, error) {
+	// Get book info (skipped if the caller already fetched it)
+	c.logf("[O'Reilly] Step 1: Fetching book info...")
+	if c.bookInfo == nil {
+		if err := c.GetBookInfo(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get chapters
-	log.Printf("[O'Reilly] Step 2: Fetching chapters...")
+	c.logf("[O'Reilly] Step 2: Fetching chapters...")
 	if err := c.GetChapters(); err != nil {
-		return "", err
+		return nil, err
 	}
+	c.limitToPreview()
 
-	// Create directories
-	log.Printf("[O'Reilly] Step 3: Creating directory structure...")
-	if err := c.createDirectories(); err != nil {
-		return "", err
+	// The TOC is independent of the chapter content, fetch it while chapters download
+	var tocDone <-chan error
+	if prefetchTOC {
+		tocDone = c.prefetchTOC()
 	}
 
-	// Download cover
-	log.Printf("[O'Reilly] Step 4: Downloading cover image...")
-	if err := c.downloadCover(); err != nil {
-		log.Printf("[O'Reilly] WARNING: Cover download failed: %v", err)
-		// Continue even if cover fails
+	// Create directories
+	c.logf("[O'Reilly] Step 3: Creating directory structure...")
+	if err := c.createDirectories(); err != nil {
+		return tocDone, err
+	}
+
+	// Download cover (a requested cover page provides it while chapters download)
+	fromCoverPage := c.coverPage != "" && c.customCover == ""
+	if fromCoverPage {
+		c.logf("[O'Reilly] Step 4: Cover image will be taken from cover page %q", c.coverPage)
+	} else {
+		c.logf("[O'Reilly] Step 4: Downloading cover image...")
+		if err := c.downloadCover(); err != nil {
+			c.logf("[O'Reilly] WARNING: Cover download failed: %v", err)
+			// Continue even if cover fails
+		}
 	}
 
 	// Download content
-	log.Printf("[O'Reilly] Step 5: Downloading chapter content...")
+	c.logf("[O'Reilly] Step 5: Downloading chapter content...")
 	if err := c.DownloadContent(); err != nil {
-		return "", err
+		return tocDone, err
 	}
+	c.logImageSavings()
 
-	// Create EPUB
-	log.Printf("[O'Reilly] Step 6: Creating EPUB file...")
-	epubPath, err := c.CreateEPUB()
-	if err != nil {
-		log.Printf("[O'Reilly] ERROR: EPUB creation failed: %v", err)
-		return "", err
+	// The requested cover page had no image, use the book's cover after all
+	if fromCoverPage && c.coverImage == "" {
+		c.logf("[O'Reilly] Cover page %q has no image, downloading the book's cover", c.coverPage)
+		if err := c.downloadCover(); err != nil {
+			c.logf("[O'Reilly] WARNING: Cover download failed: %v", err)
+		}
 	}
-	
-	log.Printf("[O'Reilly] ===== Download completed successfully =====")
-	log.Printf("[O'Reilly] EPUB created at: %s", epubPath)
-	return epubPath, nil
+
+	return tocDone, nil
 }
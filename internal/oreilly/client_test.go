@@ -0,0 +1,121 @@
+package oreilly
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"goreilly/internal/models"
+)
+
+func TestXHTMLFilename(t *testing.T) {
+	tests := map[string]string{
+		"ch01.html":       "ch01.xhtml",
+		"ch01.htm":        "ch01.xhtml",
+		"ch01.HTM":        "ch01.xhtml",
+		"ch01.xhtml":      "ch01.xhtml",
+		"ch01":            "ch01.xhtml",
+		"part1/ch02.html": "part1/ch02.xhtml",
+		"ch03.html.bak":   "ch03.html.bak.xhtml",
+	}
+	for name, want := range tests {
+		if got := xhtmlFilename(name); got != want {
+			t.Errorf("xhtmlFilename(%q) = %q, want %q", name, got, want)
+		}
+		// Normalizing is stable, so the file, manifest and TOC agree however often it runs
+		if again := xhtmlFilename(xhtmlFilename(name)); again != want {
+			t.Errorf("xhtmlFilename applied twice to %q = %q, want %q", name, again, want)
+		}
+	}
+}
+
+// TOC hrefs point at the same file the chapter is written to
+func TestXHTMLHref(t *testing.T) {
+	tests := map[string]string{
+		"ch01.htm#sec1":            "ch01.xhtml#sec1",
+		"ch01.xhtml#sec1":          "ch01.xhtml#sec1",
+		"ch01#sec1":                "ch01.xhtml#sec1",
+		"/api/v2/epubs/x/ch01.htm": "ch01.xhtml",
+		"#sec1":                    "#sec1",
+	}
+	for href, want := range tests {
+		if got := xhtmlHref(href); got != want {
+			t.Errorf("xhtmlHref(%q) = %q, want %q", href, got, want)
+		}
+	}
+}
+
+// ncxNavPoint is a navPoint of toc.ncx, as read back in tests
+type ncxNavPoint struct {
+	ID        string `xml:"id,attr"`
+	PlayOrder int    `xml:"playOrder,attr"`
+	Label     string `xml:"navLabel>text"`
+	Content   struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []ncxNavPoint `xml:"navPoint"`
+}
+
+// The NCX depth comes from the nesting, not the API's Depth field (unset here)
+func TestCreateTOCNestedDepth(t *testing.T) {
+	c := &Client{
+		bookInfo: &models.BookInfo{Title: "Nested", ISBN: "9780000000001"},
+		toc: []models.TOCItem{
+			{ID: "p1", Href: "part01.html", Label: "Part I", Children: []models.TOCItem{
+				{ID: "c1", Href: "ch01.html", Label: "Chapter 1", Children: []models.TOCItem{
+					{Fragment: "s1", Href: "ch01.html#s1", Label: "Section 1.1"},
+				}},
+			}},
+			{ID: "c2", Href: "ch02.html", Label: "Chapter 2"},
+		},
+	}
+
+	ncx, err := c.createTOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Meta []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"head>meta"`
+		NavPoints []ncxNavPoint `xml:"navMap>navPoint"`
+	}
+	if err := xml.Unmarshal([]byte(ncx), &doc); err != nil {
+		t.Fatalf("toc.ncx is not valid XML: %v", err)
+	}
+
+	depth := ""
+	for _, meta := range doc.Meta {
+		if meta.Name == "dtb:depth" {
+			depth = meta.Content
+		}
+	}
+	if depth != "3" {
+		t.Errorf("dtb:depth = %q, want 3", depth)
+	}
+
+	if len(doc.NavPoints) != 2 {
+		t.Fatalf("got %d top-level navPoints, want 2", len(doc.NavPoints))
+	}
+	part := doc.NavPoints[0]
+	if part.Label != "Part I" || len(part.Children) != 1 {
+		t.Fatalf("Part I has %d children, want Chapter 1", len(part.Children))
+	}
+	chapter := part.Children[0]
+	if chapter.Label != "Chapter 1" || len(chapter.Children) != 1 {
+		t.Fatalf("Chapter 1 has %d children, want Section 1.1", len(chapter.Children))
+	}
+	section := chapter.Children[0]
+	if section.Label != "Section 1.1" || section.Content.Src != "ch01.xhtml#s1" || len(section.Children) != 0 {
+		t.Errorf("Section 1.1 = %+v", section)
+	}
+
+	// Play order follows reading order through the nesting
+	order := []int{part.PlayOrder, chapter.PlayOrder, section.PlayOrder, doc.NavPoints[1].PlayOrder}
+	for i, playOrder := range order {
+		if playOrder != i+1 {
+			t.Errorf("playOrder %v, want 1 to 4 in reading order", order)
+			break
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package oreilly
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+// External metadata providers used to fill gaps in O'Reilly's book info
+const (
+	ProviderOpenLibrary = "openlibrary"
+	ProviderGoogleBooks = "googlebooks"
+)
+
+var (
+	// MetadataProvider enables enrichment from openlibrary or googlebooks ("" = disabled)
+	MetadataProvider string
+
+	// GoogleBooksAPIKey is sent with Google Books queries when set (optional)
+	GoogleBooksAPIKey string
+)
+
+// External catalogues are queried without the O'Reilly session (redirects are followed)
+var metadataHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchEnrichment looks a book up by ISBN with the configured provider.
+// A book the provider doesn't know returns an empty Enrichment, not an error.
+func FetchEnrichment(isbn string) (*models.Enrichment, error) {
+	isbn = normalizeISBN(isbn)
+	if isbn == "" {
+		return nil, fmt.Errorf("no ISBN")
+	}
+
+	switch MetadataProvider {
+	case ProviderOpenLibrary:
+		return fetchOpenLibrary(isbn)
+	case ProviderGoogleBooks:
+		return fetchGoogleBooks(isbn)
+	}
+	return nil, fmt.Errorf("unknown metadata provider %q", MetadataProvider)
+}
+
+// normalizeISBN strips hyphens and spaces, returning "" if what's left isn't an ISBN-10/13
+func normalizeISBN(isbn string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(isbn) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	if n := b.Len(); n != 10 && n != 13 {
+		return ""
+	}
+	return b.String()
+}
+
+// getMetadataJSON fetches and decodes a provider response (false if the book is unknown)
+func getMetadataJSON(apiURL string, v interface{}) (bool, error) {
+	resp, err := metadataHTTPClient.Get(apiURL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("invalid response: %w", err)
+	}
+	return true, nil
+}
+
+// fetchOpenLibrary reads the edition record of an ISBN from Open Library
+func fetchOpenLibrary(isbn string) (*models.Enrichment, error) {
+	var edition struct {
+		Description json.RawMessage `json:"description"` // A string or {"type": ..., "value": ...}
+		Subjects    []string        `json:"subjects"`
+		Covers      []int           `json:"covers"`
+	}
+	found, err := getMetadataJSON(fmt.Sprintf("https://openlibrary.org/isbn/%s.json", isbn), &edition)
+	if err != nil || !found {
+		return &models.Enrichment{Source: ProviderOpenLibrary}, err
+	}
+
+	enrichment := &models.Enrichment{
+		Source:   ProviderOpenLibrary,
+		Subjects: edition.Subjects,
+	}
+	var text struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(edition.Description, &enrichment.Description) != nil &&
+		json.Unmarshal(edition.Description, &text) == nil {
+		enrichment.Description = text.Value
+	}
+	if len(edition.Covers) > 0 && edition.Covers[0] > 0 {
+		enrichment.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", edition.Covers[0])
+	}
+	return enrichment, nil
+}
+
+// fetchGoogleBooks reads the first volume matching an ISBN from Google Books
+func fetchGoogleBooks(isbn string) (*models.Enrichment, error) {
+	query := url.Values{"q": {"isbn:" + isbn}}
+	if GoogleBooksAPIKey != "" {
+		query.Set("key", GoogleBooksAPIKey)
+	}
+
+	var result struct {
+		Items []struct {
+			VolumeInfo struct {
+				Description string   `json:"description"`
+				Categories  []string `json:"categories"`
+				ImageLinks  struct {
+					Thumbnail string `json:"thumbnail"`
+				} `json:"imageLinks"`
+			} `json:"volumeInfo"`
+		} `json:"items"`
+	}
+	found, err := getMetadataJSON("https://www.googleapis.com/books/v1/volumes?"+query.Encode(), &result)
+	if err != nil || !found || len(result.Items) == 0 {
+		return &models.Enrichment{Source: ProviderGoogleBooks}, err
+	}
+
+	info := result.Items[0].VolumeInfo
+	return &models.Enrichment{
+		Source:      ProviderGoogleBooks,
+		Description: info.Description,
+		Subjects:    info.Categories,
+		CoverURL:    strings.Replace(info.ImageLinks.Thumbnail, "http://", "https://", 1),
+	}, nil
+}
+
+// ApplyEnrichment fills the book info's missing description, subjects and cover
+// from enrichment (O'Reilly's own values always win) and returns the fields filled
+func (c *Client) ApplyEnrichment(enrichment *models.Enrichment) []string {
+	if c.bookInfo == nil || enrichment == nil {
+		return nil
+	}
+
+	var filled []string
+	if strings.TrimSpace(c.bookInfo.Description) == "" && enrichment.Description != "" {
+		c.bookInfo.Description = enrichment.Description
+		filled = append(filled, "description")
+	}
+	if len(c.bookInfo.Subjects) == 0 && len(enrichment.Subjects) > 0 {
+		for _, subject := range enrichment.Subjects {
+			c.bookInfo.Subjects = append(c.bookInfo.Subjects, models.Subject{Name: subject})
+		}
+		filled = append(filled, "subjects")
+	}
+	if c.bookInfo.Cover == "" && enrichment.CoverURL != "" {
+		c.bookInfo.Cover = enrichment.CoverURL
+		c.externalCover = true
+		filled = append(filled, "cover")
+	}
+	return filled
+}
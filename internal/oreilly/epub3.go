@@ -0,0 +1,182 @@
+package oreilly
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"goreilly/internal/models"
+)
+
+var (
+	// EPUBVersion selects the generated package format: 2 (default) or 3
+	EPUBVersion = 2
+
+	// IncludePageBreaks keeps print page markers as EPUB3 pagebreaks and
+	// lists them in the nav document's page-list (requires EPUBVersion 3)
+	IncludePageBreaks bool
+)
+
+// pageMarker is a print page break found in a chapter
+type pageMarker struct {
+	ID    string
+	Label string
+}
+
+// Characters allowed in generated XML IDs
+var invalidIDChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// isEPUB3 reports whether EPUB3 output is enabled
+func isEPUB3() bool {
+	return EPUBVersion == 3
+}
+
+// processPageBreaks normalizes print page markers (epub:type="pagebreak",
+// role="doc-pagebreak" or data-page) into EPUB3 pagebreak spans and records
+// them. Empty markers are replaced by the span; a marker with content keeps
+// it and gets the span inserted before it.
+func (c *Client) processPageBreaks(content *goquery.Selection, filename string) {
+	if !IncludePageBreaks || !isEPUB3() {
+		return
+	}
+
+	var markers []pageMarker
+	content.Find("*").Each(func(i int, s *goquery.Selection) {
+		epubType, _ := s.Attr("epub:type")
+		role, _ := s.Attr("role")
+		dataPage, hasDataPage := s.Attr("data-page")
+
+		if !strings.Contains(epubType, "pagebreak") && role != "doc-pagebreak" && !hasDataPage {
+			return
+		}
+
+		text := strings.TrimSpace(s.Text())
+		empty := s.Children().Length() == 0 && text == ""
+
+		label := strings.TrimSpace(dataPage)
+		if label == "" {
+			label = strings.TrimSpace(s.AttrOr("title", s.AttrOr("aria-label", "")))
+		}
+		if label == "" && s.Children().Length() == 0 {
+			// A text-only marker such as <span epub:type="pagebreak">12</span>
+			label = text
+		}
+		if label == "" {
+			return
+		}
+
+		// The element's own id stays with its content unless it is replaced
+		id := s.AttrOr("id", "")
+		if id == "" || !empty {
+			id = fmt.Sprintf("page_%s_%d", invalidIDChars.ReplaceAllString(label, "_"), len(markers))
+		}
+
+		span := fmt.Sprintf(`<span epub:type="pagebreak" role="doc-pagebreak" id="%s" title="%s"></span>`,
+			html.EscapeString(id), html.EscapeString(label))
+		if empty {
+			s.ReplaceWithHtml(span)
+		} else {
+			s.BeforeHtml(span)
+			// The inserted span is the page break now
+			if strings.Contains(epubType, "pagebreak") {
+				s.RemoveAttr("epub:type")
+			}
+			if role == "doc-pagebreak" {
+				s.RemoveAttr("role")
+			}
+		}
+		markers = append(markers, pageMarker{ID: id, Label: label})
+	})
+
+	if len(markers) == 0 {
+		return
+	}
+
+	c.logf("[O'Reilly] Found %d page markers in %s", len(markers), filename)
+	c.mu.Lock()
+	if c.pageMarkers == nil {
+		c.pageMarkers = make(map[string][]pageMarker)
+	}
+	c.pageMarkers[filename] = markers
+	c.mu.Unlock()
+}
+
+// createNav generates the EPUB3 navigation document (toc, landmarks and optional page-list)
+func (c *Client) createNav(toc []models.TOCItem) string {
+	var pageList strings.Builder
+	if IncludePageBreaks {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, chapter := range c.chapters {
+			filename := xhtmlFilename(chapter.Filename)
+			for _, marker := range c.pageMarkers[filename] {
+				pageList.WriteString(fmt.Sprintf(`<li><a href="%s#%s">%s</a></li>`,
+					filename, html.EscapeString(marker.ID), html.EscapeString(marker.Label)))
+				pageList.WriteString("\n")
+			}
+		}
+	}
+
+	pageListNav := ""
+	if pageList.Len() > 0 {
+		pageListNav = fmt.Sprintf("<nav epub:type=\"page-list\" hidden=\"\">\n<ol>\n%s</ol>\n</nav>", pageList.String())
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<title>%s</title>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Table of Contents</h1>
+%s
+</nav>
+%s
+%s
+</body>
+</html>`,
+		html.EscapeString(c.bookInfo.Title),
+		navList(toc),
+		c.landmarksNav(),
+		pageListNav,
+	)
+}
+
+// landmarksNav renders the EPUB3 landmarks (cover, toc, bodymatter), the
+// successor of the EPUB2 guide
+func (c *Client) landmarksNav() string {
+	var landmarks strings.Builder
+	if coverRef := c.coverPageRef(); coverRef != "" {
+		landmarks.WriteString(fmt.Sprintf(`<li><a epub:type="cover" href="%s">Cover</a></li>`, coverRef) + "\n")
+	}
+	landmarks.WriteString(`<li><a epub:type="toc" href="nav.xhtml#toc">Table of Contents</a></li>` + "\n")
+	if len(c.chapters) > 0 {
+		landmarks.WriteString(fmt.Sprintf(`<li><a epub:type="bodymatter" href="%s">Start of Content</a></li>`,
+			xhtmlFilename(c.chapters[0].Filename)))
+		landmarks.WriteString("\n")
+	}
+
+	return fmt.Sprintf("<nav epub:type=\"landmarks\" hidden=\"\">\n<h1>Landmarks</h1>\n<ol>\n%s</ol>\n</nav>", landmarks.String())
+}
+
+// navList renders TOC items as a nested EPUB3 nav list
+func navList(items []models.TOCItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+
+	var result strings.Builder
+	result.WriteString("<ol>\n")
+	for _, item := range items {
+		href := xhtmlHref(item.Href)
+		result.WriteString(fmt.Sprintf(`<li><a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(item.Label)))
+		result.WriteString(navList(item.Children))
+		result.WriteString("</li>\n")
+	}
+	result.WriteString("</ol>")
+	return result.String()
+}
@@ -0,0 +1,179 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MaxExtraFileSize caps the size of a single supplementary file
+const MaxExtraFileSize = 500 * 1024 * 1024
+
+// Archive extensions treated as supplementary files (code/sample archives)
+var extrasExtensions = []string{".zip", ".tar.gz", ".tgz", ".tar", ".7z"}
+
+// Matches a GitHub repository root link, fetched as its default branch archive
+var githubRepoPattern = regexp.MustCompile(`^https?://github\.com/([A-Za-z0-9_.-]+)/([A-Za-z0-9_.-]+?)(?:\.git)?/?$`)
+
+// Supplementary files are public downloads, often on third-party hosts, so they
+// are fetched without the O'Reilly session cookies. The links come from book
+// content, so like user URLs they never reach internal addresses (redirects
+// included).
+var extrasHTTPClient = newPublicHTTPClient(10 * time.Minute)
+
+// extraLink returns the download URL of a supplementary-file link, or "" if it isn't one
+func extraLink(href string) string {
+	href = strings.TrimSpace(href)
+	if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		return ""
+	}
+
+	if m := githubRepoPattern.FindStringSubmatch(href); m != nil {
+		return fmt.Sprintf("https://github.com/%s/%s/archive/HEAD.zip", m[1], m[2])
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	p := strings.ToLower(u.Path)
+	for _, ext := range extrasExtensions {
+		if strings.HasSuffix(p, ext) {
+			return href
+		}
+	}
+	return ""
+}
+
+// collectExtras records supplementary-file links found in content
+func (c *Client) collectExtras(content *goquery.Selection) {
+	content.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		link := extraLink(a.AttrOr("href", ""))
+		if link == "" {
+			return
+		}
+
+		c.mu.Lock()
+		if !contains(c.extras, link) {
+			c.extras = append(c.extras, link)
+			c.logf("[Extras] Found supplementary file: %s", link)
+		}
+		c.mu.Unlock()
+	})
+}
+
+// ExtraLinks returns the supplementary-file links found in the book info and chapters
+func (c *Client) ExtraLinks() []string {
+	if c.bookInfo != nil && c.bookInfo.Description != "" {
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(c.bookInfo.Description)); err == nil {
+			c.collectExtras(doc.Selection)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.extras...)
+}
+
+// DownloadExtras downloads every supplementary file into a single zip bundle at
+// destPath and returns how many were bundled. Failed files are skipped; once
+// ctx is done (e.g. the job timed out) the bundle is abandoned.
+func (c *Client) DownloadExtras(ctx context.Context, destPath string) (int, error) {
+	links := c.ExtraLinks()
+	if len(links) == 0 {
+		return 0, nil
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create extras bundle: %w", err)
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+	used := make(map[string]bool)
+	bundled := 0
+
+	for i, link := range links {
+		name := extraFilename(link, i, used)
+		c.logf("[Extras] Downloading %s as %s", link, name)
+		if err := c.addExtra(ctx, zipWriter, link, name); err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			c.logf("[Extras] WARNING: Skipping %s: %v", link, err)
+			continue
+		}
+		bundled++
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finalize extras bundle: %w", err)
+	}
+	return bundled, nil
+}
+
+// addExtra streams one supplementary file into the bundle
+func (c *Client) addExtra(ctx context.Context, zipWriter *zip.Writer, link, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := extrasHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > MaxExtraFileSize {
+		return fmt.Errorf("file too large (%d bytes)", resp.ContentLength)
+	}
+
+	// Archives are already compressed, store them as-is
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(w, io.LimitReader(resp.Body, MaxExtraFileSize+1))
+	if err != nil {
+		return err
+	}
+	if written > MaxExtraFileSize {
+		return fmt.Errorf("file exceeds %d bytes", int64(MaxExtraFileSize))
+	}
+	return nil
+}
+
+// extraFilename picks a unique bundle entry name for a link
+func extraFilename(link string, index int, used map[string]bool) string {
+	name := ""
+	if m := githubRepoPattern.FindStringSubmatch(strings.TrimSuffix(link, "/archive/HEAD.zip")); m != nil {
+		name = m[2] + ".zip"
+	} else if u, err := url.Parse(link); err == nil {
+		name = path.Base(u.Path)
+	}
+	name = invalidIDChars.ReplaceAllString(name, "_")
+	if name == "" || name == "." || name == "_" {
+		name = fmt.Sprintf("extra%02d", index)
+	}
+
+	if used[name] {
+		name = fmt.Sprintf("%02d_%s", index, name)
+	}
+	used[name] = true
+	return name
+}
@@ -0,0 +1,27 @@
+package oreilly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+// Fingerprint identifies the version of a book's content. It changes when
+// O'Reilly updates the book under the same ID (new edition or ISBN, issue
+// date, last-modified time or chapter count). Empty if the info is unknown.
+func Fingerprint(info *models.BookInfo) string {
+	if info == nil {
+		return ""
+	}
+	version := strings.Join([]string{
+		info.ISBN,
+		info.Issued,
+		info.LastModified,
+		strconv.Itoa(info.ChapterCount),
+	}, "|")
+	sum := sha256.Sum256([]byte(version))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,102 @@
+package oreilly
+
+import (
+	"path"
+	"strings"
+	"unicode"
+
+	"goreilly/internal/models"
+)
+
+// SetCoverPage makes the chapter with this filename or title the front cover,
+// overriding the automatic choice. Its image becomes the cover image unless a
+// cover URL is also set.
+func (c *Client) SetCoverPage(page string) {
+	c.coverPage = strings.TrimSpace(page)
+}
+
+// isBackCoverChapter reports whether a cover-like page is a back cover: its
+// filename or title has the word "back" (or "backcover"), so "Feedback" or
+// "backend.xhtml" don't count
+func isBackCoverChapter(chapter models.Chapter) bool {
+	name := strings.TrimSuffix(path.Base(chapter.Filename), path.Ext(chapter.Filename))
+	for _, word := range append(coverWords(name), coverWords(chapter.Title)...) {
+		if word == "back" || word == "backcover" {
+			return true
+		}
+	}
+	return false
+}
+
+// coverWords splits a filename or title into lowercase words
+func coverWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// isImagePage reports whether the API lists a single image for a page, as it
+// does for artwork and scanned cover pages (the text isn't known yet)
+func isImagePage(chapter models.Chapter) bool {
+	return len(chapter.Images) == 1
+}
+
+// matchesCoverPage reports whether a chapter is the requested cover page
+func matchesCoverPage(chapter models.Chapter, page string) bool {
+	return strings.EqualFold(chapter.Filename, page) ||
+		strings.EqualFold(path.Base(chapter.Filename), page) ||
+		strings.EqualFold(xhtmlFilename(chapter.Filename), page) ||
+		strings.EqualFold(strings.TrimSpace(chapter.Title), page)
+}
+
+// frontCoverIndex returns the index of the front cover among chapters (-1 if
+// there is none): the requested cover page, otherwise the cover page titled
+// "Cover" or "Front Cover", otherwise the earliest cover page that isn't a back cover
+func (c *Client) frontCoverIndex(chapters []models.Chapter) int {
+	if c.coverPage != "" {
+		found := false
+		for i, chapter := range chapters {
+			if !matchesCoverPage(chapter, c.coverPage) {
+				continue
+			}
+			// A text chapter at the front (and its image as cover) would break the book
+			if isCoverChapter(chapter) || isImagePage(chapter) {
+				return i
+			}
+			found = true
+		}
+		if found {
+			c.warnf("Cover page %q is neither a cover nor an image page, choosing the front cover automatically", c.coverPage)
+		} else {
+			c.warnf("Cover page %q not found, choosing the front cover automatically", c.coverPage)
+		}
+		c.coverPage = ""
+	}
+
+	first := -1
+	for i, chapter := range chapters {
+		if !isCoverChapter(chapter) || isBackCoverChapter(chapter) {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(chapter.Title)) {
+		case "cover", "front cover":
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	return first
+}
+
+// coverPageRef returns the page the guide and landmarks point at as the cover:
+// cover.xhtml when it was created, otherwise the front cover chapter ("" if none)
+func (c *Client) coverPageRef() string {
+	if c.coverXHTML {
+		return "cover.xhtml"
+	}
+	if c.frontCover != "" && !c.skipped[c.frontCover] {
+		return c.frontCover
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package oreilly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"goreilly/internal/models"
+)
+
+func TestIsBackCoverChapter(t *testing.T) {
+	tests := []struct {
+		chapter models.Chapter
+		want    bool
+	}{
+		{models.Chapter{Filename: "backcover.xhtml", Title: "Cover"}, true},
+		{models.Chapter{Filename: "cover02.xhtml", Title: "Back Cover"}, true},
+		{models.Chapter{Filename: "back-cover.html", Title: ""}, true},
+		{models.Chapter{Filename: "cover.xhtml", Title: "Feedback Loops on the Cover"}, false},
+		{models.Chapter{Filename: "backend-cover.xhtml", Title: "Cover"}, false},
+		{models.Chapter{Filename: "cover.xhtml", Title: "Cover"}, false},
+	}
+	for _, tt := range tests {
+		if got := isBackCoverChapter(tt.chapter); got != tt.want {
+			t.Errorf("isBackCoverChapter(%q, %q) = %v, want %v", tt.chapter.Filename, tt.chapter.Title, got, tt.want)
+		}
+	}
+}
+
+func TestFrontCoverIndexCoverPage(t *testing.T) {
+	chapters := []models.Chapter{
+		{Filename: "titlepage.xhtml", Title: "Title Page"},
+		{Filename: "cover.xhtml", Title: "Cover"},
+		{Filename: "art.xhtml", Title: "Artwork", Images: []string{"art.jpg"}},
+		{Filename: "ch01.xhtml", Title: "Introduction", Images: []string{"fig1.png", "fig2.png"}},
+	}
+	tests := []struct {
+		coverPage string
+		want      int
+	}{
+		{"art.xhtml", 2},     // Image-only page
+		{"Cover", 1},         // Cover page by title
+		{"ch01.xhtml", 1},    // Text chapter: rejected, automatic choice
+		{"missing.xhtml", 1}, // Not found: automatic choice
+	}
+	for _, tt := range tests {
+		c := &Client{logger: func(string, ...interface{}) {}}
+		c.SetCoverPage(tt.coverPage)
+		if got := c.frontCoverIndex(chapters); got != tt.want {
+			t.Errorf("cover page %q: front cover %d, want %d", tt.coverPage, got, tt.want)
+		}
+	}
+}
+
+// chapterPages serves the chapter list API from fixed pages (?page=N)
+type chapterPages []chapterPage
+
+func (pages chapterPages) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	page, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil || page < 1 || page > len(pages) {
+		rec.WriteHeader(http.StatusNotFound)
+		return rec.Result(), nil
+	}
+	json.NewEncoder(rec).Encode(pages[page-1])
+	return rec.Result(), nil
+}
+
+// A cover listed on a later page of the chapter list still comes first
+func TestGetChaptersCoverOnLaterPage(t *testing.T) {
+	next := "next"
+	pages := chapterPages{
+		{Count: 6, Next: &next, Results: []models.Chapter{
+			{Filename: "preface.html", Title: "Preface"},
+			{Filename: "ch01.html", Title: "Chapter 1"},
+			{Filename: "ch02.html", Title: "Chapter 2"},
+		}},
+		{Count: 6, Results: []models.Chapter{
+			{Filename: "ch03.html", Title: "Chapter 3"},
+			{Filename: "cover.html", Title: "Cover"},
+			{Filename: "backcover.html", Title: "Back Cover"},
+		}},
+	}
+
+	defer func(previous int) { ChapterPageConcurrency = previous }(ChapterPageConcurrency)
+	for _, concurrency := range []int{1, 4} {
+		ChapterPageConcurrency = concurrency
+
+		c := &Client{httpClient: &http.Client{Transport: pages}, logger: func(string, ...interface{}) {}}
+		if err := c.GetChapters(); err != nil {
+			t.Fatal(err)
+		}
+
+		var order []string
+		for _, chapter := range c.chapters {
+			order = append(order, chapter.Filename)
+		}
+		want := "cover.html preface.html ch01.html ch02.html ch03.html backcover.html"
+		if got := strings.Join(order, " "); got != want {
+			t.Errorf("concurrency %d: chapter order %q, want %q", concurrency, got, want)
+		}
+		if c.frontCover != "cover.xhtml" {
+			t.Errorf("concurrency %d: front cover %q, want cover.xhtml", concurrency, c.frontCover)
+		}
+	}
+}
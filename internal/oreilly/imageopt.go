@@ -0,0 +1,177 @@
+package oreilly
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OptimizeImages runs downloaded images through a lossless pass: PNGs are
+// re-encoded with the best compression and JPEGs lose their EXIF, XMP, IPTC
+// and comment segments. Pixels and resolution are never changed.
+var OptimizeImages = false
+
+// optimizeImage shrinks the image at path in place and returns the bytes
+// saved. The file is only replaced when the result is smaller.
+func (c *Client) optimizeImage(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	var optimized []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		optimized, err = recompressPNG(data)
+	case ".jpg", ".jpeg":
+		optimized, err = stripJPEGMetadata(data)
+	default:
+		return 0
+	}
+	if err != nil {
+		c.logf("[O'Reilly] WARNING: Could not optimize %s: %v", filepath.Base(path), err)
+		return 0
+	}
+	if len(optimized) >= len(data) {
+		return 0
+	}
+
+	if err := os.WriteFile(path, optimized, 0644); err != nil {
+		c.logf("[O'Reilly] WARNING: Could not write optimized %s: %v", filepath.Base(path), err)
+		return 0
+	}
+
+	saved := int64(len(data) - len(optimized))
+	c.mu.Lock()
+	c.imageBytesSaved += saved
+	c.mu.Unlock()
+	return saved
+}
+
+// logImageSavings reports what OptimizeImages saved over the whole book
+func (c *Client) logImageSavings() {
+	if !OptimizeImages {
+		return
+	}
+	c.mu.Lock()
+	saved := c.imageBytesSaved
+	c.mu.Unlock()
+	c.logf("[O'Reilly] Image optimization saved %.1f KB", float64(saved)/1024)
+}
+
+// recompressPNG decodes a PNG and encodes it again with the best compression
+// (ancillary chunks such as text and timestamps are dropped)
+func recompressPNG(data []byte) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var errNotJPEG = errors.New("not a valid JPEG")
+
+// JPEG markers
+const (
+	jpegSOI  = 0xD8
+	jpegEOI  = 0xD9
+	jpegSOS  = 0xDA
+	jpegAPP1 = 0xE1
+	jpegAPP2 = 0xE2
+	jpegAPPD = 0xED
+	jpegCOM  = 0xFE
+)
+
+// stripJPEGMetadata removes the metadata segments of a JPEG without touching
+// the compressed image data. JFIF, ICC profiles (APP2) and Adobe color
+// information (APP14) are kept since they affect rendering, and so is an EXIF
+// segment that rotates the image.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return nil, errNotJPEG
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, errNotJPEG
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == jpegSOS || marker == jpegEOI {
+			// Compressed data follows, copy the rest as is
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errNotJPEG
+		}
+		segment := data[pos:end]
+		pos = end
+
+		switch {
+		case marker == jpegAPP1 && !exifRotates(segment[4:]):
+		case marker == jpegAPPD, marker == jpegCOM:
+		case marker > jpegAPP2 && marker < jpegAPPD:
+		default:
+			out = append(out, segment...)
+		}
+	}
+	return append(out, data[pos:]...), nil
+}
+
+// exifRotates reports whether an APP1 payload is EXIF with an orientation
+// other than "normal" (stripping it would turn the image)
+func exifRotates(payload []byte) bool {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return false
+	}
+	tiff := payload[6:]
+	if len(tiff) < 8 {
+		return false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return false
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return false
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return order.Uint16(tiff[entry+8:]) != 1
+		}
+	}
+	return false
+}
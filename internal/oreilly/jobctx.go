@@ -0,0 +1,66 @@
+package oreilly
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+)
+
+// contextTransport attaches a job's context to every request, so that
+// cancelling the job aborts requests in flight
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// SetContext makes the client's requests fail once ctx is done (e.g. when the
+// job times out). The pooled session itself is left untouched.
+func (c *Client) SetContext(ctx context.Context) {
+	httpClient := *c.httpClient
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = &contextTransport{ctx: ctx, base: base}
+	c.httpClient = &httpClient
+	c.ctx = ctx
+}
+
+// context returns the client's context (Background without SetContext)
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// wait sleeps for d, returning early with the context's error once it is done
+func (c *Client) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.context().Done():
+		return c.context().Err()
+	}
+}
+
+// SetJobID names the download the client works for; its build directory then
+// belongs to that job alone, even when another job builds the same book
+func (c *Client) SetJobID(id string) {
+	c.jobID = id
+}
+
+// RemoveFiles deletes the book's working directory, e.g. after a failed download
+func (c *Client) RemoveFiles() error {
+	if c.bookPath == "" {
+		return nil
+	}
+	return os.RemoveAll(c.bookPath)
+}
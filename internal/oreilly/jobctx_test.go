@@ -0,0 +1,118 @@
+package oreilly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"goreilly/internal/models"
+)
+
+// Two jobs building the same book at once must not see each other's files
+func TestConcurrentJobsSameBook(t *testing.T) {
+	BooksDir = t.TempDir()
+
+	jobs := []string{"11111111-aaaa", "22222222-bbbb"}
+	clients := make([]*Client, len(jobs))
+	for i, job := range jobs {
+		clients[i] = &Client{bookID: "9781492052197", bookInfo: &models.BookInfo{Title: "Same Book"}}
+		clients[i].SetJobID(job)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			if errs[i] = c.createDirectories(); errs[i] != nil {
+				return
+			}
+			errs[i] = os.WriteFile(filepath.Join(c.bookPath, "OEBPS", "ch01.xhtml"), []byte(jobs[i]), 0644)
+		}(i, c)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("job %s: %v", jobs[i], err)
+		}
+	}
+
+	if clients[0].bookPath == clients[1].bookPath {
+		t.Fatalf("both jobs build in %s", clients[0].bookPath)
+	}
+
+	// The first job finishing (and cleaning up) leaves the second one intact
+	if err := clients[0].RemoveFiles(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(clients[1].bookPath, "OEBPS", "ch01.xhtml"))
+	if err != nil {
+		t.Fatalf("second job lost its chapter: %v", err)
+	}
+	if string(data) != jobs[1] {
+		t.Errorf("second job's chapter = %q, want %q", data, jobs[1])
+	}
+}
+
+// unavailable answers every request with 503, a transient login check failure
+type unavailable struct{}
+
+func (unavailable) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(http.StatusServiceUnavailable)
+	return rec.Result(), nil
+}
+
+// Cancelling the client's context ends the waits between login retries
+func TestCheckLoginCancelled(t *testing.T) {
+	defer func(retries int) { LoginCheckRetries = retries }(LoginCheckRetries)
+	LoginCheckRetries = 10
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c := &Client{httpClient: &http.Client{Transport: unavailable{}}, ctx: ctx, logger: func(string, ...interface{}) {}}
+
+	started := time.Now()
+	if err := c.checkLogin(); err == nil {
+		t.Fatal("checkLogin succeeded against an unavailable server")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("checkLogin kept retrying for %v after its context ended", elapsed)
+	}
+}
+
+// Once the job's context ends, the extras bundle stops instead of fetching the
+// remaining files
+func TestDownloadExtrasCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &Client{
+		extras: []string{"https://example.com/code.zip", "https://example.com/data.tar.gz"},
+		logger: func(string, ...interface{}) {},
+	}
+
+	count, err := c.DownloadExtras(ctx, filepath.Join(t.TempDir(), "extras.zip"))
+	if err != context.Canceled {
+		t.Fatalf("DownloadExtras = %d, %v; want context.Canceled", count, err)
+	}
+}
+
+// Extras links come from book content and must not reach internal addresses
+func TestDownloadExtrasInternalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	c := &Client{extras: []string{server.URL + "/code.zip"}, logger: func(string, ...interface{}) {}}
+	count, err := c.DownloadExtras(context.Background(), filepath.Join(t.TempDir(), "extras.zip"))
+	if err != nil || count != 0 {
+		t.Fatalf("DownloadExtras = %d, %v; want the loopback link skipped", count, err)
+	}
+}
@@ -0,0 +1,56 @@
+package oreilly
+
+import (
+	"html"
+	"strings"
+	"time"
+)
+
+// NormalizeMetadata cleans up book info fields O'Reilly sometimes returns in
+// unusable shape before they are written to the OPF (rights with HTML entities,
+// issued dates in assorted formats)
+var NormalizeMetadata = true
+
+// issuedLayouts are the date formats seen in the book info's issued field,
+// each paired with the ISO 8601 precision it is rewritten to
+var issuedLayouts = []struct {
+	layout string
+	output string
+}{
+	{time.RFC3339Nano, "2006-01-02"},
+	{"2006-01-02T15:04:05", "2006-01-02"},
+	{"2006-01-02 15:04:05", "2006-01-02"},
+	{"2006-01-02", "2006-01-02"},
+	{"2006/01/02", "2006-01-02"},
+	{"20060102", "2006-01-02"},
+	{"January 2, 2006", "2006-01-02"},
+	{"Jan 2, 2006", "2006-01-02"},
+	{"2 January 2006", "2006-01-02"},
+	{"January 2006", "2006-01"},
+	{"Jan 2006", "2006-01"},
+	{"2006-01", "2006-01"},
+	{"2006", "2006"},
+}
+
+// normalizeRights decodes HTML entities (e.g. &copy;) and collapses whitespace
+func normalizeRights(rights string) string {
+	if !NormalizeMetadata {
+		return rights
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(rights)), " ")
+}
+
+// normalizeIssued rewrites the issued date as an ISO 8601 date for dc:date,
+// passing it through unchanged if the format is unknown
+func normalizeIssued(issued string) string {
+	trimmed := strings.TrimSpace(issued)
+	if !NormalizeMetadata || trimmed == "" {
+		return issued
+	}
+	for _, l := range issuedLayouts {
+		if t, err := time.Parse(l.layout, trimmed); err == nil {
+			return t.Format(l.output)
+		}
+	}
+	return issued
+}
@@ -0,0 +1,168 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// PackageConcurrency is how many files are read and compressed at once while
+// the EPUB is packaged (1 = one after another). The zip itself is still
+// written by a single goroutine in a fixed order.
+var PackageConcurrency = 4
+
+// packStreamThreshold is the size above which a file is not compressed by a
+// worker but streamed into the zip by the writer, so workers never hold more
+// than PackageConcurrency files of at most this size (raw and compressed)
+const packStreamThreshold = 8 << 20
+
+// zipVersion20 is the zip version (2.0) needed for deflate, the one
+// zip.Writer.CreateHeader records
+const zipVersion20 = 20
+
+// zipFlagUTF8 marks a zip entry name as UTF-8
+const zipFlagUTF8 = 0x800
+
+// packedEntry is a file read and compressed, ready to be copied into the zip.
+// A file over packStreamThreshold is only stat'ed: stream is set and the
+// writer compresses it itself (see writeEntry).
+type packedEntry struct {
+	header *zip.FileHeader
+	data   []byte
+	stream bool
+	err    error
+}
+
+// packFile reads the file at path and compresses it at level, filling in the
+// header fields zip.Writer.CreateRaw needs
+func packFile(path, name string, level int) packedEntry {
+	info, err := os.Stat(path)
+	if err != nil {
+		return packedEntry{err: err}
+	}
+	if info.Size() > packStreamThreshold {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, UncompressedSize64: uint64(info.Size())}
+		if level == flate.NoCompression {
+			header.Method = zip.Store
+		}
+		return packedEntry{header: header, stream: true}
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return packedEntry{err: err}
+	}
+
+	// CreateRaw writes the header as given, so set what CreateHeader would
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(raw),
+		UncompressedSize64: uint64(len(raw)),
+		CreatorVersion:     zipVersion20,
+		ReaderVersion:      zipVersion20,
+	}
+	if !isASCII(name) {
+		header.Flags |= zipFlagUTF8
+	}
+	data := raw
+	if level != flate.NoCompression {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, level)
+		if err != nil {
+			return packedEntry{err: err}
+		}
+		if _, err := fw.Write(raw); err != nil {
+			return packedEntry{err: err}
+		}
+		if err := fw.Close(); err != nil {
+			return packedEntry{err: err}
+		}
+		header.Method = zip.Deflate
+		data = buf.Bytes()
+	}
+	header.CompressedSize64 = uint64(len(data))
+	return packedEntry{header: header, data: data}
+}
+
+// writeEntry adds a packed file to the zip: compressed data is copied as is,
+// a streamed file is read and compressed by w (at the level registered for
+// zip.Deflate) in one pass
+func writeEntry(w *zip.Writer, path string, entry packedEntry) error {
+	if !entry.stream {
+		zipFile, err := w.CreateRaw(entry.header)
+		if err != nil {
+			return err
+		}
+		_, err = zipFile.Write(entry.data)
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zipFile, err := w.CreateHeader(&zip.FileHeader{Name: entry.header.Name, Method: entry.header.Method})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zipFile, file)
+	return err
+}
+
+// isASCII reports whether s has only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// packFiles reads and compresses files with up to PackageConcurrency workers
+// and hands them to write in the order given. At most PackageConcurrency
+// entries (each of at most packStreamThreshold bytes) are held in memory. After write fails the remaining entries are
+// still drained (so no worker is left blocked) but not written.
+func packFiles(paths, names []string, level int, write func(path string, entry packedEntry) error) error {
+	workers := PackageConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	queue := make(chan chan packedEntry, workers)
+	go func() {
+		defer close(queue)
+		for i := range paths {
+			sem <- struct{}{}
+			result := make(chan packedEntry, 1)
+			queue <- result
+			go func(i int) {
+				result <- packFile(paths[i], names[i], level)
+			}(i)
+		}
+	}()
+
+	var firstErr error
+	i := 0
+	for result := range queue {
+		entry := <-result
+		if firstErr == nil {
+			if entry.err != nil {
+				firstErr = entry.err
+			} else {
+				firstErr = write(paths[i], entry)
+			}
+		}
+		<-sem
+		i++
+	}
+	return firstErr
+}
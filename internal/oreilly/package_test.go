@@ -0,0 +1,103 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestBook fills dir with chapters, one image and a file over
+// packStreamThreshold, returning the contents by archive name
+func writeTestBook(tb testing.TB, dir string, chapters int) map[string][]byte {
+	tb.Helper()
+	files := make(map[string][]byte)
+	for i := 1; i <= chapters; i++ {
+		files[fmt.Sprintf("OEBPS/ch%03d.xhtml", i)] = bytes.Repeat([]byte(fmt.Sprintf("<p>Chapter %d paragraph.</p>\n", i)), 2000)
+	}
+	files["OEBPS/Images/diagramme_été.png"] = bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 4096)
+	video := make([]byte, packStreamThreshold+1024)
+	rand.New(rand.NewSource(1)).Read(video)
+	files["OEBPS/Audio/track01.mp3"] = video
+
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestCreateZIPEntries(t *testing.T) {
+	bookDir := t.TempDir()
+	files := writeTestBook(t, bookDir, 20)
+	epubPath := filepath.Join(t.TempDir(), "book.epub")
+
+	c := &Client{bookPath: bookDir}
+	if err := c.createZIP(epubPath); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if len(r.File) != len(files)+1 || r.File[0].Name != "mimetype" {
+		t.Fatalf("got %d entries starting with %q, want mimetype and %d files", len(r.File), r.File[0].Name, len(files))
+	}
+	for _, f := range r.File[1:] {
+		want, ok := files[filepath.ToSlash(f.Name)]
+		if !ok {
+			t.Errorf("unexpected entry %s", f.Name)
+			continue
+		}
+		if f.ReaderVersion != zipVersion20 || f.CreatorVersion&0xff != zipVersion20 {
+			t.Errorf("%s: reader version %d, creator version %d", f.Name, f.ReaderVersion, f.CreatorVersion)
+		}
+		if utf8Flag := f.Flags&zipFlagUTF8 != 0; utf8Flag != !isASCII(f.Name) {
+			t.Errorf("%s: UTF-8 flag %v", f.Name, utf8Flag)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs (%d bytes, want %d): %v", f.Name, len(got), len(want), err)
+		}
+	}
+}
+
+func BenchmarkCreateZIP(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			defer func(previous int) { PackageConcurrency = previous }(PackageConcurrency)
+			PackageConcurrency = workers
+
+			for i := 0; i < b.N; i++ {
+				// createZIP removes the sources, so every run packages a fresh copy
+				b.StopTimer()
+				bookDir := b.TempDir()
+				writeTestBook(b, bookDir, 200)
+				epubPath := filepath.Join(b.TempDir(), "book.epub")
+				c := &Client{bookPath: bookDir, logger: func(string, ...interface{}) {}}
+				b.StartTimer()
+
+				if err := c.createZIP(epubPath); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package oreilly
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PaywallMarkers are snippets (matched case-insensitively) of the teaser page
+// O'Reilly serves instead of a chapter the subscription doesn't cover
+var PaywallMarkers = []string{
+	"subscribe to read",
+	"start your free trial",
+	"sign up for a free trial",
+	"get full access to",
+}
+
+// ErrPaywalled is returned (wrapped) when chapter pages are teasers instead of content
+var ErrPaywalled = errors.New("your subscription doesn't include this title")
+
+// paywallTeaserWords is the most words a teaser page has; a longer chapter
+// only counts as paywalled when it shows several markers (a real chapter may
+// well quote one, e.g. a book about subscription sites)
+const paywallTeaserWords = 300
+
+// paywallMarker returns the first paywall marker in the visible text of a
+// chapter's content ("" if it isn't a teaser). Markup, scripts and attributes
+// are not matched: page chrome often mentions trials without being a teaser.
+func paywallMarker(content *goquery.Selection) string {
+	words := strings.Fields(readableText(content))
+	text := strings.ToLower(strings.Join(words, " "))
+
+	var found []string
+	for _, marker := range PaywallMarkers {
+		marker = strings.ToLower(strings.Join(strings.Fields(marker), " "))
+		if marker != "" && strings.Contains(text, marker) {
+			found = append(found, marker)
+		}
+	}
+	if len(found) == 0 || (len(found) < 2 && len(words) > paywallTeaserWords) {
+		return ""
+	}
+	return found[0]
+}
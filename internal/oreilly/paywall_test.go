@@ -0,0 +1,58 @@
+package oreilly
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestPaywallMarker(t *testing.T) {
+	longChapter := strings.Repeat("<p>Caching keeps the hot path fast and the database calm.</p>\n", 80)
+
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "teaser page",
+			page: `<div id="sbo-rt-content"><h1>Chapter 1</h1><p>Subscribe to read the rest of this chapter.</p></div>`,
+			want: "subscribe to read",
+		},
+		{
+			name: "marker only in page chrome",
+			page: `<nav><a href="/trial">Start your free trial</a></nav><div id="sbo-rt-content"><p>Real chapter text.</p></div>`,
+		},
+		{
+			name: "marker only in markup",
+			page: `<div id="sbo-rt-content"><p data-cta="get full access to">Real chapter text.</p><script>banner("subscribe to read")</script></div>`,
+		},
+		{
+			name: "full chapter quoting one marker",
+			page: `<div id="sbo-rt-content">` + longChapter + `<p>The landing page says "Start your free trial" in bold.</p></div>`,
+		},
+		{
+			name: "full-length page with several markers",
+			page: `<div id="sbo-rt-content">` + longChapter + `<p>Start your free trial</p><p>Get full access to this book</p></div>`,
+			want: "start your free trial",
+		},
+		{
+			name: "marker split across elements and lines",
+			page: `<div id="sbo-rt-content"><p><b>Subscribe</b> to
+read</p></div>`,
+			want: "subscribe to read",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paywallMarker(doc.Find(DefaultContentSelector)); got != tt.want {
+				t.Errorf("paywallMarker() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
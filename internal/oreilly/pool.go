@@ -0,0 +1,92 @@
+package oreilly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionRevalidateInterval is how long a pooled session is trusted before
+// checkLogin runs again (0 disables pooling)
+var SessionRevalidateInterval = 10 * time.Minute
+
+// session is an authenticated HTTP client shared by every Client using the same cookies
+type session struct {
+	httpClient  *http.Client
+	validatedAt time.Time
+}
+
+var (
+	sessionPool     = make(map[string]*session)
+	sessionPoolLock sync.Mutex
+)
+
+// cookieFingerprint identifies a cookie set without exposing its values
+func cookieFingerprint(cookies []*http.Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	sort.Strings(pairs)
+
+	h := sha256.New()
+	for _, pair := range pairs {
+		h.Write([]byte(pair))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// getPooledSession returns a recently validated session for the fingerprint, if any
+func getPooledSession(fingerprint string) *http.Client {
+	if SessionRevalidateInterval <= 0 {
+		return nil
+	}
+
+	sessionPoolLock.Lock()
+	defer sessionPoolLock.Unlock()
+
+	s, exists := sessionPool[fingerprint]
+	if !exists || time.Since(s.validatedAt) > SessionRevalidateInterval {
+		return nil
+	}
+	return s.httpClient
+}
+
+// putPooledSession stores a freshly validated session
+func putPooledSession(fingerprint string, httpClient *http.Client) {
+	if SessionRevalidateInterval <= 0 {
+		return
+	}
+
+	sessionPoolLock.Lock()
+	defer sessionPoolLock.Unlock()
+
+	sessionPool[fingerprint] = &session{
+		httpClient:  httpClient,
+		validatedAt: time.Now(),
+	}
+}
+
+// invalidateSession drops a pooled session so the next client re-authenticates
+func invalidateSession(fingerprint string) {
+	sessionPoolLock.Lock()
+	defer sessionPoolLock.Unlock()
+
+	delete(sessionPool, fingerprint)
+}
+
+// checkAuthStatus invalidates the pooled session when O'Reilly rejects the cookies
+func (c *Client) checkAuthStatus(statusCode int) {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		c.logf("[O'Reilly] Got status %d, invalidating pooled session", statusCode)
+		invalidateSession(c.fingerprint)
+		if c.account != "" {
+			markAccountFailed(c.account, fmt.Errorf("O'Reilly returned status %d", statusCode))
+		}
+	}
+}
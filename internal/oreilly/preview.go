@@ -0,0 +1,90 @@
+package oreilly
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+// previewPage is the front page that marks a preview build
+const previewPage = "preview.xhtml"
+
+// SetPreviewChapters limits the book to its first n chapters (cover pages are
+// always kept) and adds a front page saying it is a preview (0 = full book)
+func (c *Client) SetPreviewChapters(n int) {
+	c.previewChapters = n
+}
+
+// IsPreview reports whether chapters were left out because of the preview limit
+func (c *Client) IsPreview() bool {
+	return c.previewTotal > 0
+}
+
+// isCoverChapter reports whether a chapter is a cover page
+func isCoverChapter(chapter models.Chapter) bool {
+	return strings.Contains(strings.ToLower(chapter.Filename), "cover") ||
+		strings.Contains(strings.ToLower(chapter.Title), "cover")
+}
+
+// limitToPreview keeps the cover pages and the first previewChapters chapters.
+// The others are marked as skipped so the TOC only lists included chapters.
+func (c *Client) limitToPreview() {
+	if c.previewChapters <= 0 {
+		return
+	}
+
+	kept := make([]models.Chapter, 0, len(c.chapters))
+	var dropped []string
+	included := 0
+	for _, chapter := range c.chapters {
+		if isCoverChapter(chapter) || included < c.previewChapters {
+			if !isCoverChapter(chapter) {
+				included++
+			}
+			kept = append(kept, chapter)
+			continue
+		}
+		dropped = append(dropped, xhtmlFilename(chapter.Filename))
+	}
+	if len(dropped) == 0 {
+		c.logf("[O'Reilly] Preview limit of %d chapters covers the whole book", c.previewChapters)
+		return
+	}
+
+	if c.skipped == nil {
+		c.skipped = make(map[string]bool, len(dropped))
+	}
+	for _, file := range dropped {
+		c.skipped[file] = true
+	}
+	c.previewTotal = included + len(dropped)
+	c.chapters = kept
+	c.logf("[O'Reilly] Preview: keeping %d of %d chapters", included, c.previewTotal)
+}
+
+// writePreviewPage creates the front page noting that the book is a preview
+func (c *Client) writePreviewPage() error {
+	page := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<title>Preview</title>
+<style type="text/css">
+div.preview { margin: 3em 1em; padding: 1em; border: 2px solid #c00; text-align: center; }
+</style>
+</head>
+<body>
+<div class="preview">
+<h1>Preview</h1>
+<p>This is a preview of <em>%s</em> containing the first %d of its %d chapters.</p>
+<p>The full book is available on O'Reilly Learning.</p>
+</div>
+</body>
+</html>`, html.EscapeString(c.bookInfo.Title), c.previewChapters, c.previewTotal)
+
+	return os.WriteFile(filepath.Join(c.bookPath, "OEBPS", previewPage), []byte(page), 0644)
+}
@@ -0,0 +1,96 @@
+package oreilly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errInternalAddress is returned for user-supplied URLs pointing into the
+// server's own network
+var errInternalAddress = errors.New("address is not publicly routable")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), not covered by netip's IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether ip may be fetched on behalf of a user: not
+// loopback, private, link-local (e.g. 169.254.169.254 metadata), multicast or
+// unspecified
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// userURLHTTPClient fetches URLs supplied by API clients (custom covers)
+var userURLHTTPClient = newPublicHTTPClient(2 * time.Minute)
+
+// newPublicHTTPClient returns a client that only connects to public addresses.
+// The check runs on the address actually dialed, after DNS resolution, so it
+// covers every redirect hop and DNS rebinding. Proxies are not used since the
+// dialed address would then be the proxy's.
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout: 30 * time.Second,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					addrPort, err := netip.ParseAddrPort(address)
+					if err != nil {
+						return err
+					}
+					if !publicAddress(addrPort.Addr()) {
+						return fmt.Errorf("%s: %w", addrPort.Addr(), errInternalAddress)
+					}
+					return nil
+				},
+			}).DialContext,
+			TLSHandshakeTimeout:   30 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// checkUserHost rejects a user-supplied host that is an internal IP literal or
+// only resolves to internal addresses. It is an early, friendlier error; the
+// dialer of userURLHTTPClient enforces the rule on every connection.
+func checkUserHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !publicAddress(ip) {
+			return errInternalAddress
+		}
+		return nil
+	}
+	if host == "localhost" {
+		return errInternalAddress
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		// Resolution may work later (or not at all), the dialer decides then
+		return nil
+	}
+	for _, ip := range addrs {
+		if publicAddress(ip) {
+			return nil
+		}
+	}
+	return errInternalAddress
+}
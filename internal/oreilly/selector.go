@@ -0,0 +1,29 @@
+package oreilly
+
+// DefaultContentSelector matches the container of a chapter's content in the
+// pages of current O'Reilly books
+const DefaultContentSelector = "#sbo-rt-content"
+
+// ContentSelector is the CSS selector of a chapter's content container. Books
+// of another content generation can be matched without a code change, e.g.
+// "#sbo-rt-content, .book-content".
+var ContentSelector = DefaultContentSelector
+
+// ContentSelectors overrides ContentSelector for single books (book ID -> selector)
+var ContentSelectors map[string]string
+
+// resolveContentSelector returns the content selector of the book being
+// downloaded and logs when a per-book override applies
+func (c *Client) resolveContentSelector() string {
+	if selector, ok := ContentSelectors[c.bookID]; ok && selector != "" {
+		c.logf("[O'Reilly] Using content selector %q for book %s", selector, c.bookID)
+		return selector
+	}
+	if ContentSelector == "" {
+		return DefaultContentSelector
+	}
+	if ContentSelector != DefaultContentSelector {
+		c.logf("[O'Reilly] Using content selector %q", ContentSelector)
+	}
+	return ContentSelector
+}
@@ -0,0 +1,51 @@
+package oreilly
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// MinEPUBKBPerChapter is the smallest EPUB size expected per included chapter,
+// in KB (0 = no check). A book far below it most likely has empty chapters,
+// e.g. when the book info loaded but the content requests were refused.
+var MinEPUBKBPerChapter = 1
+
+// StrictEPUBSize fails a download whose EPUB is below the expected size
+// instead of delivering it with a warning
+var StrictEPUBSize bool
+
+// ErrEPUBTooSmall is returned (wrapped) for a suspiciously small EPUB in strict mode
+var ErrEPUBTooSmall = errors.New("EPUB is suspiciously small")
+
+// checkEPUBSize compares the size of a generated EPUB with the minimum expected
+// for its chapters and warns (or fails, with StrictEPUBSize) if it is smaller
+func (c *Client) checkEPUBSize(epubPath string) error {
+	if MinEPUBKBPerChapter <= 0 {
+		return nil
+	}
+	info, err := os.Stat(epubPath)
+	if err != nil {
+		return nil
+	}
+
+	chapters := 0
+	for _, chapter := range c.chapters {
+		if !c.skipped[xhtmlFilename(chapter.Filename)] {
+			chapters++
+		}
+	}
+	expected := int64(chapters) * int64(MinEPUBKBPerChapter) * 1024
+	if info.Size() >= expected {
+		return nil
+	}
+
+	message := fmt.Sprintf("EPUB is only %.1f KB, %d chapters should make at least %d KB (content may be missing)",
+		float64(info.Size())/1024, chapters, expected/1024)
+	if StrictEPUBSize {
+		c.logf("[O'Reilly] ERROR: %s", message)
+		return fmt.Errorf("%w: %s", ErrEPUBTooSmall, message)
+	}
+	c.warnf("%s", message)
+	return nil
+}
@@ -0,0 +1,42 @@
+package oreilly
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+)
+
+// SourceLink adds a "View on O'Reilly" link under the cover image. The book's
+// URL is always recorded as dc:source, the link is opt-in for clean output.
+var SourceLink bool
+
+// sourceURL returns the book's page on O'Reilly ("" if the book info has none)
+func (c *Client) sourceURL() string {
+	if c.bookInfo == nil || c.bookInfo.WebURL == "" {
+		return ""
+	}
+	ref, err := url.Parse(c.bookInfo.WebURL)
+	if err != nil {
+		return ""
+	}
+	base, _ := url.Parse(SafariBaseURL)
+	return base.ResolveReference(ref).String()
+}
+
+// sourceMetadata returns the OPF dc:source element pointing at the book's page
+func (c *Client) sourceMetadata() string {
+	source := c.sourceURL()
+	if source == "" {
+		return ""
+	}
+	return fmt.Sprintf("<dc:source>%s</dc:source>\n", html.EscapeString(source))
+}
+
+// sourceLinkHTML returns the cover page's link to the book's page ("" unless SourceLink)
+func (c *Client) sourceLinkHTML() string {
+	source := c.sourceURL()
+	if !SourceLink || source == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<p style="text-align:center"><a href="%s">View on O'Reilly</a></p>`+"\n", html.EscapeString(source))
+}
@@ -0,0 +1,70 @@
+package oreilly
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk bounds each read so the limiter can pace a download smoothly
+const throttleChunk = 32 * 1024
+
+// rateLimiter paces reads to a byte rate. One limiter is shared by every
+// concurrent chapter/asset fetch of a download, so the cap is per download.
+type rateLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec int64
+	start       time.Time
+	consumed    int64
+}
+
+// newRateLimiter returns a limiter for bytesPerSec (nil if unlimited)
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+// wait records n bytes and sleeps until the average rate is back under the limit
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	l.consumed += int64(n)
+	due := time.Duration(l.consumed * int64(time.Second) / l.bytesPerSec)
+	delay := due - time.Since(l.start)
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttledReader is an io.Reader paced by a rateLimiter
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.limiter.wait(n)
+	}
+	return n, err
+}
+
+// SetRateLimit caps the download speed of this client's chapters and assets (0 = unlimited)
+func (c *Client) SetRateLimit(bytesPerSec int64) {
+	c.limiter = newRateLimiter(bytesPerSec)
+}
+
+// throttle wraps a response body with the client's rate limit, if any
+func (c *Client) throttle(r io.Reader) io.Reader {
+	if c.limiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: c.limiter}
+}
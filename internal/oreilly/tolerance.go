@@ -0,0 +1,76 @@
+package oreilly
+
+import (
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+var (
+	// MaxFailedChapters is how many chapters may fail before the download fails
+	// (0 = any failed chapter fails the download unless MaxFailedChapterPercent allows it)
+	MaxFailedChapters int
+
+	// MaxFailedChapterPercent is the share of chapters (0-100) that may fail
+	MaxFailedChapterPercent float64
+)
+
+// chapterFailuresTolerated reports whether a book with failed of total chapters
+// missing may still be packaged
+func chapterFailuresTolerated(failed, total int) bool {
+	if failed == 0 {
+		return true
+	}
+	if MaxFailedChapters > 0 && failed <= MaxFailedChapters {
+		return true
+	}
+	return MaxFailedChapterPercent > 0 && total > 0 &&
+		float64(failed)*100/float64(total) <= MaxFailedChapterPercent
+}
+
+// skipChapters drops failed chapters from the book so the manifest, spine and
+// TOC only reference chapters that were saved, and records them as warnings
+func (c *Client) skipChapters(failed map[int]bool) {
+	kept := make([]models.Chapter, 0, len(c.chapters)-len(failed))
+	if c.skipped == nil {
+		c.skipped = make(map[string]bool, len(failed))
+	}
+	for idx, chapter := range c.chapters {
+		if !failed[idx] {
+			kept = append(kept, chapter)
+			continue
+		}
+		c.skipped[xhtmlFilename(chapter.Filename)] = true
+		c.skippedTitles = append(c.skippedTitles, chapter.Title)
+		c.warnf("Chapter %q skipped after failing to download", chapter.Title)
+	}
+	c.chapters = kept
+
+	c.logf("[O'Reilly] Continuing without %d failed chapter(s), within the configured tolerance", len(failed))
+}
+
+// SkippedChapters returns the titles of chapters left out of the book
+func (c *Client) SkippedChapters() []string {
+	return c.skippedTitles
+}
+
+// withoutSkipped removes TOC entries pointing at skipped chapters, keeping
+// their children (which may live in other files)
+func (c *Client) withoutSkipped(items []models.TOCItem) []models.TOCItem {
+	if len(c.skipped) == 0 {
+		return items
+	}
+
+	var result []models.TOCItem
+	for _, item := range items {
+		children := c.withoutSkipped(item.Children)
+		file, _, _ := strings.Cut(xhtmlHref(item.Href), "#")
+		if c.skipped[file] {
+			result = append(result, children...)
+			continue
+		}
+		item.Children = children
+		result = append(result, item)
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package oreilly
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"goreilly/internal/models"
+)
+
+// TrimEmptyChapters leaves out placeholder chapters whose content has no text
+// and no images, instead of adding blank pages to the book
+var TrimEmptyChapters bool
+
+// keptElements make a chapter worth keeping even without any text
+const keptElements = "img, svg, image, object, video, audio, iframe, embed, canvas, math, table, hr"
+
+// dividerTypes are epub:type/data-type values of pages that are blank on purpose
+var dividerTypes = []string{"part", "division", "volume", "halftitlepage", "titlepage", "dedication", "epigraph"}
+
+// isEmptyChapter reports whether a chapter's content is only whitespace.
+// Cover pages, images and intentional divider pages never count as empty.
+func isEmptyChapter(chapter *models.Chapter, content *goquery.Selection) bool {
+	if isCoverChapter(*chapter) {
+		return false
+	}
+	if strings.Trim(strings.TrimSpace(content.Text()), "\u200b\ufeff") != "" {
+		return false
+	}
+	if content.Find(keptElements).Length() > 0 {
+		return false
+	}
+
+	divider := false
+	content.Find("*").AddSelection(content).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		for _, attr := range []string{"epub:type", "data-type"} {
+			value, _ := s.Attr(attr)
+			for _, kind := range strings.Fields(strings.ToLower(value)) {
+				for _, dividerType := range dividerTypes {
+					if kind == dividerType {
+						divider = true
+						return false
+					}
+				}
+			}
+		}
+		return true
+	})
+	return !divider
+}
+
+// markEmptyChapter records a chapter that was not saved because it is empty
+func (c *Client) markEmptyChapter(chapter *models.Chapter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.emptyChapters == nil {
+		c.emptyChapters = make(map[string]bool)
+	}
+	c.emptyChapters[xhtmlFilename(chapter.Filename)] = true
+}
+
+// trimEmptyChapters drops the chapters marked empty from the book so the
+// manifest, spine and TOC don't reference them, and deletes their files. A
+// book is never trimmed to nothing.
+func (c *Client) trimEmptyChapters() {
+	if len(c.emptyChapters) == 0 {
+		return
+	}
+	if len(c.emptyChapters) >= len(c.chapters) {
+		c.warnf("Every chapter looks empty, keeping them all")
+		c.emptyChapters = nil
+		return
+	}
+
+	kept := make([]models.Chapter, 0, len(c.chapters)-len(c.emptyChapters))
+	if c.skipped == nil {
+		c.skipped = make(map[string]bool, len(c.emptyChapters))
+	}
+	for _, chapter := range c.chapters {
+		file := xhtmlFilename(chapter.Filename)
+		if !c.emptyChapters[file] {
+			kept = append(kept, chapter)
+			continue
+		}
+		c.skipped[file] = true
+		c.trimmedTitles = append(c.trimmedTitles, chapter.Title)
+		if err := os.Remove(filepath.Join(c.bookPath, "OEBPS", file)); err != nil && !os.IsNotExist(err) {
+			c.logf("[O'Reilly] WARNING: Could not remove empty chapter %s: %v", file, err)
+		}
+	}
+	c.chapters = kept
+
+	c.logf("[O'Reilly] Trimmed %d empty chapter(s): %s", len(c.trimmedTitles), strings.Join(c.trimmedTitles, ", "))
+}
+
+// TrimmedChapters returns the titles of empty chapters left out of the book
+func (c *Client) TrimmedChapters() []string {
+	return c.trimmedTitles
+}
@@ -0,0 +1,193 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strings"
+
+	"goreilly/internal/models"
+)
+
+// MinEPUBSize is the smallest file size accepted as a real EPUB
+const MinEPUBSize = 1024
+
+// MaxCoverSize caps the size of a downloaded cover image
+const MaxCoverSize = 10 * 1024 * 1024
+
+// ValidateEPUB checks that a file is a non-empty, well-formed EPUB container:
+// a readable ZIP whose first entry is a "mimetype" of application/epub+zip
+func ValidateEPUB(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot stat EPUB: %w", err)
+	}
+	if info.Size() < MinEPUBSize {
+		return fmt.Errorf("EPUB too small (%d bytes)", info.Size())
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("EPUB is not a valid ZIP: %w", err)
+	}
+	defer r.Close()
+
+	if len(r.File) == 0 || r.File[0].Name != "mimetype" {
+		return fmt.Errorf("EPUB is missing the leading mimetype entry")
+	}
+
+	f, err := r.File[0].Open()
+	if err != nil {
+		return fmt.Errorf("cannot read EPUB mimetype: %w", err)
+	}
+	defer f.Close()
+
+	mimetype, err := io.ReadAll(io.LimitReader(f, 64))
+	if err != nil {
+		return fmt.Errorf("cannot read EPUB mimetype: %w", err)
+	}
+	if strings.TrimSpace(string(mimetype)) != "application/epub+zip" {
+		return fmt.Errorf("unexpected EPUB mimetype: %q", mimetype)
+	}
+
+	return nil
+}
+
+// imageType returns the file extension matching an image's magic bytes,
+// or "" if the data is not a JPEG, PNG or GIF image (the EPUB core image types)
+func imageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	}
+	return ""
+}
+
+// validateCover checks a downloaded cover's Content-Type, size and magic bytes
+// and returns the extension to save it with
+func validateCover(contentType string, data []byte) (string, error) {
+	if contentType != "" && !strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return "", fmt.Errorf("cover is not an image (Content-Type %q)", contentType)
+	}
+	if len(data) > MaxCoverSize {
+		return "", fmt.Errorf("cover exceeds %d bytes", MaxCoverSize)
+	}
+
+	ext := imageType(data)
+	if ext == "" {
+		return "", fmt.Errorf("cover data is not a recognized image (%d bytes)", len(data))
+	}
+	return ext, nil
+}
+
+// opfContainer is META-INF/container.xml
+type opfContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage is the part of content.opf checked by VerifyEPUB
+type opfPackage struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// VerifyEPUB opens an EPUB the way a reader would: container.xml, then the OPF,
+// then every manifest item and spine reference. Problems are collected in the
+// result rather than returned as an error.
+func VerifyEPUB(path string) *models.EPUBVerification {
+	result := &models.EPUBVerification{}
+	fail := func(format string, args ...interface{}) *models.EPUBVerification {
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+		return result
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fail("not a valid ZIP: %v", err)
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	var container opfContainer
+	if err := readZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return fail("%v", err)
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "" {
+		return fail("container.xml has no rootfile")
+	}
+	result.OPFPath = container.Rootfiles[0].FullPath
+
+	var pkg opfPackage
+	if err := readZipXML(files, result.OPFPath, &pkg); err != nil {
+		return fail("%v", err)
+	}
+	result.ManifestItems = len(pkg.Manifest)
+	result.SpineItems = len(pkg.Spine)
+
+	// Manifest hrefs are relative to the OPF
+	opfDir := pathpkg.Dir(result.OPFPath)
+	ids := make(map[string]bool, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		ids[item.ID] = true
+		name := item.Href
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		if opfDir != "." {
+			name = pathpkg.Join(opfDir, name)
+		}
+		if files[name] == nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("manifest item %q missing: %s", item.ID, name))
+		}
+	}
+
+	if len(pkg.Spine) == 0 {
+		result.Errors = append(result.Errors, "spine is empty")
+	}
+	for _, ref := range pkg.Spine {
+		if !ids[ref.IDRef] {
+			result.Errors = append(result.Errors, fmt.Sprintf("spine references unknown item %q", ref.IDRef))
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// readZipXML decodes an XML file from the archive
+func readZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package oreilly
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeEPUB writes a minimal EPUB container with the given mimetype
+func writeEPUB(t *testing.T, path, mimetype string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	mime, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mime.Write([]byte(mimetype))
+	chapter, err := w.CreateHeader(&zip.FileHeader{Name: "OEBPS/ch01.xhtml", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapter.Write(bytes.Repeat([]byte("<p>Some chapter text.</p>\n"), 500))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateEPUB(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.epub")
+	writeEPUB(t, valid, "application/epub+zip")
+	if err := ValidateEPUB(valid); err != nil {
+		t.Fatalf("valid EPUB rejected: %v", err)
+	}
+
+	// A conversion killed halfway leaves a file without the central directory
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.epub")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateEPUB(truncated); err == nil {
+		t.Error("truncated EPUB accepted")
+	}
+
+	empty := filepath.Join(dir, "empty.epub")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateEPUB(empty); err == nil {
+		t.Error("empty file accepted")
+	}
+
+	wrongType := filepath.Join(dir, "wrong.epub")
+	writeEPUB(t, wrongType, "application/zip")
+	if err := ValidateEPUB(wrongType); err == nil {
+		t.Error("EPUB with the wrong mimetype accepted")
+	}
+}
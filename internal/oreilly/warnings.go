@@ -0,0 +1,63 @@
+package oreilly
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"goreilly/internal/models"
+)
+
+// Matches HTML tags, used to recover the text of an unparseable chapter
+var htmlTagPattern = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// warnf logs a non-fatal problem and records it for the download's warnings
+func (c *Client) warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.logf("[O'Reilly] WARNING: %s", message)
+
+	c.mu.Lock()
+	c.warnings = append(c.warnings, message)
+	c.mu.Unlock()
+}
+
+// Warnings returns the non-fatal problems met while downloading the book
+func (c *Client) Warnings() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.warnings...)
+}
+
+// parseChapterHTML parses a chapter page, retrying once with NUL bytes and
+// invalid UTF-8 removed if the first parse fails
+func parseChapterHTML(data []byte) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err == nil {
+		return doc, nil
+	}
+
+	cleaned := strings.ToValidUTF8(strings.ReplaceAll(string(data), "\x00", ""), "\uFFFD")
+	if doc, retryErr := goquery.NewDocumentFromReader(strings.NewReader(cleaned)); retryErr == nil {
+		return doc, nil
+	}
+	return nil, err
+}
+
+// saveRawChapter writes a minimal XHTML page holding the text of a chapter
+// that could not be parsed, so the chapter keeps its place in the book
+func (c *Client) saveRawChapter(chapter *models.Chapter, data []byte) error {
+	text := htmlTagPattern.ReplaceAllString(strings.ToValidUTF8(string(data), ""), " ")
+	text = html.EscapeString(strings.TrimSpace(html.UnescapeString(text)))
+
+	body := fmt.Sprintf(`<h1>%s</h1>
+<pre style="white-space:pre-wrap">%s</pre>`, html.EscapeString(chapter.Title), text)
+	xhtml := fmt.Sprintf(baseHTML, "", body)
+
+	path := filepath.Join(c.bookPath, "OEBPS", xhtmlFilename(chapter.Filename))
+	return os.WriteFile(path, []byte(xhtml), 0644)
+}
@@ -0,0 +1,82 @@
+package oreilly
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"goreilly/internal/models"
+)
+
+// Elements whose text isn't read (skipped by countWords)
+var unreadElements = map[string]bool{"script": true, "style": true, "noscript": true, "template": true}
+
+// Inline elements: the only ones that don't separate the words around them
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true, "code": true,
+	"del": true, "dfn": true, "em": true, "i": true, "ins": true, "kbd": true, "mark": true,
+	"q": true, "s": true, "samp": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "time": true, "u": true, "var": true,
+}
+
+// countWords counts the words of a chapter's readable text
+func countWords(content *goquery.Selection) int {
+	return len(strings.Fields(readableText(content)))
+}
+
+// readableText returns the text a reader sees in content. Unlike
+// Selection.Text it separates block elements, so "<h1>Title</h1><p>Text"
+// is two words rather than one, and it leaves out scripts and styles.
+func readableText(content *goquery.Selection) string {
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if unreadElements[n.Data] {
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && !inlineElements[n.Data]
+		if block {
+			text.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			text.WriteByte(' ')
+		}
+	}
+	for _, node := range content.Nodes {
+		walk(node)
+	}
+	return text.String()
+}
+
+// recordWords stores a chapter's word count. Counts are kept per chapter file
+// so a chapter processed again (retry) isn't counted twice.
+func (c *Client) recordWords(chapter *models.Chapter, content *goquery.Selection) {
+	words := countWords(content)
+	c.mu.Lock()
+	if c.chapterWords == nil {
+		c.chapterWords = make(map[string]int)
+	}
+	c.chapterWords[chapter.Filename] = words
+	c.mu.Unlock()
+}
+
+// WordCount returns the number of words across the downloaded chapters
+func (c *Client) WordCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, words := range c.chapterWords {
+		total += words
+	}
+	return total
+}
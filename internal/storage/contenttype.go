@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+
+	"goreilly/internal/formats"
+)
+
+// contentTypes maps file extensions of uploaded artifacts to their MIME type:
+// the output formats plus the extras bundle and the TOC
+var contentTypes = func() map[string]string {
+	types := map[string]string{
+		".zip":  "application/zip",
+		".json": "application/json",
+	}
+	for _, format := range formats.All {
+		types["."+format.Extension] = format.ContentType
+	}
+	return types
+}()
+
+// defaultContentType is used for files with an unknown extension
+const defaultContentType = "application/octet-stream"
+
+// ContentTypeFor returns the MIME type of a file from its extension
+func ContentTypeFor(filename string) string {
+	if contentType, ok := contentTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return contentType
+	}
+	return defaultContentType
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+
+	"goreilly/internal/formats"
+)
+
+func TestContentTypeFor(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/goreilly/Book_123_job.epub": "application/epub+zip",
+		"Book.PDF":                        "application/pdf",
+		"Book.mobi":                       "application/x-mobipocket-ebook",
+		"Book.azw3":                       "application/vnd.amazon.ebook",
+		"Book.cbz":                        "application/vnd.comicbook+zip",
+		"123_extras.zip":                  "application/zip",
+		"123_toc.json":                    "application/json",
+		"notes.txt":                       defaultContentType,
+		"README":                          defaultContentType,
+	}
+	for name, want := range tests {
+		if got := ContentTypeFor(name); got != want {
+			t.Errorf("ContentTypeFor(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// Every output format uploads with the content type of the format table
+func TestContentTypeForOutputFormats(t *testing.T) {
+	for name, format := range formats.All {
+		if got := ContentTypeFor("book." + format.Extension); got != format.ContentType {
+			t.Errorf("%s: ContentTypeFor = %q, want %q", name, got, format.ContentType)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -17,6 +19,7 @@ import (
 type MinIOClient struct {
 	client     *minio.Client
 	bucketName string
+	region     string
 	useSSL     bool
 	ctx        context.Context
 }
@@ -42,86 +45,257 @@ func NewMinIOClient(config MinIOConfig) (*MinIOClient, error) {
 		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
 	}
 
-	ctx := context.Background()
+	m := &MinIOClient{
+		client:     client,
+		bucketName: config.Bucket,
+		region:     config.Region,
+		useSSL:     config.UseSSL,
+		ctx:        context.Background(),
+	}
+	if err := m.EnsureBucket(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
+// EnsureBucket creates the client's bucket if it doesn't exist yet
+func (m *MinIOClient) EnsureBucket() error {
 	// Check if bucket exists
-	exists, err := client.BucketExists(ctx, config.Bucket)
+	exists, err := m.client.BucketExists(m.ctx, m.bucketName)
 	if err != nil {
 		// If we can't check bucket existence, try to continue anyway
 		// (it might exist but we don't have permissions to check)
-		log.Printf("[MinIO] Connected (bucket: %s, verification skipped)", config.Bucket)
+		log.Printf("[MinIO] Connected (bucket: %s, verification skipped)", m.bucketName)
 	} else if !exists {
 		// Only try to create if we confirmed it doesn't exist
-		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{
-			Region: config.Region,
+		if err := m.client.MakeBucket(m.ctx, m.bucketName, minio.MakeBucketOptions{
+			Region: m.region,
 		}); err != nil {
-			return nil, fmt.Errorf("bucket does not exist and cannot be created: %w", err)
+			return fmt.Errorf("bucket %s does not exist and cannot be created: %w", m.bucketName, err)
 		}
-		log.Printf("[MinIO] Created bucket: %s", config.Bucket)
+		log.Printf("[MinIO] Created bucket: %s", m.bucketName)
 	} else {
-		log.Printf("[MinIO] Connected (bucket: %s)", config.Bucket)
+		log.Printf("[MinIO] Connected (bucket: %s)", m.bucketName)
 	}
-	return &MinIOClient{
-		client:     client,
-		bucketName: config.Bucket,
-		useSSL:     config.UseSSL,
-		ctx:        ctx,
-	}, nil
+	return nil
+}
+
+// Bucket returns the name of the bucket the client works on
+func (m *MinIOClient) Bucket() string {
+	return m.bucketName
+}
+
+// WithBucket returns a client for another bucket on the same connection
+// ("" or the client's own bucket returns m itself)
+func (m *MinIOClient) WithBucket(bucket string) *MinIOClient {
+	if bucket == "" || bucket == m.bucketName {
+		return m
+	}
+	other := *m
+	other.bucketName = bucket
+	return &other
+}
+
+// Ping checks that the MinIO server answers. Errors returned by the server
+// itself (e.g. missing permissions to check the bucket) count as reachable.
+func (m *MinIOClient) Ping() error {
+	_, err := m.client.BucketExists(m.ctx, m.bucketName)
+	if err != nil && minio.ToErrorResponse(err).Code == "" {
+		return fmt.Errorf("MinIO unreachable: %w", err)
+	}
+	return nil
 }
 
-// UploadFile uploads a file to MinIO under bookID folder
-func (m *MinIOClient) UploadFile(bookID, localFilePath string) (string, int64, error) {
+const (
+	// uploadPartSize is the multipart chunk size, files larger than this are uploaded in parts
+	uploadPartSize = 16 * 1024 * 1024
+
+	// Upload retry policy (backoff doubles after each failed attempt)
+	uploadMaxAttempts  = 3
+	uploadRetryBackoff = 2 * time.Second
+)
+
+// UploadOptions holds optional settings for UploadFile
+type UploadOptions struct {
+	// User metadata (title, authors, ...) stored on the object
+	Metadata map[string]string
+
+	// Called as bytes are uploaded
+	OnProgress func(uploaded, total int64)
+
+	// Content type of the object (derived from the file extension when empty)
+	ContentType string
+
+	// Folder prepended to the object name (see ValidatePrefix), e.g. users/alice
+	Prefix string
+
+	// Object file name (default: the local file's name)
+	Name string
+
+	// Per-request build (preview, custom cover, ...): stored in the book's
+	// CustomBuildFolder, which FileExists never returns
+	Custom bool
+
+	// Cancels the upload and its retries (nil = never)
+	Context context.Context
+}
+
+// progressReader receives the bytes minio-go has uploaded and reports the running total.
+// Parts may upload in parallel, so Read is serialized.
+type progressReader struct {
+	mu         sync.Mutex
+	uploaded   int64
+	total      int64
+	onProgress func(uploaded, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.uploaded += int64(len(b))
+	p.onProgress(p.uploaded, p.total)
+	return len(b), nil
+}
+
+// UploadFile uploads a file to MinIO under the bookID folder (inside opts.Prefix, if set)
+func (m *MinIOClient) UploadFile(bookID, localFilePath string, opts UploadOptions) (string, int64, error) {
 	// Get file info
 	fileInfo, err := os.Stat(localFilePath)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	// Create object name: bookID/filename.epub
+	// Create object name: [prefix/]bookID/[custom/]filename.epub
 	fileName := filepath.Base(localFilePath)
-	objectName := fmt.Sprintf("%s/%s", bookID, fileName)
+	if opts.Name != "" {
+		fileName = opts.Name
+	}
+	folder := bookFolder(opts.Prefix, bookID)
+	if opts.Custom {
+		folder += "/" + CustomBuildFolder
+	}
+	objectName := fmt.Sprintf("%s/%s", folder, fileName)
+
+	// Set content type from the extension unless the caller says otherwise
+	contentType := ContentTypeFor(localFilePath)
+	if opts.ContentType != "" {
+		contentType = opts.ContentType
+	}
+	
+	ctx := m.ctx
+	if opts.Context != nil {
+		ctx = opts.Context
+	}
+
+	// Retry with backoff; minio-go aborts incomplete multipart uploads on failure,
+	// so each attempt starts over with a freshly opened file
+	var lastErr error
+	for attempt := 1; attempt <= uploadMaxAttempts; attempt++ {
+		if ctx.Err() != nil {
+			return "", 0, fmt.Errorf("upload cancelled: %w", ctx.Err())
+		}
+		if attempt > 1 {
+			backoff := uploadRetryBackoff * time.Duration(1<<(attempt-2))
+			log.Printf("[Storage] Retrying upload of %s in %v (attempt %d/%d)", objectName, backoff, attempt, uploadMaxAttempts)
+			time.Sleep(backoff)
+		}
+		
+		size, err := m.putFile(ctx, localFilePath, objectName, contentType, fileInfo.Size(), opts)
+		if err == nil {
+			log.Printf("[Storage] Uploaded: %s (%.2f MB)", objectName, float64(size)/(1024*1024))
+			return objectName, size, nil
+		}
+		
+		log.Printf("[Storage] Upload attempt %d/%d failed: %v", attempt, uploadMaxAttempts, err)
+		lastErr = err
+	}
+
+	return "", 0, fmt.Errorf("failed to upload file after %d attempts: %w", uploadMaxAttempts, lastErr)
+}
 
+// putFile performs a single upload attempt of a local file
+func (m *MinIOClient) putFile(ctx context.Context, localFilePath, objectName, contentType string, size int64, opts UploadOptions) (int64, error) {
 	// Open file
 	file, err := os.Open(localFilePath)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to open file: %w", err)
+		return 0, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Set content type for EPUB
-	contentType := "application/epub+zip"
+	putOpts := minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: sanitizeMetadata(opts.Metadata),
+		PartSize:     uploadPartSize,
+	}
+	if opts.OnProgress != nil {
+		putOpts.Progress = &progressReader{total: size, onProgress: opts.OnProgress}
+	}
 	
-	// Upload file
+	// Upload file (multipart above uploadPartSize)
 	uploadInfo, err := m.client.PutObject(
-		m.ctx,
+		ctx,
 		m.bucketName,
 		objectName,
 		file,
-		fileInfo.Size(),
-		minio.PutObjectOptions{
-			ContentType: contentType,
-		},
+		size,
+		putOpts,
 	)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to upload file: %w", err)
+		return 0, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return uploadInfo.Size, nil
+}
+
+// sanitizeMetadata returns a copy of metadata safe to send as HTTP headers
+func sanitizeMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
 	}
 
-	log.Printf("[Storage] Uploaded: %s (%.2f MB)", objectName, float64(uploadInfo.Size)/(1024*1024))
-	return objectName, uploadInfo.Size, nil
+	clean := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		value = sanitizeHeaderValue(value)
+		if value == "" {
+			continue
+		}
+		clean[key] = value
+	}
+	return clean
 }
 
-// FileExists checks if a file exists in MinIO under bookID folder
-// ext parameter is optional - if provided (e.g., ".epub"), will look for that specific extension
-func (m *MinIOClient) FileExists(bookID string, ext ...string) (bool, string, int64, error) {
-	targetExt := ".epub" // EPUB only
+// sanitizeHeaderValue keeps only printable ASCII characters and limits the length
+func sanitizeHeaderValue(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= 0x20 && r < 0x7f {
+			b.WriteRune(r)
+		}
+	}
+
+	clean := strings.TrimSpace(b.String())
+	if len(clean) > 256 {
+		clean = clean[:256]
+	}
+	return clean
+}
+
+// FileExists checks if a file exists in MinIO under the bookID folder (inside prefix, if set)
+// ext parameter is optional - if provided (e.g., ".pdf" or "pdf"), will look for that format.
+// Only objects directly in the folder match: per-request builds in CustomBuildFolder
+// are not the book, and a tenant prefix named like a book ID holds other books.
+func (m *MinIOClient) FileExists(prefix, bookID string, ext ...string) (bool, string, int64, error) {
+	targetExt := ".epub" // Default format
 	if len(ext) > 0 && ext[0] != "" {
-		targetExt = ext[0]
+		targetExt = "." + strings.TrimPrefix(strings.ToLower(ext[0]), ".")
 	}
 	
 	// List objects under bookID prefix
+	folder := bookFolder(prefix, bookID) + "/"
 	objectCh := m.client.ListObjects(m.ctx, m.bucketName, minio.ListObjectsOptions{
-		Prefix:    bookID + "/",
-		Recursive: true,
+		Prefix:    folder,
+		Recursive: false,
 	})
 
 	for object := range objectCh {
@@ -130,6 +304,9 @@ func (m *MinIOClient) FileExists(bookID string, ext ...string) (bool, string, in
 		}
 
 		// Check if it matches the target extension
+		if !directlyIn(folder, object.Key) {
+			continue
+		}
 		if filepath.Ext(object.Key) == targetExt {
 			return true, object.Key, object.Size, nil
 		}
@@ -171,7 +348,15 @@ func (m *MinIOClient) DownloadFile(objectName, destPath string) error {
 	return nil
 }
 
-// DeleteFile deletes a file from MinIO
+// StatFile returns the size and upload time of an object
+func (m *MinIOClient) StatFile(objectName string) (int64, time.Time, error) {
+	info, err := m.client.StatObject(m.ctx, m.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return info.Size, info.LastModified, nil
+}
+
 func (m *MinIOClient) DeleteFile(objectName string) error {
 	if err := m.client.RemoveObject(m.ctx, m.bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
 		return fmt.Errorf("failed to delete object: %w", err)
@@ -179,6 +364,42 @@ func (m *MinIOClient) DeleteFile(objectName string) error {
 	return nil
 }
 
+// PurgeBucket deletes every object in the bucket and returns how many were removed
+func (m *MinIOClient) PurgeBucket() (int, error) {
+	objectCh := make(chan minio.ObjectInfo)
+	var listErr error
+	go func() {
+		defer close(objectCh)
+		for object := range m.client.ListObjects(m.ctx, m.bucketName, minio.ListObjectsOptions{Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			objectCh <- object
+		}
+	}()
+
+	var removed, failed int
+	var lastErr error
+	for result := range m.client.RemoveObjectsWithResult(m.ctx, m.bucketName, objectCh, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			failed++
+			lastErr = result.Err
+			continue
+		}
+		removed++
+	}
+
+	log.Printf("[Storage] Purged %d objects from bucket %s (%d failed)", removed, m.bucketName, failed)
+	if listErr != nil {
+		return removed, fmt.Errorf("failed to list objects: %w", listErr)
+	}
+	if lastErr != nil {
+		return removed, fmt.Errorf("failed to delete %d objects: %w", failed, lastErr)
+	}
+	return removed, nil
+}
+
 // GetObjectInfo gets information about an object
 func (m *MinIOClient) GetObjectInfo(objectName string) (*minio.ObjectInfo, error) {
 	info, err := m.client.StatObject(m.ctx, m.bucketName, objectName, minio.StatObjectOptions{})
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxPrefixLength caps the length of an object prefix
+const MaxPrefixLength = 200
+
+// prefixSegment is the set of characters allowed in one prefix folder name
+var prefixSegment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidatePrefix checks a per-request object prefix (e.g. "users/alice") and
+// returns it without surrounding slashes. Every folder must start with a letter
+// or digit, so "..", "." and hidden or empty segments are rejected.
+func ValidatePrefix(prefix string) (string, error) {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return "", nil
+	}
+	if len(prefix) > MaxPrefixLength {
+		return "", fmt.Errorf("prefix exceeds %d characters", MaxPrefixLength)
+	}
+
+	for _, segment := range strings.Split(prefix, "/") {
+		if !prefixSegment.MatchString(segment) {
+			return "", fmt.Errorf("invalid prefix folder %q (use letters, digits, '.', '_' and '-')", segment)
+		}
+	}
+	return prefix, nil
+}
+
+// CustomBuildFolder is the subfolder of a book's folder holding per-request
+// builds (previews, custom covers, output profiles, embedded audio)
+const CustomBuildFolder = "custom"
+
+// bookFolder returns the folder holding a book's objects
+func bookFolder(prefix, bookID string) string {
+	if prefix == "" {
+		return bookID
+	}
+	return prefix + "/" + bookID
+}
+
+// directlyIn reports whether key is an object directly inside folder (which
+// ends with "/"), not in one of its subfolders
+func directlyIn(folder, key string) bool {
+	name, found := strings.CutPrefix(key, folder)
+	return found && name != "" && !strings.Contains(name, "/")
+}
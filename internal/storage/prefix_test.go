@@ -0,0 +1,21 @@
+package storage
+
+import "testing"
+
+// A tenant prefix named like a book ID must not make its books look like that book
+func TestDirectlyIn(t *testing.T) {
+	folder := bookFolder("", "9781492052197") + "/"
+	tests := map[string]bool{
+		"9781492052197/Book_9781492052197.epub":                     true,
+		"9781492052197/custom/Book_9781492052197_preview.epub":      false,
+		"9781492052197/9781098118730/Other_Book_9781098118730.epub": false,
+		"9781492052197/": false,
+		"97814920521970/Book_97814920521970.epub":           false,
+		"users/alice/9781492052197/Book_9781492052197.epub": false,
+	}
+	for key, want := range tests {
+		if got := directlyIn(folder, key); got != want {
+			t.Errorf("directlyIn(%q, %q) = %v, want %v", folder, key, got, want)
+		}
+	}
+}